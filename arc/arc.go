@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package arc implements a go-mail middleware that seals mails with an Authenticated
+// Received Chain (ARC) as specified in RFC 8617
+package arc
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/dkim"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// Middleware is the middleware struct for the ARC middleware
+type Middleware struct {
+	config *SignerConfig
+	signer crypto.Signer
+
+	errHeader mail.Header
+	failure   FailurePolicy
+	logger    *log.Logger
+	onError   ErrorHandler
+}
+
+const (
+	// Type is the type of Middleware
+	Type mail.MiddlewareType = "arc"
+	// Version is the version of the middleware
+	Version = "0.0.1"
+)
+
+var (
+	// ErrARCHeaderField should be returned if an ARC header field is requested to be
+	// signed by the ARC-Message-Signature
+	ErrARCHeaderField = errors.New("ARC header fields must not be signed by the ARC-Message-Signature")
+	// ErrChainFailed is returned if the ARC chain of a mail has already failed, so that
+	// no further ARC set must be added
+	ErrChainFailed = errors.New("ARC chain of the mail has failed")
+	// ErrEmptyAuthServID should be returned if an empty authserv-id is provided
+	ErrEmptyAuthServID = errors.New("authserv-id must not be empty")
+	// ErrEmptyDomain should be returned if an empty signing domain is provided
+	ErrEmptyDomain = errors.New("signing domain must not be empty")
+	// ErrNoHeaderEnd should be returned if the end of the mail header could not be found
+	ErrNoHeaderEnd = mailauth.ErrNoHeaderEnd
+	// ErrTooManyInstances is returned if the ARC chain of a mail already holds the
+	// maximum number of ARC sets
+	ErrTooManyInstances = errors.New("ARC chain exceeds the maximum number of instances")
+	// ErrUnsupportedKey should be returned if a key other than RSA or Ed25519 is provided
+	ErrUnsupportedKey = errors.New("unsupported private key type. only RSA and Ed25519 keys are supported")
+)
+
+// NewFromRSAKey returns a new Middleware from a given PEM encoded RSA private key
+// byte slice and a SignerConfig
+func NewFromRSAKey(k []byte, sc *SignerConfig, o ...Option) (*Middleware, error) {
+	pk, err := dkim.ParseRSAKey(k)
+	if err != nil {
+		return nil, err
+	}
+	return newMiddleware(sc, pk, o...)
+}
+
+// NewFromEd25519Key returns a new Middleware from a given PEM encoded Ed25519 private
+// key byte slice and a SignerConfig
+func NewFromEd25519Key(k []byte, sc *SignerConfig, o ...Option) (*Middleware, error) {
+	pk, err := dkim.ParseEd25519Key(k)
+	if err != nil {
+		return nil, err
+	}
+	return newMiddleware(sc, pk, o...)
+}
+
+// Handle is the handler method that satisfies the mail.Middleware interface. A new ARC
+// set, consisting of the ARC-Authentication-Results, ARC-Message-Signature and ARC-Seal
+// header fields, is added to the mail. An already existing ARC chain of the mail is
+// validated and continued with the next instance number.
+//
+// If the mail.Msg can not be sealed, it is handled according to the FailurePolicy of
+// the Middleware. A mail with an ARC chain that has already failed or that holds the
+// maximum number of ARC sets must not be sealed again, so it is sent without a new ARC
+// set and only a warning is logged
+func (a Middleware) Handle(m *mail.Msg) *mail.Msg {
+	hl, bhs, err := hashMessage(m)
+	if err != nil {
+		return a.fail(m, err)
+	}
+	set, err := a.seal(hl, bhs)
+	switch {
+	case errors.Is(err, ErrChainFailed), errors.Is(err, ErrTooManyInstances):
+		if a.logger != nil {
+			a.logger.Warnf("%s. sending mail without a new ARC set", err)
+		}
+		return m
+	case err != nil:
+		return a.fail(m, err)
+	}
+	for _, h := range []mailauth.HeaderField{set.aar, set.ams, set.as} {
+		setChainHeader(m, h, hl)
+	}
+	return m
+}
+
+// Type returns the MiddlewareType for this Middleware
+func (a Middleware) Type() mail.MiddlewareType {
+	return Type
+}
+
+// newMiddleware returns a new Middleware and can be used with the mail.WithMiddleware
+// method. It takes a SignerConfig and a crypto.Signer as arguments.
+//
+// This method is invoked by the different New*() methods
+func newMiddleware(sc *SignerConfig, cs crypto.Signer, o ...Option) (*Middleware, error) {
+	if sc == nil || sc.Domain == "" {
+		return nil, ErrEmptyDomain
+	}
+	if sc.Selector == "" {
+		return nil, dkim.ErrEmptySelector
+	}
+	if sc.AuthServID == "" {
+		return nil, ErrEmptyAuthServID
+	}
+	switch cs.Public().(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	a := &Middleware{config: sc, signer: cs}
+	a.applyOptions(o)
+	return a, nil
+}
+
+// hashMessage writes the given mail.Msg without the Middleware in a single pass and
+// returns its header fields and its body hashes. The body is not held in memory
+func hashMessage(m *mail.Msg) ([]mailauth.HeaderField, bodyHashes, error) {
+	sbh := mailauth.NewBodyHasher(crypto.SHA256, msgauth.CanonicalizationSimple, 0)
+	rbh := mailauth.NewBodyHasher(crypto.SHA256, msgauth.CanonicalizationRelaxed, 0)
+	mh := mailauth.NewMessageHasher(sbh, rbh)
+	if _, err := m.WriteToSkipMiddleware(mh, Type); err != nil {
+		return nil, nil, fmt.Errorf("failed to write mail message: %w", err)
+	}
+	hl, err := mh.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse mail message header: %w", err)
+	}
+	return hl, bodyHashes{
+		msgauth.CanonicalizationSimple:  sbh.Sum(),
+		msgauth.CanonicalizationRelaxed: rbh.Sum(),
+	}, nil
+}
+
+// setChainHeader sets the given new ARC header field as preformatted header of the
+// mail.Msg. Since go-mail only holds a single preformatted header field per name, the
+// header fields of the previous instances with the same name are appended to it,
+// unless they are already part of the generic headers of the mail.Msg
+func setChainHeader(m *mail.Msg, h mailauth.HeaderField, hl []mailauth.HeaderField) {
+	v := strings.TrimSuffix(h.Raw[len(h.Name)+2:], crlf)
+	for _, eh := range hl {
+		if !strings.EqualFold(eh.Name, h.Name) {
+			continue
+		}
+		ev := normalize(eh.Value())
+		if slices.ContainsFunc(m.GetGenHeader(mail.Header(eh.Name)), func(gv string) bool {
+			return normalize(gv) == ev
+		}) {
+			continue
+		}
+		_, rv, _ := strings.Cut(eh.Raw, ":")
+		v += crlf + h.Name + ": " + strings.TrimSuffix(strings.TrimLeft(rv, " "), crlf)
+	}
+	m.SetGenHeaderPreformatted(mail.Header(h.Name), v)
+}
+
+// normalize returns the given header field value with all whitespace sequences
+// reduced to a single space
+func normalize(v string) string {
+	return strings.Join(strings.Fields(mailauth.Unfold(v)), " ")
+}
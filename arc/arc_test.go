@@ -0,0 +1,643 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/dkim"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+)
+
+func TestNewFromRSAKey(t *testing.T) {
+	k, _ := testRSAKey(t)
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID)
+	if err != nil {
+		t.Fatalf("failed to create config: %s", err)
+	}
+	if _, err = NewFromRSAKey(k, sc); err != nil {
+		t.Errorf("NewFromRSAKey failed: %s", err)
+	}
+	if _, err = NewFromRSAKey([]byte("invalid"), sc); !errors.Is(err, dkim.ErrDecodePEMFailed) {
+		t.Errorf("NewFromRSAKey with invalid key was supposed to fail with ErrDecodePEMFailed, got: %s", err)
+	}
+}
+
+func TestNewFromEd25519Key(t *testing.T) {
+	k, _ := testEd25519Key(t)
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID)
+	if err != nil {
+		t.Fatalf("failed to create config: %s", err)
+	}
+	if _, err = NewFromEd25519Key(k, sc); err != nil {
+		t.Errorf("NewFromEd25519Key failed: %s", err)
+	}
+	rk, _ := testRSAKey(t)
+	if _, err = NewFromEd25519Key(rk, sc); err == nil {
+		t.Errorf("NewFromEd25519Key with RSA key was supposed to fail, but didn't")
+	}
+}
+
+func TestNewMiddleware_fails(t *testing.T) {
+	_, rk := testRSAKey(t)
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %s", err)
+	}
+	tests := []struct {
+		n  string
+		sc *SignerConfig
+		k  crypto.Signer
+		ex error
+	}{
+		{"nil config", nil, rk, ErrEmptyDomain},
+		{"empty domain", &SignerConfig{Selector: TestSelector, AuthServID: TestAuthServID}, rk, ErrEmptyDomain},
+		{"empty selector", &SignerConfig{Domain: TestDomain, AuthServID: TestAuthServID}, rk, dkim.ErrEmptySelector},
+		{"empty authserv-id", &SignerConfig{Domain: TestDomain, Selector: TestSelector}, rk, ErrEmptyAuthServID},
+		{
+			"ECDSA key", &SignerConfig{Domain: TestDomain, Selector: TestSelector, AuthServID: TestAuthServID},
+			ek, ErrUnsupportedKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			if _, err := newMiddleware(tt.sc, tt.k); !errors.Is(err, tt.ex) {
+				t.Errorf("newMiddleware was supposed to fail with %s, got: %s", tt.ex, err)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle(t *testing.T) {
+	rk, rs := testRSAKey(t)
+	ek, es := testEd25519Key(t)
+	tests := []struct {
+		n  string
+		k  []byte
+		s  crypto.Signer
+		f  func([]byte, *SignerConfig, ...Option) (*Middleware, error)
+		c  msgauth.Canonicalization
+		a  string
+		hf []string
+	}{
+		{"RSA relaxed", rk, rs, NewFromRSAKey, msgauth.CanonicalizationRelaxed, algoRSA, nil},
+		{"RSA simple", rk, rs, NewFromRSAKey, msgauth.CanonicalizationSimple, algoRSA, nil},
+		{"Ed25519 relaxed", ek, es, NewFromEd25519Key, msgauth.CanonicalizationRelaxed, algoEd25519, nil},
+		{
+			"Ed25519 simple with header fields", ek, es, NewFromEd25519Key, msgauth.CanonicalizationSimple,
+			algoEd25519, []string{"From", "To", "Subject"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			lookup := testLookup(t, map[string]crypto.Signer{TestSelector: tt.s})
+			o := []SignerOption{WithHeaderCanonicalization(tt.c), WithBodyCanonicalization(tt.c), WithLookup(lookup)}
+			if tt.hf != nil {
+				o = append(o, WithHeaderFields(tt.hf...))
+			}
+			sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID, o...)
+			if err != nil {
+				t.Fatalf("failed to create config: %s", err)
+			}
+			mw, err := tt.f(tt.k, sc)
+			if err != nil {
+				t.Fatalf("failed to create middleware: %s", err)
+			}
+			m := testMsg(t, mw)
+			m.SetGenHeader(headerAR, TestAuthServID+"; spf=pass smtp.mailfrom=test.tld")
+			hl, body := testWriteMsg(t, m)
+
+			chain, n, err := parseChain(hl)
+			if err != nil {
+				t.Fatalf("failed to parse ARC chain: %s", err)
+			}
+			if n != 1 {
+				t.Fatalf("ARC chain was supposed to have 1 instance, got: %d", n)
+			}
+			aar := chain[0].aar.Value()
+			if aar != "i=1; "+TestAuthServID+"; spf=pass smtp.mailfrom=test.tld" {
+				t.Errorf("unexpected ARC-Authentication-Results: %s", aar)
+			}
+			ams := parseTags(chain[0].ams.Value())
+			if ams["a"] != tt.a {
+				t.Errorf("unexpected ARC-Message-Signature algorithm. Expected: %s, got: %s", tt.a, ams["a"])
+			}
+			if ams["c"] != fmt.Sprintf("%s/%s", tt.c, tt.c) {
+				t.Errorf("unexpected ARC-Message-Signature canonicalization: %s", ams["c"])
+			}
+			if tt.hf != nil && ams["h"] != strings.Join(tt.hf, ":") {
+				t.Errorf("unexpected ARC-Message-Signature header fields: %s", ams["h"])
+			}
+			if strings.Contains(strings.ToLower(ams["h"]), "arc-") {
+				t.Errorf("ARC-Message-Signature must not sign ARC header fields: %s", ams["h"])
+			}
+			if ams["bh"] != testDKIMBodyHash(t, body, tt.c) {
+				t.Errorf("ARC-Message-Signature body hash does not match DKIM body hash")
+			}
+			as := parseTags(chain[0].as.Value())
+			if as["cv"] != cvNone || as["i"] != "1" || as["d"] != TestDomain || as["s"] != TestSelector {
+				t.Errorf("unexpected ARC-Seal: %s", chain[0].as.Value())
+			}
+			if err = validateChain(chain, hl, testBodyHashes(body), lookup); err != nil {
+				t.Errorf("ARC chain validation failed: %s", err)
+			}
+			for _, h := range hl {
+				for _, l := range strings.Split(h.Raw, crlf) {
+					if len(l) > 998 {
+						t.Errorf("header line exceeds maximum line length: %s", l)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_clock(t *testing.T) {
+	_, rs := testRSAKey(t)
+	mw := testMiddleware(t, rs, nil, WithClock(testClock))
+	hl, _ := testWriteMsg(t, testMsg(t, mw))
+	ex := strconv.FormatInt(testClock().Unix(), 10)
+	for _, n := range []string{headerAMS, headerAS} {
+		if ts := parseTags(testHeader(hl, n).Value())["t"]; ts != ex {
+			t.Errorf("unexpected timestamp of %s. Expected: %s, got: %s", n, ex, ts)
+		}
+	}
+}
+
+func TestMiddleware_Handle_authResults(t *testing.T) {
+	_, rs := testRSAKey(t)
+	mw := testMiddleware(t, rs, nil)
+	m := testMsg(t, mw)
+	m.SetGenHeader(headerAR, TestAuthServID+"; spf=pass smtp.mailfrom=test.tld; dkim=pass header.d=test.tld")
+	hl, _ := testWriteMsg(t, m)
+	chain, _, err := parseChain(hl)
+	if err != nil {
+		t.Fatalf("failed to parse ARC chain: %s", err)
+	}
+	ex := "i=1; " + TestAuthServID + "; spf=pass smtp.mailfrom=test.tld; dkim=pass header.d=test.tld"
+	if aar := chain[0].aar.Value(); aar != ex {
+		t.Errorf("unexpected ARC-Authentication-Results. Expected: %s, got: %s", ex, aar)
+	}
+
+	m = testMsg(t, mw)
+	m.SetGenHeader(headerAR, "other.tld; dmarc=fail")
+	hl, _ = testWriteMsg(t, m)
+	if chain, _, err = parseChain(hl); err != nil {
+		t.Fatalf("failed to parse ARC chain: %s", err)
+	}
+	ex = "i=1; " + TestAuthServID + "; none"
+	if aar := chain[0].aar.Value(); aar != ex {
+		t.Errorf("unexpected ARC-Authentication-Results. Expected: %s, got: %s", ex, aar)
+	}
+}
+
+func TestMiddleware_Handle_chain(t *testing.T) {
+	_, rs := testRSAKey(t)
+	_, es := testEd25519Key(t)
+	lookup := testLookup(t, map[string]crypto.Signer{"hop1": rs, "hop2": es, "hop3": rs})
+	hop1 := testMiddleware(t, rs, lookup, withSelector("hop1"))
+	hop2 := testMiddleware(t, es, lookup, withSelector("hop2"))
+	hop3 := testMiddleware(t, rs, lookup, withSelector("hop3"))
+
+	m := testMsg(t, hop1, hop2, hop3)
+	hl, body := testWriteMsg(t, m)
+	chain, n, err := parseChain(hl)
+	if err != nil {
+		t.Fatalf("failed to parse ARC chain: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("ARC chain was supposed to have 3 instances, got: %d", n)
+	}
+	for i, s := range chain {
+		ex := cvPass
+		if i == 0 {
+			ex = cvNone
+		}
+		if cv := parseTags(s.as.Value())["cv"]; cv != ex {
+			t.Errorf("unexpected chain validation status for instance %d. Expected: %s, got: %s", i+1, ex, cv)
+		}
+		if s.as.Value() == "" || instance(s.aar.Value()) != i+1 || instance(s.ams.Value()) != i+1 {
+			t.Errorf("unexpected ARC set for instance %d", i+1)
+		}
+	}
+	if aar := chain[2].aar.Value(); !strings.HasSuffix(aar, "arc=pass") {
+		t.Errorf("ARC-Authentication-Results was supposed to hold the ARC result, got: %s", aar)
+	}
+	if err = validateChain(chain, hl, testBodyHashes(body), lookup); err != nil {
+		t.Errorf("ARC chain validation failed: %s", err)
+	}
+}
+
+func TestMiddleware_Handle_interop(t *testing.T) {
+	_, rs := testRSAKey(t)
+	_, es := testEd25519Key(t)
+	lookup := testLookup(t, map[string]crypto.Signer{"hop1": rs, "hop2": es, "hop3": rs})
+	hop1 := testMiddleware(t, rs, lookup, withSelector("hop1"),
+		WithHeaderCanonicalization(msgauth.CanonicalizationRelaxed),
+		WithBodyCanonicalization(msgauth.CanonicalizationRelaxed))
+	hop2 := testMiddleware(t, es, lookup, withSelector("hop2"),
+		WithHeaderCanonicalization(msgauth.CanonicalizationSimple),
+		WithBodyCanonicalization(msgauth.CanonicalizationSimple))
+	hop3 := testMiddleware(t, rs, lookup, withSelector("hop3"),
+		WithHeaderCanonicalization(msgauth.CanonicalizationRelaxed),
+		WithBodyCanonicalization(msgauth.CanonicalizationSimple))
+
+	m := testMsg(t, hop1, hop2, hop3)
+	// Only SP and HTAB are whitespace for the relaxed canonicalization
+	m.SetGenHeaderPreformatted("X-Test", "\"a\u00a0b\"  \u00a0\v c\f\td ")
+	m.SetBodyString(mail.TypeTextPlain, "a\u00a0b  \u00a0\r\nline\vx \f\r\n", mail.WithPartEncoding(mail.NoEncoding))
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	if !strings.Contains(buf.String(), "a\u00a0b  \u00a0\r\nline\vx") {
+		t.Fatalf("mail message does not contain the raw body")
+	}
+	testVerifyChain(t, buf.Bytes(), map[string]crypto.PublicKey{
+		"hop1": rs.Public(), "hop2": es.Public(), "hop3": rs.Public(),
+	})
+}
+
+func TestMiddleware_seal_failedChain(t *testing.T) {
+	_, rs := testRSAKey(t)
+	lookup := testLookup(t, map[string]crypto.Signer{TestSelector: rs})
+	mw := testMiddleware(t, rs, lookup)
+	hl, body := testWriteMsg(t, testMsg(t, mw))
+
+	tests := []struct {
+		n  string
+		hl []mailauth.HeaderField
+		b  []byte
+	}{
+		{"altered body", hl, append(body, []byte("Altered body\r\n")...)},
+		{"altered header", testReplaceHeader(hl, "Subject", "Subject: Altered subject\r\n"), body},
+		{"altered seal", testReplaceHeader(hl, headerAAR, headerAAR+": i=1; "+TestAuthServID+"; spf=pass\r\n"), body},
+		{"unknown key", testReplaceHeader(hl, headerAS, strings.Replace(testHeader(hl, headerAS).Raw,
+			"s="+TestSelector, "s=unknown", 1)), body},
+		{"missing ARC-Seal", testReplaceHeader(hl, headerAS, ""), body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			set, err := mw.seal(tt.hl, testBodyHashes(tt.b))
+			if err != nil {
+				t.Fatalf("seal failed: %s", err)
+			}
+			as := parseTags(set.as.Value())
+			if as["cv"] != cvFail {
+				t.Errorf("chain validation status was supposed to be fail, got: %s", as["cv"])
+			}
+			if as["i"] != "2" {
+				t.Errorf("instance was supposed to be 2, got: %s", as["i"])
+			}
+		})
+	}
+
+	failed := testReplaceHeader(hl, headerAS, strings.Replace(testHeader(hl, headerAS).Raw, "cv=none", "cv=fail", 1))
+	if _, err := mw.seal(failed, testBodyHashes(body)); !errors.Is(err, ErrChainFailed) {
+		t.Errorf("seal of failed chain was supposed to fail with ErrChainFailed, got: %s", err)
+	}
+	var many []mailauth.HeaderField
+	for i := 1; i <= maxInstances; i++ {
+		for _, n := range []string{headerAAR, headerAMS, headerAS} {
+			many = append(many, mailauth.NewHeaderField(n, fmt.Sprintf("i=%d; cv=pass", i)))
+		}
+	}
+	if _, err := mw.seal(many, testBodyHashes(body)); !errors.Is(err, ErrTooManyInstances) {
+		t.Errorf("seal of chain with %d instances was supposed to fail with ErrTooManyInstances, got: %s",
+			maxInstances, err)
+	}
+}
+
+func TestParseChain_fails(t *testing.T) {
+	tests := []struct {
+		n  string
+		hl []mailauth.HeaderField
+	}{
+		{"invalid instance", []mailauth.HeaderField{mailauth.NewHeaderField(headerAS, "i=0; cv=none")}},
+		{"missing instance tag", []mailauth.HeaderField{mailauth.NewHeaderField(headerAS, "cv=none; i=1")}},
+		{"incomplete set", []mailauth.HeaderField{mailauth.NewHeaderField(headerAS, "i=1; cv=none")}},
+		{"duplicate header", []mailauth.HeaderField{
+			mailauth.NewHeaderField(headerAAR, "i=1; mx.test.tld; none"),
+			mailauth.NewHeaderField(headerAMS, "i=1; a=rsa-sha256"),
+			mailauth.NewHeaderField(headerAS, "i=1; cv=none"), mailauth.NewHeaderField(headerAS, "i=1; cv=none"),
+		}},
+		{"missing instance", []mailauth.HeaderField{
+			mailauth.NewHeaderField(headerAAR, "i=2; mx.test.tld; none"),
+			mailauth.NewHeaderField(headerAMS, "i=2; a=rsa-sha256"),
+			mailauth.NewHeaderField(headerAS, "i=2; cv=none"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			if _, _, err := parseChain(tt.hl); err == nil {
+				t.Errorf("parseChain was supposed to fail, but didn't")
+			}
+		})
+	}
+}
+
+func TestMiddleware_Type(t *testing.T) {
+	_, rs := testRSAKey(t)
+	mw := testMiddleware(t, rs, nil)
+	if mw.Type() != Type {
+		t.Errorf("Type() failed. Expected: %s, got: %s", Type, mw.Type())
+	}
+}
+
+// WithSelector is a SignerOption for the tests to override the selector of the SignerConfig
+func withSelector(s string) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.Selector = s
+		return nil
+	}
+}
+
+// testRSAKey returns a new PEM encoded RSA private key and its crypto.Signer
+func testRSAKey(t *testing.T) ([]byte, crypto.Signer) {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), k
+}
+
+// testEd25519Key returns a new PEM encoded Ed25519 private key and its crypto.Signer
+func testEd25519Key(t *testing.T) ([]byte, crypto.Signer) {
+	t.Helper()
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %s", err)
+	}
+	d, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		t.Fatalf("failed to marshal Ed25519 key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: d}), k
+}
+
+// testLookup returns a dkim.TXTLookupFunc that serves the key records of the given
+// crypto.Signer for the selectors of the TestDomain
+func testLookup(t *testing.T, sl map[string]crypto.Signer) dkim.TXTLookupFunc {
+	t.Helper()
+	rm := make(map[string]string)
+	for s, k := range sl {
+		pk, err := x509.MarshalPKIXPublicKey(k.Public())
+		if err != nil {
+			t.Fatalf("failed to marshal public key: %s", err)
+		}
+		kt := "rsa"
+		if epk, ok := k.Public().(ed25519.PublicKey); ok {
+			kt, pk = "ed25519", epk
+		}
+		rm[s+"._domainkey."+TestDomain] = fmt.Sprintf("v=DKIM1; k=%s; p=%s", kt,
+			base64.StdEncoding.EncodeToString(pk))
+	}
+	return dkim.NewMapLookup(rm)
+}
+
+// testMiddleware returns a new Middleware for the given crypto.Signer
+func testMiddleware(t *testing.T, k crypto.Signer, l dkim.TXTLookupFunc, o ...SignerOption) *Middleware {
+	t.Helper()
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID, append(o, WithLookup(l))...)
+	if err != nil {
+		t.Fatalf("failed to create config: %s", err)
+	}
+	mw, err := newMiddleware(sc, k)
+	if err != nil {
+		t.Fatalf("failed to create middleware: %s", err)
+	}
+	return mw
+}
+
+// testMsg returns a new mail.Msg with the given middlewares
+func testMsg(t *testing.T, mws ...mail.Middleware) *mail.Msg {
+	t.Helper()
+	var o []mail.MsgOption
+	for _, mw := range mws {
+		o = append(o, mail.WithMiddleware(mw))
+	}
+	m := mail.NewMsg(o...)
+	if err := m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	if err := m.To("tina.recipient@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	m.Subject("This is a subject with a rather long text, so that the header needs to be folded")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body  \r\nwith  some\twhitespace \r\n\r\n\r\n")
+	return m
+}
+
+// testWriteMsg writes the given mail.Msg and returns its header fields and body
+func testWriteMsg(t *testing.T, m *mail.Msg) ([]mailauth.HeaderField, []byte) {
+	t.Helper()
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	hl, body, err := mailauth.SplitMessage(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to split message: %s", err)
+	}
+	return hl, body
+}
+
+// testHeader returns the first header field with the given name
+func testHeader(hl []mailauth.HeaderField, n string) mailauth.HeaderField {
+	for _, h := range hl {
+		if strings.EqualFold(h.Name, n) {
+			return h
+		}
+	}
+	return mailauth.HeaderField{}
+}
+
+// testReplaceHeader returns a copy of the given header fields with the first header
+// field of the given name replaced by the given raw header field. If raw is empty, the
+// header field is removed
+func testReplaceHeader(hl []mailauth.HeaderField, n, raw string) []mailauth.HeaderField {
+	var nl []mailauth.HeaderField
+	done := false
+	for _, h := range hl {
+		if !done && strings.EqualFold(h.Name, n) {
+			done = true
+			if raw != "" {
+				nl = append(nl, mailauth.HeaderField{Name: h.Name, Raw: raw})
+			}
+			continue
+		}
+		nl = append(nl, h)
+	}
+	return nl
+}
+
+// testBodyHashes returns the bodyHashes of the given body
+func testBodyHashes(body []byte) bodyHashes {
+	bhs := make(bodyHashes)
+	for _, c := range []msgauth.Canonicalization{msgauth.CanonicalizationSimple, msgauth.CanonicalizationRelaxed} {
+		bh := mailauth.NewBodyHasher(crypto.SHA256, c, 0)
+		_, _ = bh.Write(body)
+		_ = bh.Close()
+		bhs[c] = bh.Sum()
+	}
+	return bhs
+}
+
+// testDKIMBodyHash returns the body hash that go-msgauth calculates in a DKIM signature
+// for the given body and canonicalization
+func testDKIMBodyHash(t *testing.T, body []byte, c msgauth.Canonicalization) string {
+	t.Helper()
+	_, k, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %s", err)
+	}
+	msg := append([]byte("From: toni.sender@test.tld\r\n\r\n"), body...)
+	buf := bytes.Buffer{}
+	if err = msgauth.Sign(&buf, bytes.NewReader(msg), &msgauth.SignOptions{
+		Domain: TestDomain, Selector: TestSelector, Signer: k,
+		HeaderCanonicalization: c, BodyCanonicalization: c,
+	}); err != nil {
+		t.Fatalf("failed to sign message with DKIM: %s", err)
+	}
+	hl, _, err := mailauth.SplitMessage(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed to split DKIM signed message: %s", err)
+	}
+	return parseTags(testHeader(hl, "DKIM-Signature").Value())["bh"]
+}
+
+// testVerifyChain verifies all ARC sets of the given mail. It is an implementation of
+// RFC 8617, section 5.2 for the tests only, which is independent of the sealer: header
+// fields are parsed and canonicalized from scratch and the body hashes are calculated
+// by go-msgauth. The public keys are given per selector
+func testVerifyChain(t *testing.T, raw []byte, keys map[string]crypto.PublicKey) {
+	t.Helper()
+	header, body, ok := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !ok {
+		t.Fatalf("mail message has no body")
+	}
+	fields := regexp.MustCompile(`(?m)^[^ \t\r\n][^\r\n]*\r\n(?:[ \t][^\r\n]*\r\n)*`).FindAllString(
+		string(header)+"\r\n", -1)
+	type field struct{ name, raw string }
+	var fl []field
+	sets := make(map[int]map[string]string)
+	for _, f := range fields {
+		n, v, _ := strings.Cut(f, ":")
+		n = strings.ToLower(strings.TrimRight(n, " \t"))
+		fl = append(fl, field{n, f})
+		if n == "arc-seal" || n == "arc-message-signature" || n == "arc-authentication-results" {
+			i, err := strconv.Atoi(testTags(v)["i"])
+			if err != nil {
+				t.Fatalf("invalid instance number in %s header field", n)
+			}
+			if sets[i] == nil {
+				sets[i] = make(map[string]string)
+			}
+			sets[i][n] = f
+		}
+	}
+	canon := func(raw string, c string) string {
+		if c == string(msgauth.CanonicalizationSimple) {
+			return raw
+		}
+		n, v, _ := strings.Cut(raw, ":")
+		v = regexp.MustCompile(`[ \t]+`).ReplaceAllString(strings.ReplaceAll(v, "\r\n", ""), " ")
+		return strings.ToLower(strings.TrimRight(n, " \t")) + ":" + strings.Trim(v, " \t") + "\r\n"
+	}
+	noSig := regexp.MustCompile(`((?:^|;)[ \t\r\n]*b[ \t\r\n]*=)[^;]*`)
+	verify := func(n string, tags map[string]string, data string) {
+		t.Helper()
+		sig, err := base64.StdEncoding.DecodeString(tags["b"])
+		if err != nil {
+			t.Fatalf("failed to decode signature of %s: %s", n, err)
+		}
+		h := sha256.Sum256([]byte(data))
+		switch pk := keys[tags["s"]].(type) {
+		case *rsa.PublicKey:
+			err = rsa.VerifyPKCS1v15(pk, crypto.SHA256, h[:], sig)
+		case ed25519.PublicKey:
+			if !ed25519.Verify(pk, h[:], sig) {
+				err = errors.New("invalid Ed25519 signature")
+			}
+		default:
+			err = errors.New("unknown selector")
+		}
+		if err != nil {
+			t.Errorf("%s did not verify: %s", n, err)
+		}
+	}
+
+	if len(sets) == 0 {
+		t.Fatalf("mail message has no ARC sets")
+	}
+	var seal strings.Builder
+	for i := 1; i <= len(sets); i++ {
+		s := sets[i]
+		if len(s) != 3 {
+			t.Fatalf("incomplete ARC set for instance %d", i)
+		}
+		as := testTags(strings.SplitN(s["arc-seal"], ":", 2)[1])
+		if ex := map[bool]string{true: "none", false: "pass"}[i == 1]; as["cv"] != ex {
+			t.Errorf("unexpected chain validation status for instance %d: %s", i, as["cv"])
+		}
+
+		// The ARC-Message-Signature is verified just like a DKIM signature
+		ams := testTags(strings.SplitN(s["arc-message-signature"], ":", 2)[1])
+		hc, bc, _ := strings.Cut(ams["c"], "/")
+		if bh := testDKIMBodyHash(t, body, msgauth.Canonicalization(bc)); bh != ams["bh"] {
+			t.Errorf("body hash of ARC-Message-Signature %d does not match go-msgauth", i)
+		}
+		var data strings.Builder
+		used := make(map[int]bool)
+		for _, hn := range strings.Split(ams["h"], ":") {
+			for j := len(fl) - 1; j >= 0; j-- {
+				if !used[j] && fl[j].name == strings.ToLower(hn) {
+					data.WriteString(canon(fl[j].raw, hc))
+					used[j] = true
+					break
+				}
+			}
+		}
+		data.WriteString(canon(noSig.ReplaceAllString(s["arc-message-signature"], "$1"), hc))
+		verify(fmt.Sprintf("ARC-Message-Signature %d", i), ams, strings.TrimSuffix(data.String(), "\r\n"))
+
+		seal.WriteString(canon(s["arc-authentication-results"], "relaxed"))
+		seal.WriteString(canon(s["arc-message-signature"], "relaxed"))
+		verify(fmt.Sprintf("ARC-Seal %d", i), as, seal.String()+strings.TrimSuffix(
+			canon(noSig.ReplaceAllString(s["arc-seal"], "$1"), "relaxed"), "\r\n"))
+		seal.WriteString(canon(s["arc-seal"], "relaxed"))
+	}
+}
+
+// testTags returns the tags of the given tag list with all whitespace removed
+func testTags(v string) map[string]string {
+	tm := make(map[string]string)
+	for _, t := range strings.Split(v, ";") {
+		if k, tv, ok := strings.Cut(t, "="); ok {
+			tm[strings.TrimSpace(k)] = regexp.MustCompile(`\s+`).ReplaceAllString(tv, "")
+		}
+	}
+	return tm
+}
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail-middleware/dkim"
+)
+
+// SignerConfig is the configuration to use in Middleware creation
+type SignerConfig struct {
+	// AuthServID represents the authentication service identifier of the sealer
+	// See: https://www.rfc-editor.org/rfc/rfc8601.html#section-2.5
+	//
+	// The authserv-id is used in the ARC-Authentication-Results header field. The
+	// results of all Authentication-Results header fields of the mail with the same
+	// authserv-id are copied into the ARC-Authentication-Results header field.
+	//
+	// AuthServID MUST not be empty
+	AuthServID string
+
+	// CanonicalizationHeader defines the type of Canonicalization used for the mail.Msg
+	// header in the ARC-Message-Signature. The ARC-Seal always uses the relaxed
+	// canonicalization.
+	//
+	// If no canonicalization is defined, we default to CanonicalizationRelaxed
+	//
+	// See: https://www.rfc-editor.org/rfc/rfc8617.html#section-4.1.2
+	CanonicalizationHeader msgauth.Canonicalization
+
+	// CanonicalizationBody defines the type of Canonicalization used for the mail.Msg
+	// body in the ARC-Message-Signature.
+	//
+	// If no canonicalization is defined, we default to CanonicalizationRelaxed
+	//
+	// See: https://www.rfc-editor.org/rfc/rfc8617.html#section-4.1.2
+	CanonicalizationBody msgauth.Canonicalization
+
+	// Clock is an optional function that returns the current time. It provides the
+	// time of the "t=" tag of the ARC-Message-Signature and the ARC-Seal. Setting a
+	// fixed time makes the ARC sets reproducible, e.g. for golden file tests.
+	//
+	// If Clock is nil, time.Now is used
+	Clock func() time.Time
+
+	// Domain represents the Signing Domain Identifier (SDID) of the ARC-Message-Signature
+	// and the ARC-Seal
+	//
+	// Domain MUST not be empty
+	Domain string
+
+	// HeaderFields is an optional list of header fields that should be used in the
+	// ARC-Message-Signature. If the list is empty, all header fields of the mail except
+	// for the ARC header fields will be used.
+	//
+	// If a list of headers is given via the HeaderFields slice, the FROM header
+	// is always required.
+	HeaderFields []string
+
+	// Lookup is the dkim.TXTLookupFunc that is used to look up the public keys for the
+	// validation of an already existing ARC chain of the mail. If Lookup is nil, the
+	// DNS is queried
+	Lookup dkim.TXTLookupFunc
+
+	// Selector represents the domain selector of the ARC-Message-Signature and the
+	// ARC-Seal. ARC uses the same key records as DKIM
+	//
+	// Selector MUST not be empty
+	Selector string
+}
+
+// SignerOption returns a function that can be used for grouping SignerConfig options
+type SignerOption func(config *SignerConfig) error
+
+// NewConfig returns a new SignerConfig struct. It requires a domain name d, a domain
+// selector s and an authserv-id a. All other values can be prefilled using the With*()
+// SignerOption methods
+func NewConfig(d, s, a string, o ...SignerOption) (*SignerConfig, error) {
+	sc := &SignerConfig{
+		AuthServID:             a,
+		CanonicalizationBody:   msgauth.CanonicalizationRelaxed,
+		CanonicalizationHeader: msgauth.CanonicalizationRelaxed,
+		Domain:                 d,
+		Selector:               s,
+	}
+
+	// Override defaults with optionally provided Option functions
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		if err := co(sc); err != nil {
+			return sc, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	return sc, nil
+}
+
+// WithHeaderCanonicalization provides the Canonicalization for the message header in the SignerConfig
+func WithHeaderCanonicalization(c msgauth.Canonicalization) SignerOption {
+	return func(sc *SignerConfig) error {
+		return sc.SetHeaderCanonicalization(c)
+	}
+}
+
+// WithBodyCanonicalization provides the Canonicalization for the message body in the SignerConfig
+func WithBodyCanonicalization(c msgauth.Canonicalization) SignerOption {
+	return func(sc *SignerConfig) error {
+		return sc.SetBodyCanonicalization(c)
+	}
+}
+
+// WithClock provides the Clock for the SignerConfig
+func WithClock(c func() time.Time) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.SetClock(c)
+		return nil
+	}
+}
+
+// WithHeaderFields provides a list of header field names that should be included
+// in the ARC-Message-Signature
+func WithHeaderFields(fl ...string) SignerOption {
+	return func(sc *SignerConfig) error {
+		return sc.SetHeaderFields(fl...)
+	}
+}
+
+// WithLookup provides the dkim.TXTLookupFunc for the ARC chain validation to the SignerConfig
+func WithLookup(l dkim.TXTLookupFunc) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.Lookup = l
+		return nil
+	}
+}
+
+// SetHeaderCanonicalization sets/overrides the header Canonicalization of the SignerConfig
+func (sc *SignerConfig) SetHeaderCanonicalization(c msgauth.Canonicalization) error {
+	if !sc.CanonicalizationIsValid(c) {
+		return fmt.Errorf("%s: %w", c, dkim.ErrInvalidCanonicalization)
+	}
+	sc.CanonicalizationHeader = c
+	return nil
+}
+
+// SetBodyCanonicalization sets/overrides the body Canonicalization of the SignerConfig
+func (sc *SignerConfig) SetBodyCanonicalization(c msgauth.Canonicalization) error {
+	if !sc.CanonicalizationIsValid(c) {
+		return fmt.Errorf("%s: %w", c, dkim.ErrInvalidCanonicalization)
+	}
+	sc.CanonicalizationBody = c
+	return nil
+}
+
+// SetClock sets/overrides the Clock of the SignerConfig
+func (sc *SignerConfig) SetClock(c func() time.Time) {
+	sc.Clock = c
+}
+
+// SetHeaderFields sets/override the HeaderFields of the SignerConfig
+func (sc *SignerConfig) SetHeaderFields(fl ...string) error {
+	hf := false
+	for _, f := range fl {
+		if isARCHeader(f) {
+			return fmt.Errorf("%s: %w", f, ErrARCHeaderField)
+		}
+		if strings.EqualFold(f, "From") {
+			hf = true
+		}
+	}
+	if !hf {
+		return dkim.ErrFromRequired
+	}
+	sc.HeaderFields = append(sc.HeaderFields, fl...)
+	return nil
+}
+
+// CanonicalizationIsValid returns true if a the provided Canonicalization is a valid value for the SignerConfig
+func (sc *SignerConfig) CanonicalizationIsValid(c msgauth.Canonicalization) bool {
+	switch c {
+	case msgauth.CanonicalizationSimple, msgauth.CanonicalizationRelaxed:
+	default:
+		return false
+	}
+	return true
+}
+
+// now returns the current time of the Clock of the SignerConfig
+func (sc *SignerConfig) now() time.Time {
+	if sc.Clock == nil {
+		return time.Now()
+	}
+	return sc.Clock()
+}
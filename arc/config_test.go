@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail-middleware/dkim"
+)
+
+const (
+	TestDomain     = "test.tld"
+	TestSelector   = "arc"
+	TestAuthServID = "mx.test.tld"
+)
+
+func TestNewConfig(t *testing.T) {
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID)
+	if err != nil {
+		t.Fatalf("NewConfig failed: %s", err)
+	}
+	if sc.Domain != TestDomain {
+		t.Errorf("NewConfig failed. Expected domain: %s, got: %s", TestDomain, sc.Domain)
+	}
+	if sc.Selector != TestSelector {
+		t.Errorf("NewConfig failed. Expected selector: %s, got: %s", TestSelector, sc.Selector)
+	}
+	if sc.AuthServID != TestAuthServID {
+		t.Errorf("NewConfig failed. Expected authserv-id: %s, got: %s", TestAuthServID, sc.AuthServID)
+	}
+	if sc.CanonicalizationHeader != msgauth.CanonicalizationRelaxed ||
+		sc.CanonicalizationBody != msgauth.CanonicalizationRelaxed {
+		t.Errorf("NewConfig failed. Expected relaxed/relaxed canonicalization, got: %s/%s",
+			sc.CanonicalizationHeader, sc.CanonicalizationBody)
+	}
+	if len(sc.HeaderFields) != 0 {
+		t.Errorf("NewConfig failed. Expected no header fields, got: %s", sc.HeaderFields)
+	}
+}
+
+func TestNewConfig_WithOptions(t *testing.T) {
+	l := dkim.NewMapLookup(nil)
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID,
+		WithHeaderCanonicalization(msgauth.CanonicalizationSimple),
+		WithBodyCanonicalization(msgauth.CanonicalizationSimple),
+		WithHeaderFields("From", "To", "Subject"), WithLookup(l), WithClock(testClock), nil)
+	if err != nil {
+		t.Fatalf("NewConfig failed: %s", err)
+	}
+	if sc.CanonicalizationHeader != msgauth.CanonicalizationSimple ||
+		sc.CanonicalizationBody != msgauth.CanonicalizationSimple {
+		t.Errorf("NewConfig failed. Expected simple/simple canonicalization, got: %s/%s",
+			sc.CanonicalizationHeader, sc.CanonicalizationBody)
+	}
+	if len(sc.HeaderFields) != 3 {
+		t.Errorf("NewConfig failed. Expected 3 header fields, got: %s", sc.HeaderFields)
+	}
+	if sc.Lookup == nil {
+		t.Errorf("NewConfig failed. Expected lookup function to be set")
+	}
+	if !sc.now().Equal(testClock()) {
+		t.Errorf("NewConfig failed. Expected clock time: %s, got: %s", testClock(), sc.now())
+	}
+}
+
+func TestSignerConfig_SetClock(t *testing.T) {
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID)
+	if err != nil {
+		t.Fatalf("NewConfig failed: %s", err)
+	}
+	if d := time.Since(sc.now()); d < 0 || d > time.Minute {
+		t.Errorf("SignerConfig without clock was supposed to use the current time, got: %s", sc.now())
+	}
+	sc.SetClock(testClock)
+	if !sc.now().Equal(testClock()) {
+		t.Errorf("SetClock failed. Expected time: %s, got: %s", testClock(), sc.now())
+	}
+}
+
+// testClock returns a fixed time for reproducible tests
+func testClock() time.Time {
+	return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+}
+
+func TestNewConfig_fails(t *testing.T) {
+	tests := []struct {
+		n  string
+		o  SignerOption
+		ex error
+	}{
+		{
+			"invalid header canonicalization", WithHeaderCanonicalization("invalid"),
+			dkim.ErrInvalidCanonicalization,
+		},
+		{
+			"invalid body canonicalization", WithBodyCanonicalization("invalid"),
+			dkim.ErrInvalidCanonicalization,
+		},
+		{"header fields without From", WithHeaderFields("To", "Subject"), dkim.ErrFromRequired},
+		{"ARC header field", WithHeaderFields("From", "ARC-Seal"), ErrARCHeaderField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			if _, err := NewConfig(TestDomain, TestSelector, TestAuthServID, tt.o); !errors.Is(err, tt.ex) {
+				t.Errorf("NewConfig was supposed to fail with %s, got: %s", tt.ex, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// FailurePolicy is an alias type for an int
+type FailurePolicy int
+
+// ErrorHandler is a function that is called with the mail.Msg and the error whenever
+// the Middleware fails to seal a mail
+type ErrorHandler func(msg *mail.Msg, err error)
+
+// Option returns a function that can be used for grouping Middleware options
+type Option func(a *Middleware)
+
+const (
+	// FailOpen will send a mail that could not be sealed without a new ARC set. The
+	// error is logged and handed to the ErrorHandler. This is the default
+	FailOpen FailurePolicy = iota
+	// FailMark will send a mail that could not be sealed without a new ARC set, but
+	// notes the error in the error header of the mail (HeaderError by default)
+	FailMark
+	// FailClosed will make a mail that could not be sealed undeliverable. The recipients
+	// are removed, the error is noted in the error header and writing the mail fails with
+	// an error wrapping ErrNotSealed
+	FailClosed
+)
+
+// HeaderError is the default mail header field that is set on a mail.Msg that the
+// Middleware failed to seal with the FailMark or FailClosed FailurePolicy
+const HeaderError mail.Header = "X-ARC-Error"
+
+// ErrNotSealed is returned when writing a mail.Msg that the Middleware failed to seal
+// with the FailClosed FailurePolicy. It prevents the mail from being sent unsealed
+var ErrNotSealed = errors.New("arc: mail message could not be sealed")
+
+// recipientHeaders are the address headers that hold the recipients of a mail.Msg
+var recipientHeaders = []mail.AddrHeader{mail.HeaderTo, mail.HeaderCc, mail.HeaderBcc}
+
+// WithErrorHandler sets an ErrorHandler for the Middleware, that is called for every
+// mail that the Middleware fails to seal, independent of the FailurePolicy
+func WithErrorHandler(f ErrorHandler) Option {
+	return func(a *Middleware) {
+		a.onError = f
+	}
+}
+
+// WithErrorHeader sets the mail header field that is used by the FailMark and FailClosed
+// FailurePolicy to note the sealing error
+func WithErrorHeader(h mail.Header) Option {
+	return func(a *Middleware) {
+		a.errHeader = h
+	}
+}
+
+// WithFailurePolicy sets the FailurePolicy for the Middleware. FailMark and FailClosed
+// can be used as strict mode, so that sealing failures do not go unnoticed
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(a *Middleware) {
+		a.failure = p
+	}
+}
+
+// WithLogger sets a log.Logger for the Middleware
+func WithLogger(l *log.Logger) Option {
+	return func(a *Middleware) {
+		a.logger = l
+	}
+}
+
+// String satisfies the fmt.Stringer interface for the FailurePolicy type
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailOpen:
+		return "fail-open"
+	case FailMark:
+		return "mark"
+	case FailClosed:
+		return "fail-closed"
+	default:
+		return "unknown"
+	}
+}
+
+// applyOptions applies the given Option functions to the Middleware and sets the
+// defaults for all options that were not provided
+func (a *Middleware) applyOptions(o []Option) {
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		co(a)
+	}
+	if a.logger == nil {
+		a.logger = log.New(os.Stderr, "arc", log.LevelWarn)
+	}
+}
+
+// fail handles a sealing error for the given mail.Msg according to the configured
+// FailurePolicy. The ErrorHandler of the Middleware is called first, independent of
+// the policy
+func (a Middleware) fail(m *mail.Msg, err error) *mail.Msg {
+	if a.onError != nil {
+		a.onError(m, err)
+	}
+	eh := a.errHeader
+	if eh == "" {
+		eh = HeaderError
+	}
+	switch a.failure {
+	case FailMark:
+		a.logError("%s. sending mail unsealed", err)
+		m.SetGenHeader(eh, err.Error())
+	case FailClosed:
+		a.logError("%s. mail will not be sent", err)
+		for _, h := range recipientHeaders {
+			m.SetAddrHeaderFromMailAddress(h)
+		}
+		m.SetGenHeader(eh, err.Error())
+		m.UnsetAllParts()
+		m.SetBodyWriter(mail.TypeTextPlain, func(io.Writer) (int64, error) {
+			return 0, fmt.Errorf("%w: %w", ErrNotSealed, err)
+		}, mail.WithPartEncoding(mail.NoEncoding))
+	default:
+		a.logError("%s. sending mail unsealed", err)
+	}
+	return m
+}
+
+// logError logs an error message with the log.Logger of the Middleware, if present
+func (a Middleware) logError(f string, v ...interface{}) {
+	if a.logger != nil {
+		a.logger.Errorf(f, v...)
+	}
+}
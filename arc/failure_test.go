@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// errSignerFailed is the error returned by the failingSigner
+var errSignerFailed = errors.New("signer failed")
+
+// failingSigner is a crypto.Signer that always fails to sign
+type failingSigner struct {
+	crypto.Signer
+}
+
+// Sign satisfies the crypto.Signer interface for the failingSigner type
+func (failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errSignerFailed
+}
+
+func TestFailurePolicy_String(t *testing.T) {
+	tests := []struct {
+		p  FailurePolicy
+		ex string
+	}{
+		{FailOpen, "fail-open"},
+		{FailMark, "mark"},
+		{FailClosed, "fail-closed"},
+		{FailurePolicy(99), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ex, func(t *testing.T) {
+			if tt.p.String() != tt.ex {
+				t.Errorf("FailurePolicy.String failed, expected: %s, got: %s", tt.ex, tt.p.String())
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_Failure(t *testing.T) {
+	_, rs := testRSAKey(t)
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID)
+	if err != nil {
+		t.Fatalf("failed to create config: %s", err)
+	}
+	tests := []struct {
+		n  string
+		p  FailurePolicy
+		h  mail.Header
+		eh mail.Header
+	}{
+		{"Fail open", FailOpen, "", ""},
+		{"Mark", FailMark, "", HeaderError},
+		{"Mark with custom header", FailMark, "X-Sealing-Failed", "X-Sealing-Failed"},
+		{"Fail closed", FailClosed, "", HeaderError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			var herr error
+			lbuf := bytes.Buffer{}
+			mw, err := newMiddleware(sc, failingSigner{rs}, WithFailurePolicy(tt.p), WithErrorHeader(tt.h),
+				WithLogger(log.New(&lbuf, "arc", log.LevelWarn)),
+				WithErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+			if err != nil {
+				t.Fatalf("failed to create middleware: %s", err)
+			}
+			m := testMsg(t, mw)
+			buf := bytes.Buffer{}
+			_, err = m.WriteTo(&buf)
+
+			if !errors.Is(herr, errSignerFailed) {
+				t.Errorf("ErrorHandler was supposed to be called with the signing error, got: %v", herr)
+			}
+			if !strings.Contains(lbuf.String(), "ERROR: ") {
+				t.Errorf("sealing error was supposed to be logged, got: %q", lbuf.String())
+			}
+			if tt.p == FailClosed {
+				if !errors.Is(err, ErrNotSealed) || !errors.Is(err, errSignerFailed) {
+					t.Errorf("WriteTo was supposed to fail with ErrNotSealed, got: %v", err)
+				}
+				if len(m.GetToString()) != 0 {
+					t.Errorf("recipients of mail were supposed to be removed, got: %v", m.GetToString())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed writing message to memory: %s", err)
+			}
+			if strings.Contains(buf.String(), headerAS+": ") {
+				t.Errorf("mail was not supposed to be sealed")
+			}
+			if tt.eh == "" {
+				if strings.Contains(buf.String(), string(HeaderError)) {
+					t.Errorf("mail was not supposed to be marked with %s", HeaderError)
+				}
+				return
+			}
+			if !strings.Contains(buf.String(), string(tt.eh)+": ") {
+				t.Errorf("mail was supposed to be marked with %s", tt.eh)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_FailedChain(t *testing.T) {
+	_, rs := testRSAKey(t)
+	sc, err := NewConfig(TestDomain, TestSelector, TestAuthServID)
+	if err != nil {
+		t.Fatalf("failed to create config: %s", err)
+	}
+	var herr error
+	lbuf := bytes.Buffer{}
+	mw, err := newMiddleware(sc, rs, WithFailurePolicy(FailClosed),
+		WithLogger(log.New(&lbuf, "arc", log.LevelWarn)),
+		WithErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+	if err != nil {
+		t.Fatalf("failed to create middleware: %s", err)
+	}
+	m := testMsg(t, mw)
+	m.SetGenHeader(headerAAR, "i=1; mx.other.tld; spf=pass")
+	m.SetGenHeader(headerAMS, "i=1; a=rsa-sha256; d=other.tld; s=arc; h=From; bh=; b=")
+	m.SetGenHeader(headerAS, "i=1; cv=fail; a=rsa-sha256; d=other.tld; s=arc; b=")
+	hl, _ := testWriteMsg(t, m)
+
+	if herr != nil {
+		t.Errorf("ErrorHandler was not supposed to be called for a failed chain, got: %s", herr)
+	}
+	if !strings.Contains(lbuf.String(), "WARN: ") || !strings.Contains(lbuf.String(), ErrChainFailed.Error()) {
+		t.Errorf("failed chain was supposed to be logged as warning, got: %q", lbuf.String())
+	}
+	if _, n, err := parseChain(hl); err != nil || n != 1 {
+		t.Errorf("mail was not supposed to get a new ARC set, got %d instances: %v", n, err)
+	}
+	if h := testHeader(hl, string(HeaderError)); h.Raw != "" {
+		t.Errorf("mail was not supposed to be marked with %s", HeaderError)
+	}
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// headerAAR is the name of the ARC-Authentication-Results header field
+	headerAAR = "ARC-Authentication-Results"
+	// headerAMS is the name of the ARC-Message-Signature header field
+	headerAMS = "ARC-Message-Signature"
+	// headerAS is the name of the ARC-Seal header field
+	headerAS = "ARC-Seal"
+	// headerAR is the name of the Authentication-Results header field
+	headerAR = "Authentication-Results"
+	// crlf is the line ending of a mail message
+	crlf = "\r\n"
+)
+
+// parseTags returns the tags of the given tag list as map of tag names to tag values.
+// All whitespace is removed from the tag values. Tags without a value assignment are
+// ignored, so that the authserv-id and the results of an ARC-Authentication-Results
+// header field are skipped
+func parseTags(s string) map[string]string {
+	tm := make(map[string]string)
+	for _, t := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(t, "=")
+		if !ok {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		if _, ok = tm[k]; ok {
+			continue
+		}
+		tm[k] = strings.Join(strings.Fields(v), "")
+	}
+	return tm
+}
+
+// instance returns the ARC instance number of the "i=" tag of the given ARC header
+// field value or 0 if it is missing or invalid
+func instance(v string) int {
+	k, iv, ok := strings.Cut(strings.SplitN(v, ";", 2)[0], "=")
+	if !ok || strings.TrimSpace(k) != "i" {
+		return 0
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(iv))
+	if err != nil || i < 1 {
+		return 0
+	}
+	return i
+}
+
+// stripSignature returns the given raw header field with an empty "b=" tag value
+func stripSignature(raw string) string {
+	end := len(strings.TrimSuffix(raw, crlf))
+	for p := strings.IndexByte(raw, ':') + 1; p < end; {
+		e := strings.IndexByte(raw[p:end], ';')
+		if e < 0 {
+			e = end
+		} else {
+			e += p
+		}
+		if k, _, ok := strings.Cut(raw[p:e], "="); ok && strings.TrimSpace(k) == "b" {
+			return raw[:p+strings.IndexByte(raw[p:e], '=')+1] + raw[e:]
+		}
+		p = e + 1
+	}
+	return raw
+}
+
+// isARCHeader returns true if the given header field name is one of the ARC header fields
+func isARCHeader(n string) bool {
+	return strings.EqualFold(n, headerAAR) || strings.EqualFold(n, headerAMS) || strings.EqualFold(n, headerAS)
+}
@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import "testing"
+
+func TestStripSignature(t *testing.T) {
+	tests := []struct {
+		raw string
+		ex  string
+	}{
+		{"ARC-Seal: i=1; a=rsa-sha256; b=abc\r\n def\r\n", "ARC-Seal: i=1; a=rsa-sha256; b=\r\n"},
+		{"X: i=1; b=abc; bh=def; d=x\r\n", "X: i=1; b=; bh=def; d=x\r\n"},
+		{"X: i=1; bh=def\r\n", "X: i=1; bh=def\r\n"},
+	}
+	for _, tt := range tests {
+		if s := stripSignature(tt.raw); s != tt.ex {
+			t.Errorf("stripSignature failed. Expected: %q, got: %q", tt.ex, s)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package arc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail-middleware/dkim"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+)
+
+const (
+	// maxInstances is the maximum number of ARC sets of a mail
+	// See: https://www.rfc-editor.org/rfc/rfc8617.html#section-4.2.1
+	maxInstances = 50
+	// algoRSA is the signing algorithm for RSA keys
+	algoRSA = "rsa-sha256"
+	// algoEd25519 is the signing algorithm for Ed25519 keys
+	algoEd25519 = "ed25519-sha256"
+)
+
+// Chain validation status values of the "cv=" tag of the ARC-Seal
+// See: https://www.rfc-editor.org/rfc/rfc8617.html#section-4.4
+const (
+	cvNone = "none"
+	cvPass = "pass"
+	cvFail = "fail"
+)
+
+// bodyHashes are the SHA-256 body hashes of a mail for both canonicalizations
+type bodyHashes map[msgauth.Canonicalization][]byte
+
+// arcSet is a single ARC set of a mail, consisting of the three ARC header fields with
+// the same instance number
+type arcSet struct {
+	aar mailauth.HeaderField
+	ams mailauth.HeaderField
+	as  mailauth.HeaderField
+}
+
+// seal validates the ARC chain of the given mail header fields and body hashes and
+// returns a new ARC set that continues the chain
+func (a Middleware) seal(hl []mailauth.HeaderField, bhs bodyHashes) (*arcSet, error) {
+	chain, n, err := parseChain(hl)
+	if n >= maxInstances {
+		return nil, ErrTooManyInstances
+	}
+	cv := cvNone
+	switch {
+	case err != nil:
+		cv = cvFail
+	case n > 0:
+		if parseTags(chain[n-1].as.Value())["cv"] == cvFail {
+			return nil, ErrChainFailed
+		}
+		cv = cvPass
+		if err = validateChain(chain, hl, bhs, a.config.Lookup); err != nil {
+			cv = cvFail
+		}
+	}
+
+	i := "i=" + strconv.Itoa(n+1)
+	ts := "t=" + strconv.FormatInt(a.config.now().Unix(), 10)
+	algo := "a=" + a.algorithm()
+	set := &arcSet{}
+
+	res := authResults(hl, a.config.AuthServID)
+	if n > 0 {
+		res = append(res, "arc="+cv)
+	}
+	if len(res) == 0 {
+		res = append(res, "none")
+	}
+	aar := mailauth.FoldTags(len(headerAAR), append([]string{i, a.config.AuthServID}, res...)...)
+	set.aar = mailauth.NewHeaderField(headerAAR, aar)
+
+	hn := a.config.HeaderFields
+	if len(hn) == 0 {
+		for _, h := range hl {
+			if !isARCHeader(h.Name) {
+				hn = append(hn, h.Name)
+			}
+		}
+	}
+	ams := mailauth.FoldTags(len(headerAMS), i, algo,
+		fmt.Sprintf("c=%s/%s", a.config.CanonicalizationHeader, a.config.CanonicalizationBody),
+		"d="+a.config.Domain, "s="+a.config.Selector, ts, "h="+strings.Join(hn, ":"),
+		"bh="+base64.StdEncoding.EncodeToString(bhs[a.config.CanonicalizationBody]), "b=")
+	set.ams = mailauth.NewHeaderField(headerAMS, ams)
+	sig, err := a.sign(amsData(hl, hn, set.ams, a.config.CanonicalizationHeader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ARC-Message-Signature: %w", err)
+	}
+	ams += mailauth.FoldValue(sig, mailauth.LastLineLength(headerAMS+": "+ams))
+	set.ams = mailauth.NewHeaderField(headerAMS, ams)
+
+	as := mailauth.FoldTags(len(headerAS), i, algo, ts, "cv="+cv, "d="+a.config.Domain, "s="+a.config.Selector, "b=")
+	set.as = mailauth.NewHeaderField(headerAS, as)
+	sig, err = a.sign(sealData(append(chain, *set)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ARC-Seal: %w", err)
+	}
+	as += mailauth.FoldValue(sig, mailauth.LastLineLength(headerAS+": "+as))
+	set.as = mailauth.NewHeaderField(headerAS, as)
+
+	return set, nil
+}
+
+// algorithm returns the signing algorithm for the crypto.Signer of the Middleware
+func (a Middleware) algorithm() string {
+	if _, ok := a.signer.Public().(ed25519.PublicKey); ok {
+		return algoEd25519
+	}
+	return algoRSA
+}
+
+// sign returns the base64 encoded signature of the SHA-256 hash of the given data
+func (a Middleware) sign(d string) (string, error) {
+	h := sha256.Sum256([]byte(d))
+	var so crypto.SignerOpts = crypto.SHA256
+	if a.algorithm() == algoEd25519 {
+		so = crypto.Hash(0)
+	}
+	s, err := a.signer.Sign(rand.Reader, h[:], so)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s), nil
+}
+
+// parseChain returns the ARC sets of the given mail header fields, ordered by their
+// instance number, and the highest instance number. If the ARC header fields do not
+// form a structurally valid chain, an error is returned
+// See: https://www.rfc-editor.org/rfc/rfc8617.html#section-5.2
+func parseChain(hl []mailauth.HeaderField) ([]arcSet, int, error) {
+	sets := make(map[int]*arcSet)
+	seen := make(map[string]bool)
+	n := 0
+	var err error
+	for _, h := range hl {
+		if !isARCHeader(h.Name) {
+			continue
+		}
+		i := instance(h.Value())
+		if i == 0 {
+			err = fmt.Errorf("invalid instance number in %s header field", h.Name)
+			continue
+		}
+		k := strings.ToLower(h.Name) + strconv.Itoa(i)
+		if seen[k] {
+			err = fmt.Errorf("duplicate %s header field for instance %d", h.Name, i)
+			continue
+		}
+		seen[k] = true
+		if sets[i] == nil {
+			sets[i] = &arcSet{}
+		}
+		switch {
+		case strings.EqualFold(h.Name, headerAAR):
+			sets[i].aar = h
+		case strings.EqualFold(h.Name, headerAMS):
+			sets[i].ams = h
+		default:
+			sets[i].as = h
+		}
+		n = max(n, i)
+	}
+
+	chain := make([]arcSet, 0, n)
+	for i := 1; i <= n; i++ {
+		s := sets[i]
+		if s == nil || s.aar.Raw == "" || s.ams.Raw == "" || s.as.Raw == "" {
+			return nil, n, fmt.Errorf("incomplete ARC set for instance %d", i)
+		}
+		chain = append(chain, *s)
+	}
+	return chain, n, err
+}
+
+// validateChain validates the given ARC chain. The ARC-Message-Signature of the most
+// recent ARC set and all ARC-Seals are verified
+// See: https://www.rfc-editor.org/rfc/rfc8617.html#section-5.2
+func validateChain(chain []arcSet, hl []mailauth.HeaderField, bhs bodyHashes, lookup dkim.TXTLookupFunc) error {
+	for i, s := range chain {
+		cv := parseTags(s.as.Value())["cv"]
+		if (i == 0 && cv != cvNone) || (i > 0 && cv != cvPass) {
+			return fmt.Errorf("invalid chain validation status %q for instance %d", cv, i+1)
+		}
+	}
+
+	ams := chain[len(chain)-1].ams
+	tags := parseTags(ams.Value())
+	bh, err := base64.StdEncoding.DecodeString(tags["bh"])
+	if err != nil {
+		return fmt.Errorf("failed to decode body hash: %w", err)
+	}
+	hc, bc, err := parseCanonicalization(tags["c"])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bh, bhs[bc]) {
+		return errors.New("body hash of ARC-Message-Signature did not verify")
+	}
+	if err = verify(tags, amsData(hl, strings.Split(tags["h"], ":"), ams, hc), lookup); err != nil {
+		return fmt.Errorf("ARC-Message-Signature did not verify: %w", err)
+	}
+
+	for i := len(chain); i > 0; i-- {
+		if err = verify(parseTags(chain[i-1].as.Value()), sealData(chain[:i]), lookup); err != nil {
+			return fmt.Errorf("ARC-Seal of instance %d did not verify: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// verify verifies the signature of the given ARC-Message-Signature or ARC-Seal tags over
+// the given data with the public key published for the signing domain and selector
+func verify(tags map[string]string, d string, lookup dkim.TXTLookupFunc) error {
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	pk, err := dkim.LookupPublicKey(lookup, tags["d"], tags["s"])
+	if err != nil {
+		return err
+	}
+	h := sha256.Sum256([]byte(d))
+	switch k := pk.(type) {
+	case *rsa.PublicKey:
+		if tags["a"] != algoRSA {
+			return fmt.Errorf("signing algorithm %q does not match RSA key", tags["a"])
+		}
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig)
+	case ed25519.PublicKey:
+		if tags["a"] != algoEd25519 {
+			return fmt.Errorf("signing algorithm %q does not match Ed25519 key", tags["a"])
+		}
+		if !ed25519.Verify(k, h[:], sig) {
+			return errors.New("invalid Ed25519 signature")
+		}
+		return nil
+	default:
+		return ErrUnsupportedKey
+	}
+}
+
+// amsData returns the data that is signed by the given ARC-Message-Signature. The header
+// fields with the given names are selected from the bottom of the header upwards
+// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-5.4.2
+func amsData(hl []mailauth.HeaderField, names []string, ams mailauth.HeaderField,
+	c msgauth.Canonicalization,
+) string {
+	var sb strings.Builder
+	used := make(map[int]bool)
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		for i := len(hl) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(hl[i].Name, n) {
+				sb.WriteString(mailauth.CanonicalHeader(hl[i], c))
+				used[i] = true
+				break
+			}
+		}
+	}
+	sb.WriteString(mailauth.CanonicalHeader(mailauth.HeaderField{Name: ams.Name, Raw: stripSignature(ams.Raw)}, c))
+	return strings.TrimSuffix(sb.String(), crlf)
+}
+
+// sealData returns the data that is signed by the ARC-Seal of the last ARC set of the
+// given chain. It consists of all ARC header fields of the chain in the order of their
+// instance numbers
+// See: https://www.rfc-editor.org/rfc/rfc8617.html#section-5.1.1
+func sealData(chain []arcSet) string {
+	var sb strings.Builder
+	for i, s := range chain {
+		as := s.as
+		if i == len(chain)-1 {
+			as.Raw = stripSignature(as.Raw)
+		}
+		for _, h := range []mailauth.HeaderField{s.aar, s.ams, as} {
+			sb.WriteString(mailauth.CanonicalHeader(h, msgauth.CanonicalizationRelaxed))
+		}
+	}
+	return strings.TrimSuffix(sb.String(), crlf)
+}
+
+// authResults returns the results of all Authentication-Results header fields of the
+// given header fields that were added by the given authserv-id
+func authResults(hl []mailauth.HeaderField, id string) []string {
+	var res []string
+	for _, h := range hl {
+		if !strings.EqualFold(h.Name, headerAR) {
+			continue
+		}
+		sid, rl, ok := strings.Cut(h.Value(), ";")
+		if f := strings.Fields(sid); !ok || len(f) == 0 || !strings.EqualFold(f[0], id) {
+			continue
+		}
+		for _, r := range strings.Split(rl, ";") {
+			if r = normalize(r); r != "" && r != "none" {
+				res = append(res, r)
+			}
+		}
+	}
+	return res
+}
+
+// parseCanonicalization parses the "c=" tag value of an ARC-Message-Signature
+func parseCanonicalization(c string) (msgauth.Canonicalization, msgauth.Canonicalization, error) {
+	hc, bc, ok := strings.Cut(c, "/")
+	if !ok {
+		bc = string(msgauth.CanonicalizationSimple)
+	}
+	if hc == "" {
+		hc = string(msgauth.CanonicalizationSimple)
+	}
+	for _, cc := range []string{hc, bc} {
+		if cc != string(msgauth.CanonicalizationSimple) && cc != string(msgauth.CanonicalizationRelaxed) {
+			return "", "", fmt.Errorf("%s: %w", cc, dkim.ErrInvalidCanonicalization)
+		}
+	}
+	return msgauth.Canonicalization(hc), msgauth.Canonicalization(bc), nil
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package autocrypt implements a go-mail middleware that adds an Autocrypt header to
+// outgoing mails, following the Autocrypt Level 1 specification
+//
+// See: https://autocrypt.org/level1.html
+package autocrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	pgp "github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/wneessen/go-mail"
+)
+
+const (
+	// Type is the type of Middleware
+	Type mail.MiddlewareType = "autocrypt"
+	// Version is the version number of the Middleware
+	Version = "0.0.1"
+	// HeaderAutocrypt is the Autocrypt mail header field
+	HeaderAutocrypt mail.Header = "Autocrypt"
+)
+
+// foldLength is the maximum length of a keydata line in the folded Autocrypt header
+const foldLength = 76
+
+var (
+	// ErrNoFrom should be returned if the mail.Msg has no From address
+	ErrNoFrom = errors.New("mail message has no From address")
+	// ErrAddrMismatch should be returned if the From address of the mail.Msg does not
+	// match any identity of the public key
+	ErrAddrMismatch = errors.New("From address does not match any identity of the public key")
+)
+
+// Middleware is the middleware struct for the Autocrypt middleware
+type Middleware struct {
+	config *Config
+}
+
+// NewMiddleware returns a new Middleware from a given Config.
+// The returned Middleware satisfies the mail.Middleware interface
+func NewMiddleware(c *Config) *Middleware {
+	return &Middleware{config: c}
+}
+
+// Handle is the handler method that satisfies the mail.Middleware interface
+func (m *Middleware) Handle(msg *mail.Msg) *mail.Msg {
+	h, err := m.header(msg)
+	if err != nil {
+		m.config.Logger.Errorf("failed to create Autocrypt header: %s. sending mail without Autocrypt header", err)
+		return msg
+	}
+	msg.SetGenHeaderPreformatted(HeaderAutocrypt, h)
+	return msg
+}
+
+// Type returns the MiddlewareType for this Middleware
+func (m *Middleware) Type() mail.MiddlewareType {
+	return Type
+}
+
+// header returns the value of the Autocrypt header for the given mail.Msg. The keydata
+// attribute is folded, so that it can be used as preformatted header value
+func (m *Middleware) header(msg *mail.Msg) (string, error) {
+	fl := msg.GetFrom()
+	if len(fl) == 0 {
+		return "", ErrNoFrom
+	}
+	addr := strings.ToLower(fl[0].Address)
+	if !m.config.addrs[addr] {
+		return "", fmt.Errorf("%s: %w", addr, ErrAddrMismatch)
+	}
+	kd, err := m.keyData(addr)
+	if err != nil {
+		return "", err
+	}
+
+	h := strings.Builder{}
+	h.WriteString("addr=" + addr + ";")
+	if m.config.PreferEncrypt == PreferEncryptMutual {
+		h.WriteString(" prefer-encrypt=" + m.config.PreferEncrypt.String() + ";")
+	}
+	h.WriteString(" keydata=")
+	for len(kd) > foldLength {
+		h.WriteString(mail.SingleNewLine + " " + kd[:foldLength])
+		kd = kd[foldLength:]
+	}
+	h.WriteString(mail.SingleNewLine + " " + kd)
+	return h.String(), nil
+}
+
+// keyData returns the base64 encoded keydata for the given address. Following the
+// Autocrypt recommendation, the key is minimized to the primary key, the subkeys and
+// the identity matching the given address
+func (m *Middleware) keyData(addr string) (string, error) {
+	e := *m.config.key.GetEntity()
+	e.Identities = make(map[string]*pgp.Identity)
+	for n, id := range m.config.key.GetEntity().Identities {
+		if id.UserId != nil && strings.EqualFold(id.UserId.Email, addr) {
+			e.Identities[n] = id
+			break
+		}
+	}
+	buf := bytes.Buffer{}
+	if err := e.Serialize(&buf); err != nil {
+		return "", fmt.Errorf("failed to serialize public key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
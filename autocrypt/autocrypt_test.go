@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package autocrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	netmail "net/mail"
+	"strings"
+	"testing"
+
+	pgp "github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/wneessen/go-mail"
+)
+
+// parseHeader parses the attributes of the given Autocrypt header value
+func parseHeader(t *testing.T, h string) map[string]string {
+	t.Helper()
+	attrs := make(map[string]string)
+	for _, a := range strings.Split(h, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(a), "=")
+		if !ok {
+			t.Fatalf("invalid Autocrypt attribute: %q", a)
+		}
+		attrs[k] = v
+	}
+	return attrs
+}
+
+func TestMiddleware_Handle(t *testing.T) {
+	tests := []struct {
+		n string
+		p PreferEncrypt
+	}{
+		{"nopreference", PreferEncryptNoPreference},
+		{"mutual", PreferEncryptMutual},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			mw := NewMiddleware(testConfig(t, "toni.sender@example.com", WithPreferEncrypt(tt.p)))
+			m := mail.NewMsg(mail.WithMiddleware(mw))
+			if err := m.FromFormat("Toni Sender", "Toni.Sender@example.com"); err != nil {
+				t.Fatalf("failed to set From address: %s", err)
+			}
+			m.Subject("This is a subject")
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+			buf := bytes.Buffer{}
+			if _, err := m.WriteTo(&buf); err != nil {
+				t.Fatalf("failed writing message to memory: %s", err)
+			}
+			pm, err := netmail.ReadMessage(&buf)
+			if err != nil {
+				t.Fatalf("failed to parse mail message: %s", err)
+			}
+			h := pm.Header.Get(string(HeaderAutocrypt))
+			if h == "" {
+				t.Fatalf("Handle failed. Autocrypt header not found")
+			}
+			attrs := parseHeader(t, h)
+			if attrs["addr"] != "toni.sender@example.com" {
+				t.Errorf("Handle failed. Expected addr %q, got: %q", "toni.sender@example.com", attrs["addr"])
+			}
+			pe, ok := attrs["prefer-encrypt"]
+			if tt.p == PreferEncryptMutual && pe != "mutual" {
+				t.Errorf("Handle failed. Expected prefer-encrypt %q, got: %q", "mutual", pe)
+			}
+			if tt.p == PreferEncryptNoPreference && ok {
+				t.Errorf("Handle failed. prefer-encrypt attribute was supposed to be omitted")
+			}
+			kd, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(attrs["keydata"]), ""))
+			if err != nil {
+				t.Fatalf("failed to decode keydata: %s", err)
+			}
+			el, err := pgp.ReadKeyRing(bytes.NewReader(kd))
+			if err != nil {
+				t.Fatalf("failed to read keydata: %s", err)
+			}
+			if len(el) != 1 || len(el[0].Identities) != 1 || len(el[0].Subkeys) != 1 {
+				t.Fatalf("Handle failed. Unexpected keydata content")
+			}
+			if el[0].PrivateKey != nil {
+				t.Errorf("Handle failed. keydata must not contain private key material")
+			}
+			for _, id := range el[0].Identities {
+				if id.UserId.Email != "toni.sender@example.com" {
+					t.Errorf("Handle failed. Unexpected key identity: %q", id.UserId.Email)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_fromMismatch(t *testing.T) {
+	mw := NewMiddleware(testConfig(t, "toni.sender@example.com"))
+	m := mail.NewMsg()
+	if err := m.From("tina.sender@example.com"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m = mw.Handle(m)
+	if len(m.GetGenHeader(HeaderAutocrypt)) != 0 {
+		t.Errorf("Handle with mismatching From address failed. Autocrypt header was not supposed to be set")
+	}
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	if strings.Contains(buf.String(), string(HeaderAutocrypt)+":") {
+		t.Errorf("Handle with mismatching From address failed. Autocrypt header was not supposed to be set")
+	}
+	if _, err := mw.header(mail.NewMsg()); err == nil {
+		t.Errorf("header without From address was supposed to fail, but didn't")
+	}
+}
+
+func TestMiddleware_Type(t *testing.T) {
+	mw := NewMiddleware(testConfig(t, "toni.sender@example.com"))
+	if mw.Type() != Type {
+		t.Errorf("Type() failed. Expected: %s, got: %s", Type, mw.Type())
+	}
+}
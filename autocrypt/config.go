@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package autocrypt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/wneessen/go-mail-middleware/log"
+	"github.com/wneessen/go-mail-middleware/openpgp"
+)
+
+// PreferEncrypt is an alias type for an int
+type PreferEncrypt int
+
+const (
+	// PreferEncryptNoPreference represents the "nopreference" encryption preference. It is
+	// the default and omits the prefer-encrypt attribute in the Autocrypt header
+	PreferEncryptNoPreference PreferEncrypt = iota
+	// PreferEncryptMutual represents the "mutual" encryption preference
+	PreferEncryptMutual
+)
+
+// ErrNoKeyIdentity should be returned if the public key does not carry any identity
+// with a mail address
+var ErrNoKeyIdentity = errors.New("public key has no identity with a mail address")
+
+// Config is the configuration to use in Middleware creation
+type Config struct {
+	// Logger represents a log that satisfies the log.Logger interface
+	Logger *log.Logger
+	// PreferEncrypt represents the encryption preference of the sender
+	PreferEncrypt PreferEncrypt
+
+	// key is the parsed OpenPGP public key of the sender
+	key *crypto.Key
+	// addrs holds the (lower-case) mail addresses of the identities of the key
+	addrs map[string]bool
+}
+
+// Option returns a function that can be used for grouping Config options
+type Option func(cfg *Config)
+
+// NewConfig returns a new Config from the given openpgp.Config. The PublicKey of the
+// openpgp.Config is used as the sender's key for the Autocrypt header. This allows to use
+// the openpgp.NewConfigFrom*() helper methods to load the key
+func NewConfig(pc *openpgp.Config, o ...Option) (*Config, error) {
+	if pc == nil || pc.PublicKey == "" {
+		return nil, fmt.Errorf("autocrypt requires a public key: %w", openpgp.ErrNoPubKey)
+	}
+	k, err := crypto.NewKeyFromArmored(pc.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	kr, err := crypto.NewKeyRing(k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keyring: %w", err)
+	}
+	c := &Config{key: k, addrs: make(map[string]bool)}
+	for _, id := range kr.GetIdentities() {
+		if id.Email != "" {
+			c.addrs[strings.ToLower(id.Email)] = true
+		}
+	}
+	if len(c.addrs) == 0 {
+		return nil, fmt.Errorf("%s: %w", k.GetFingerprint(), ErrNoKeyIdentity)
+	}
+
+	// Override defaults with optionally provided Option functions
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		co(c)
+	}
+
+	// Create a log.Logger if none was provided
+	if c.Logger == nil {
+		c.Logger = log.New(os.Stderr, "autocrypt", log.LevelWarn)
+	}
+
+	return c, nil
+}
+
+// WithLogger sets a log.Logger for the Config
+func WithLogger(l *log.Logger) Option {
+	return func(c *Config) {
+		c.Logger = l
+	}
+}
+
+// WithPreferEncrypt sets the PreferEncrypt for the Config
+func WithPreferEncrypt(p PreferEncrypt) Option {
+	return func(c *Config) {
+		c.PreferEncrypt = p
+	}
+}
+
+// String satisfies the fmt.Stringer interface for the PreferEncrypt type
+func (p PreferEncrypt) String() string {
+	switch p {
+	case PreferEncryptNoPreference:
+		return "nopreference"
+	case PreferEncryptMutual:
+		return "mutual"
+	default:
+		return "unknown"
+	}
+}
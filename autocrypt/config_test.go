@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package autocrypt
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+	"github.com/wneessen/go-mail-middleware/log"
+	"github.com/wneessen/go-mail-middleware/openpgp"
+)
+
+// testPubKey generates a new OpenPGP key pair for the given mail address and returns
+// the armored public key
+func testPubKey(t *testing.T, a string) string {
+	t.Helper()
+	pr, err := helper.GenerateKey("go-mail-middleware", a, []byte("go-mail-middleware"), "x25519", 0)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %s", err)
+	}
+	k, err := crypto.NewKeyFromArmored(pr)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %s", err)
+	}
+	pu, err := k.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatalf("failed to get public key: %s", err)
+	}
+	return pu
+}
+
+// testConfig returns a new Config for a generated public key of the given mail address
+func testConfig(t *testing.T, a string, o ...Option) *Config {
+	t.Helper()
+	pc, err := openpgp.NewConfig("", testPubKey(t, a))
+	if err != nil {
+		t.Fatalf("failed to create openpgp config: %s", err)
+	}
+	c, err := NewConfig(pc, o...)
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	return c
+}
+
+func TestNewConfig(t *testing.T) {
+	c := testConfig(t, "Toni.Sender@Example.com")
+	if !c.addrs["toni.sender@example.com"] {
+		t.Errorf("NewConfig failed. Expected key identity address, got: %v", c.addrs)
+	}
+	if c.PreferEncrypt != PreferEncryptNoPreference {
+		t.Errorf("NewConfig failed. Expected default PreferEncrypt %s, got: %s", PreferEncryptNoPreference,
+			c.PreferEncrypt)
+	}
+	if c.Logger == nil {
+		t.Errorf("NewConfig failed. Expected default logger")
+	}
+}
+
+func TestNewConfig_WithOptions(t *testing.T) {
+	l := log.New(os.Stderr, "autocrypt-custom", log.LevelDebug)
+	c := testConfig(t, "toni.sender@example.com", WithPreferEncrypt(PreferEncryptMutual), WithLogger(l), nil)
+	if c.PreferEncrypt != PreferEncryptMutual {
+		t.Errorf("NewConfig_WithPreferEncrypt failed. Expected: %s, got: %s", PreferEncryptMutual, c.PreferEncrypt)
+	}
+	if c.Logger != l {
+		t.Errorf("NewConfig_WithLogger failed. Expected custom logger")
+	}
+}
+
+func TestNewConfig_fails(t *testing.T) {
+	if _, err := NewConfig(nil); !errors.Is(err, openpgp.ErrNoPubKey) {
+		t.Errorf("NewConfig without openpgp config was supposed to fail with ErrNoPubKey, got: %s", err)
+	}
+	if _, err := NewConfig(&openpgp.Config{PublicKey: "invalid"}); err == nil {
+		t.Errorf("NewConfig with invalid public key was supposed to fail, but didn't")
+	}
+	pu := testPubKey(t, "")
+	if _, err := NewConfig(&openpgp.Config{PublicKey: pu}); !errors.Is(err, ErrNoKeyIdentity) {
+		t.Errorf("NewConfig without key identity was supposed to fail with ErrNoKeyIdentity, got: %s", err)
+	}
+}
+
+func TestPreferEncrypt_String(t *testing.T) {
+	tests := []struct {
+		p PreferEncrypt
+		s string
+	}{
+		{PreferEncryptNoPreference, "nopreference"},
+		{PreferEncryptMutual, "mutual"},
+		{999, "unknown"},
+	}
+	for _, tt := range tests {
+		if tt.p.String() != tt.s {
+			t.Errorf("String() failed. Expected: %q, got: %q", tt.s, tt.p.String())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrKeyMismatch is returned by CheckConfig if the private key does not match the
+	// published public key
+	ErrKeyMismatch = errors.New("private key does not match the published public key")
+	// ErrKeyTypeMismatch is returned by CheckConfig if the type of the private key does not
+	// match the published key type
+	ErrKeyTypeMismatch = errors.New("private key type does not match the published key type")
+	// ErrHashAlgoMismatch is returned by CheckConfig if the hash algorithm of the
+	// SignerConfig is not accepted by the published key record
+	ErrHashAlgoMismatch = errors.New("hash algorithm is not accepted by the published key record")
+	// ErrServiceMismatch is returned by CheckConfig if the published key record is not
+	// valid for the email service
+	ErrServiceMismatch = errors.New("published key record is not valid for email")
+	// ErrAUIDMismatch is returned by CheckConfig if the AUID of the SignerConfig is in a
+	// subdomain of the signing domain, but the published key record has the FlagStrict flag
+	ErrAUIDMismatch = errors.New("AUID of a subdomain is not accepted by the published key record")
+	// ErrKeyTesting is returned by CheckConfig if the published key record has the
+	// FlagTesting flag, so that verifiers treat signed mails like unsigned mails
+	ErrKeyTesting = errors.New("published key record is in testing mode")
+)
+
+// CheckConfig checks the given SignerConfig and crypto.Signer against the DKIM key record
+// published at "<selector>._domainkey.<domain>". The key record is looked up with the
+// given TXTLookupFunc, or with net.LookupTXT if it is nil.
+//
+// CheckConfig returns nil if mails signed with the given configuration will pass the
+// verification. Otherwise, all found problems are returned joined in one error, so that
+// each of them can be checked with errors.Is: ErrKeyRevoked, ErrKeyTypeMismatch,
+// ErrKeyMismatch, ErrHashAlgoMismatch, ErrServiceMismatch, ErrAUIDMismatch and
+// ErrKeyTesting. Errors of the lookup or of an invalid key record are returned as is
+func CheckConfig(sc *SignerConfig, cs crypto.Signer, lookup TXTLookupFunc) error {
+	so, err := signOptions(sc, cs)
+	if err != nil {
+		return err
+	}
+	return checkSignOptions(so, lookup)
+}
+
+// Check checks the signers of the Middleware against their published DKIM key records
+// with CheckConfig. If the Middleware has a Rotation, its active key is checked as well.
+// The signers of a SignerRegistry are not checked, since they depend on the sender domain
+// of the mail.Msg
+func (d *Middleware) Check(lookup TXTLookupFunc) error {
+	sol := d.so
+	if d.rotation != nil {
+		so, err := d.rotation.signOptions()
+		if err != nil {
+			return err
+		}
+		sol = append(sol[:len(sol):len(sol)], so)
+	}
+	var el []error
+	for _, so := range sol {
+		if err := checkSignOptions(so, lookup); err != nil {
+			el = append(el, fmt.Errorf("selector %q of domain %q: %w", so.Selector, so.Domain, err))
+		}
+	}
+	return errors.Join(el...)
+}
+
+// checkSignOptions checks the given signerOptions against the published DKIM key
+// record. See CheckConfig for details
+func checkSignOptions(so *signerOptions, lookup TXTLookupFunc) error {
+	r, err := LookupKeyRecord(lookup, so.Domain, so.Selector)
+	if err != nil {
+		return err
+	}
+
+	var el []error
+	pk := so.Signer.Public()
+	kr := &KeyRecord{PublicKey: pk}
+	switch {
+	case r.PublicKey == nil:
+		el = append(el, ErrKeyRevoked)
+	case kr.KeyType() != r.KeyType():
+		el = append(el, fmt.Errorf("%s key, published %s key: %w", kr.KeyType(), r.KeyType(),
+			ErrKeyTypeMismatch))
+	default:
+		if ek, ok := pk.(interface{ Equal(crypto.PublicKey) bool }); !ok || !ek.Equal(r.PublicKey) {
+			el = append(el, ErrKeyMismatch)
+		}
+	}
+
+	if len(r.HashAlgos) > 0 && !slices.Contains(r.HashAlgos, so.hash()) {
+		el = append(el, fmt.Errorf("%s: %w", hashName(so.hash()), ErrHashAlgoMismatch))
+	}
+	if len(r.Services) > 0 && !serviceAccepted(r.Services) {
+		el = append(el, fmt.Errorf("s=%s: %w", strings.Join(r.Services, ":"), ErrServiceMismatch))
+	}
+	if _, ad, _ := strings.Cut(so.Identifier, "@"); ad != "" && !strings.EqualFold(ad, so.Domain) &&
+		r.HasFlag(FlagStrict) {
+		el = append(el, fmt.Errorf("%s: %w", ad, ErrAUIDMismatch))
+	}
+	if r.HasFlag(FlagTesting) {
+		el = append(el, ErrKeyTesting)
+	}
+	return errors.Join(el...)
+}
+
+// serviceAccepted returns true if the given list of service types of a DKIM key record
+// includes the email service
+func serviceAccepted(sl []string) bool {
+	for _, s := range sl {
+		if s == "*" || strings.EqualFold(s, ServiceEmail) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	ek, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	ok, _, err := GenerateRSAKey(MinRSAKeyBits)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %s", err)
+	}
+	rr := testKeyRecord(t, rk, "rsa")
+	er := testKeyRecord(t, ek, "ed25519")
+	sub, err := NewConfig(TestDomain, TestSelector, WithAUID("toni@news."+TestDomain))
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+
+	tests := []struct {
+		n  string
+		r  string
+		sc *SignerConfig
+		cs crypto.Signer
+		ex []error
+	}{
+		{"RSA key matches", rr, testRegistryConfig(t, TestDomain), rk, nil},
+		{"Ed25519 key matches", er, testRegistryConfig(t, TestDomain), ek, nil},
+		{"Record with all tags", strings.Replace(rr, "k=rsa;", "h=sha1:sha256; k=rsa; s=*; t=s;", 1),
+			testRegistryConfig(t, TestDomain), rk, nil},
+		{"Key mismatch", rr, testRegistryConfig(t, TestDomain), ok, []error{ErrKeyMismatch}},
+		{"Key type mismatch", rr, testRegistryConfig(t, TestDomain), ek, []error{ErrKeyTypeMismatch}},
+		{"Hash algorithm mismatch", strings.Replace(rr, "k=rsa;", "h=sha1; k=rsa;", 1),
+			testRegistryConfig(t, TestDomain), rk, []error{ErrHashAlgoMismatch}},
+		{"Service mismatch", strings.Replace(rr, "k=rsa;", "k=rsa; s=tlsrpt;", 1),
+			testRegistryConfig(t, TestDomain), rk, []error{ErrServiceMismatch}},
+		{"AUID of subdomain with strict flag", strings.Replace(rr, "k=rsa;", "k=rsa; t=s;", 1),
+			sub, rk, []error{ErrAUIDMismatch}},
+		{"AUID of subdomain", rr, sub, rk, nil},
+		{"Testing flag", strings.Replace(rr, "k=rsa;", "k=rsa; t=y;", 1),
+			testRegistryConfig(t, TestDomain), rk, []error{ErrKeyTesting}},
+		{"Revoked key", "v=DKIM1; k=rsa; p=", testRegistryConfig(t, TestDomain), rk,
+			[]error{ErrKeyRevoked}},
+		{"Multiple mismatches", "v=DKIM1; h=sha1; k=rsa; t=y; p=",
+			testRegistryConfig(t, TestDomain), rk, []error{ErrKeyRevoked, ErrHashAlgoMismatch, ErrKeyTesting}},
+		{"Invalid record", "v=DKIM1; k=dsa; p=AAAA", testRegistryConfig(t, TestDomain), rk,
+			[]error{ErrInvalidKeyRecord}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			lookup := NewMapLookup(map[string]string{
+				fmt.Sprintf("%s._domainkey.%s", TestSelector, TestDomain): tt.r,
+			})
+			err := CheckConfig(tt.sc, tt.cs, lookup)
+			if len(tt.ex) == 0 && err != nil {
+				t.Errorf("CheckConfig failed: %s", err)
+			}
+			for _, e := range tt.ex {
+				if !errors.Is(err, e) {
+					t.Errorf("CheckConfig was supposed to fail with %q, got: %v", e, err)
+				}
+			}
+		})
+	}
+
+	if err = CheckConfig(testRegistryConfig(t, TestDomain), rk, NewMapLookup(nil)); !errors.Is(err, ErrTXTNotFound) {
+		t.Errorf("CheckConfig without key record was supposed to fail with ErrTXTNotFound, got: %v", err)
+	}
+	if err = CheckConfig(nil, rk, NewMapLookup(nil)); !errors.Is(err, ErrNoConfig) {
+		t.Errorf("CheckConfig without config was supposed to fail with ErrNoConfig, got: %v", err)
+	}
+}
+
+func TestMiddleware_Check(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	ek, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	mw, err := NewFromSigner(rk, testRegistryConfig(t, TestDomain))
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	ec, err := NewConfig(TestDomain, "ed")
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	if err = mw.AddSigner(ec, ek); err != nil {
+		t.Fatalf("failed to add signer: %s", err)
+	}
+	lookup := NewMapLookup(map[string]string{
+		fmt.Sprintf("%s._domainkey.%s", TestSelector, TestDomain): testKeyRecord(t, rk, "rsa"),
+		fmt.Sprintf("ed._domainkey.%s", TestDomain):               testKeyRecord(t, ek, "ed25519"),
+	})
+	if err = mw.Check(lookup); err != nil {
+		t.Errorf("Check failed: %s", err)
+	}
+
+	lookup = NewMapLookup(map[string]string{
+		fmt.Sprintf("%s._domainkey.%s", TestSelector, TestDomain): testKeyRecord(t, rk, "rsa"),
+		fmt.Sprintf("ed._domainkey.%s", TestDomain):               "v=DKIM1; k=ed25519; p=",
+	})
+	err = mw.Check(lookup)
+	if !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("Check was supposed to fail with ErrKeyRevoked, got: %v", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), `selector "ed"`) {
+		t.Errorf("Check error was supposed to name the selector, got: %s", err)
+	}
+}
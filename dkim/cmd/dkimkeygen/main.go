@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Command dkimkeygen generates a DKIM key pair and prints the matching DNS TXT record.
+//
+// Usage:
+//
+//	dkimkeygen -domain example.com -selector mail [-type rsa|ed25519] [-bits 2048]
+//	           [-auid @example.com] [-testing] [-out mail.pem] [-force]
+//
+// The private key is written to the file given with -out (or "<selector>._domainkey.
+// <domain>.pem" by default, as expected by dkim.NewDirRegistry) and the DNS zone file
+// entry of the public key is printed to stdout. An existing key file is never replaced,
+// unless -force is given
+package main
+
+import (
+	"crypto"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wneessen/go-mail-middleware/dkim"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "dkimkeygen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the given command line arguments, generates the key pair and writes the
+// DNS zone file entry to w
+func run(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("dkimkeygen", flag.ContinueOnError)
+	domain := fs.String("domain", "", "signing domain (required)")
+	selector := fs.String("selector", "", "DKIM domain selector (required)")
+	keyType := fs.String("type", "rsa", "key type: rsa or ed25519")
+	bits := fs.Int("bits", dkim.DefaultRSAKeyBits, "size of RSA keys in bits")
+	auid := fs.String("auid", "", "agent or user identifier (AUID) of the signatures")
+	testing := fs.Bool("testing", false, "set the testing flag (t=y) of the key record")
+	out := fs.String("out", "", "output file of the private key")
+	force := fs.Bool("force", false, "overwrite an existing output file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *domain == "" || *selector == "" {
+		fs.Usage()
+		return errors.New("domain and selector are required")
+	}
+
+	sc, err := dkim.NewConfig(*domain, *selector, dkim.WithAUID(*auid))
+	if err != nil {
+		return err
+	}
+
+	var pub crypto.PublicKey
+	var pemKey []byte
+	switch *keyType {
+	case "rsa":
+		pk, p, err := dkim.GenerateRSAKey(*bits)
+		if err != nil {
+			return err
+		}
+		pub, pemKey = pk.Public(), p
+	case "ed25519":
+		pk, p, err := dkim.GenerateEd25519Key()
+		if err != nil {
+			return err
+		}
+		pub, pemKey = pk.Public(), p
+	default:
+		return fmt.Errorf("%s: %w", *keyType, dkim.ErrUnsupportedKey)
+	}
+
+	kr, err := dkim.NewKeyRecord(pub, sc)
+	if err != nil {
+		return err
+	}
+	if *testing {
+		kr.Flags = append(kr.Flags, dkim.FlagTesting)
+	}
+	if *out == "" {
+		*out = kr.Name() + ".pem"
+	}
+	if err = writeKey(*out, pemKey, *force); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	_, err = fmt.Fprintln(w, kr.ZoneEntry())
+	return err
+}
+
+// writeKey writes the PEM encoded private key to the file with the given name. The file
+// must not exist yet, unless force is set
+func writeKey(n string, k []byte, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(n, flags, 0o600)
+	if err != nil {
+		return err
+	}
+	// A replaced key file might have been readable by others
+	if err = f.Chmod(0o600); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err = f.Write(k); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-mail-middleware/dkim"
+)
+
+const (
+	TestDomain   = "test.tld"
+	TestSelector = "mail"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		n       string
+		args    []string
+		testing bool
+	}{
+		{"RSA", []string{"-bits", "1024"}, false},
+		{"Ed25519", []string{"-type", "ed25519"}, false},
+		{"Ed25519 with testing flag and AUID", []string{"-type", "ed25519", "-testing", "-auid", "@test.tld"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "key.pem")
+			buf := bytes.Buffer{}
+			args := append([]string{"-domain", TestDomain, "-selector", TestSelector, "-out", out}, tt.args...)
+			if err := run(args, &buf); err != nil {
+				t.Fatalf("run failed: %s", err)
+			}
+			fi, err := os.Stat(out)
+			if err != nil {
+				t.Fatalf("failed to stat private key file: %s", err)
+			}
+			if fi.Mode().Perm() != 0o600 {
+				t.Errorf("unexpected file mode of private key. Expected: %s, got: %s", os.FileMode(0o600),
+					fi.Mode().Perm())
+			}
+			ze := buf.String()
+			if !strings.HasPrefix(ze, TestSelector+"._domainkey."+TestDomain+". IN TXT ") {
+				t.Errorf("unexpected zone entry: %s", ze)
+			}
+			kr, err := dkim.ParseKeyRecord(testRecordValue(ze))
+			if err != nil {
+				t.Fatalf("failed to parse key record of zone entry: %s", err)
+			}
+			pub, ok := kr.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+			if !ok || !pub.Equal(testPublicKey(t, out)) {
+				t.Errorf("public key of zone entry does not match the private key: %s", ze)
+			}
+			if kr.HasFlag(dkim.FlagTesting) != tt.testing {
+				t.Errorf("unexpected testing flag of zone entry: %s", ze)
+			}
+		})
+	}
+}
+
+func TestRun_defaultOut(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := run([]string{"-domain", TestDomain, "-selector", TestSelector, "-type", "ed25519"},
+		&bytes.Buffer{}); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if _, err := os.Stat(TestSelector + "._domainkey." + TestDomain + ".pem"); err != nil {
+		t.Errorf("private key was not written to the default output file: %s", err)
+	}
+}
+
+func TestRun_noOverwrite(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(out, []byte("existing key"), 0o644); err != nil {
+		t.Fatalf("failed to write existing key file: %s", err)
+	}
+	args := []string{"-domain", TestDomain, "-selector", TestSelector, "-type", "ed25519", "-out", out}
+	buf := bytes.Buffer{}
+	if err := run(args, &buf); !errors.Is(err, os.ErrExist) {
+		t.Errorf("run was supposed to fail with os.ErrExist, got: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("zone entry was not supposed to be printed, got: %s", buf.String())
+	}
+	if k, _ := os.ReadFile(out); string(k) != "existing key" {
+		t.Errorf("existing key file was not supposed to be overwritten")
+	}
+
+	if err := run(append(args, "-force"), &buf); err != nil {
+		t.Fatalf("run with -force failed: %s", err)
+	}
+	testPublicKey(t, out)
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatalf("failed to stat private key file: %s", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected file mode of overwritten private key. Expected: %s, got: %s", os.FileMode(0o600),
+			fi.Mode().Perm())
+	}
+}
+
+func TestRun_fails(t *testing.T) {
+	tests := []struct {
+		n    string
+		args []string
+		ex   error
+	}{
+		{"missing domain", []string{"-selector", TestSelector}, nil},
+		{"missing selector", []string{"-domain", TestDomain}, nil},
+		{"unknown flag", []string{"-domain", TestDomain, "-selector", TestSelector, "-unknown"}, nil},
+		{
+			"unsupported key type", []string{"-domain", TestDomain, "-selector", TestSelector, "-type", "dsa"},
+			dkim.ErrUnsupportedKey,
+		},
+		{
+			"RSA key too short", []string{"-domain", TestDomain, "-selector", TestSelector, "-bits", "512"},
+			dkim.ErrKeyTooShort,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "key.pem")
+			err := run(append(tt.args, "-out", out), &bytes.Buffer{})
+			if err == nil {
+				t.Fatal("run was supposed to fail")
+			}
+			if tt.ex != nil && !errors.Is(err, tt.ex) {
+				t.Errorf("run was supposed to fail with %s, got: %s", tt.ex, err)
+			}
+			if _, err = os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("private key file was not supposed to be written")
+			}
+		})
+	}
+}
+
+// testRecordValue returns the joined character strings of the given zone file entry
+func testRecordValue(ze string) string {
+	var sb strings.Builder
+	for i, s := range strings.Split(ze, `"`) {
+		if i%2 == 1 {
+			sb.WriteString(s)
+		}
+	}
+	return sb.String()
+}
+
+// testPublicKey parses the private key in the given file and returns its public key
+func testPublicKey(t *testing.T, n string) crypto.PublicKey {
+	t.Helper()
+	k, err := os.ReadFile(n)
+	if err != nil {
+		t.Fatalf("failed to read private key file: %s", err)
+	}
+	if rk, err := dkim.ParseRSAKey(k); err == nil {
+		return rk.Public()
+	}
+	ek, err := dkim.ParseEd25519Key(k)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %s", err)
+	}
+	return ek.Public()
+}
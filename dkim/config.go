@@ -6,6 +6,7 @@ package dkim
 
 import (
 	"crypto"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -54,6 +55,36 @@ type SignerConfig struct {
 	// See also: canonicalization.go#L7
 	CanonicalizationBody dkim.Canonicalization
 
+	// BodyLength is an optional limit of the body length that is covered by the signature.
+	// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-3.5
+	//
+	// If BodyLength is greater than 0, only the first BodyLength bytes of the canonicalized
+	// body are signed. If BodyLength is BodyLengthAll, the complete body is signed, but the
+	// "l=" tag is set to the length of the canonicalized body at signing time. In both
+	// cases, content appended to the body after signing (e.g. a footer added by a mailing
+	// list) does not break the signature.
+	//
+	// SECURITY WARNING: The part of the body beyond the "l=" length is not protected by the
+	// signature. An attacker can append arbitrary content to a signed mail, which is
+	// displayed to the recipient as if it had been signed, and with MIME messages even
+	// replace the visible content. Many verifiers ignore or reject signatures with an "l="
+	// tag, including the Verify function of this package. Use it only if you know that the
+	// mails pass through systems that modify the body.
+	// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-8.2
+	//
+	// If BodyLength is 0, the complete body is signed without an "l=" tag. This is the
+	// default and recommended setting
+	BodyLength int64
+
+	// Clock is an optional function that returns the current time. It provides the
+	// signing time of the "t=" tag and the time the Expiration is validated against
+	// by NewConfig, after all SignerOptions have been applied.
+	// Setting a fixed time makes the signatures reproducible, e.g. for golden file
+	// tests.
+	//
+	// If Clock is nil, time.Now is used
+	Clock func() time.Time
+
 	// Domain represents the DKIM Signing Domain Identifier (SDID)
 	// See: https://datatracker.ietf.org/doc/html/rfc6376#section-2.5
 	//
@@ -76,6 +107,16 @@ type SignerConfig struct {
 	// of the "t=" tag if both are present.
 	Expiration time.Time
 
+	// Lifetime is an optional relative lifetime of the signature. If set, the expiration
+	// time of the "x=" tag is calculated at each signing as signing time plus Lifetime,
+	// so that long-running services do not create signatures that have already expired.
+	// If both, Expiration and Lifetime are set, the earlier expiration time is used.
+	// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-3.5
+	//
+	// Lifetime must be at least one second, since the signature timestamps have a
+	// resolution of seconds. A Lifetime of 0 disables the relative lifetime
+	Lifetime time.Duration
+
 	// HashAlgo represents the DKIM Hash Algorithms
 	// See: https://datatracker.ietf.org/doc/html/rfc6376#section-7.7
 	//
@@ -87,7 +128,8 @@ type SignerConfig struct {
 	HashAlgo crypto.Hash
 
 	// HeaderFields is an optional list of header fields that should be used in
-	// the signature. If the list is empty, all header fields will be used.
+	// the signature. If the list is empty, all header fields except for existing
+	// DKIM-Signature header fields will be used.
 	//
 	// If a list of headers is given via the HeaderFields slice, the FROM header
 	// is always required.
@@ -96,6 +138,16 @@ type SignerConfig struct {
 	// https://www.rfc-editor.org/rfc/rfc6376.html#section-5.4.1
 	HeaderFields []string
 
+	// OversignHeaders is an optional list of header fields that are oversigned. Each of
+	// these header fields is listed once more in the "h=" tag of the signature than it
+	// occurs in the mail.Msg, so that the signature does not verify anymore if another
+	// instance of the header field is added after signing. Header fields that do not occur
+	// in the mail.Msg are listed once, which prevents them from being added at all.
+	// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-8.15
+	//
+	// If the list is empty, no header fields are oversigned
+	OversignHeaders []string
+
 	// Selector represents the DKIM domain selectors
 	// See: https://datatracker.ietf.org/doc/html/rfc6376#section-3.1
 	//
@@ -110,6 +162,20 @@ type SignerConfig struct {
 	Selector string
 }
 
+// BodyLengthAll is the SignerConfig.BodyLength that signs the complete body with an "l="
+// tag of the body length at signing time
+const BodyLengthAll int64 = -1
+
+// ErrInvalidLifetime is returned if a signature lifetime of less than a second is provided
+var ErrInvalidLifetime = errors.New("signature lifetime must be at least one second")
+
+// ErrInvalidBodyLength is returned if a body length limit less than BodyLengthAll is provided
+var ErrInvalidBodyLength = errors.New("body length limit must not be negative")
+
+// DefaultOversignHeaders is the list of header fields that are oversigned if
+// WithOversigning is used without header fields
+var DefaultOversignHeaders = []string{"From", "To", "Subject", "Date", "Reply-To", "Content-Type"}
+
 // SignerOption returns a function that can be used for grouping SignerConfig options
 type SignerOption func(config *SignerConfig) error
 
@@ -135,6 +201,19 @@ func NewConfig(d string, s string, o ...SignerOption) (*SignerConfig, error) {
 		}
 	}
 
+	// The expiration time depends on the Clock, so the time values are validated after
+	// all options have been applied, independent of their order
+	if !sc.Expiration.IsZero() {
+		if err := sc.validateExpiration(sc.Expiration); err != nil {
+			return sc, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+	if sc.Lifetime != 0 {
+		if err := validateLifetime(sc.Lifetime); err != nil {
+			return sc, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
 	return sc, nil
 }
 
@@ -168,17 +247,32 @@ func WithBodyCanonicalization(c dkim.Canonicalization) SignerOption {
 	}
 }
 
-// WithExpiration provides the optional expiration time value for the SignerConfig
+// WithExpiration provides the optional expiration time value for the SignerConfig. The
+// expiration time is validated by NewConfig against the Clock of the SignerConfig
 func WithExpiration(x time.Time) SignerOption {
 	return func(sc *SignerConfig) error {
-		if x.UnixNano() <= time.Now().UnixNano() {
-			return ErrInvalidExpiration
-		}
 		sc.Expiration = x
 		return nil
 	}
 }
 
+// WithLifetime provides the relative lifetime of the signatures for the SignerConfig. The
+// lifetime is validated by NewConfig
+func WithLifetime(l time.Duration) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.Lifetime = l
+		return nil
+	}
+}
+
+// WithClock provides the Clock for the SignerConfig
+func WithClock(c func() time.Time) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.SetClock(c)
+		return nil
+	}
+}
+
 // WithHashAlgo provides the Hashing algorithm to the SignerConfig
 func WithHashAlgo(ha crypto.Hash) SignerOption {
 	return func(sc *SignerConfig) error {
@@ -208,6 +302,23 @@ func WithHeaderFields(fl ...string) SignerOption {
 	}
 }
 
+// WithOversigning provides the list of header fields that should be oversigned. If no
+// header fields are given, the DefaultOversignHeaders are used
+func WithOversigning(fl ...string) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.SetOversigning(fl...)
+		return nil
+	}
+}
+
+// WithBodyLength provides the body length limit of the signature for the SignerConfig.
+// Please read the security warning of SignerConfig.BodyLength before using it
+func WithBodyLength(l int64) SignerOption {
+	return func(sc *SignerConfig) error {
+		return sc.SetBodyLength(l)
+	}
+}
+
 // SetAUID sets/overrides the AUID of the SignerConfig
 func (sc *SignerConfig) SetAUID(a string) {
 	sc.AUID = a
@@ -231,15 +342,30 @@ func (sc *SignerConfig) SetBodyCanonicalization(c dkim.Canonicalization) error {
 	return nil
 }
 
-// SetExpiration sets/overrides the Expiration of the SignerConfig
+// SetExpiration sets/overrides the Expiration of the SignerConfig. The expiration time
+// must be after the current time of the Clock of the SignerConfig
 func (sc *SignerConfig) SetExpiration(x time.Time) error {
-	if x.UnixNano() <= time.Now().UnixNano() {
-		return ErrInvalidExpiration
+	if err := sc.validateExpiration(x); err != nil {
+		return err
 	}
 	sc.Expiration = x
 	return nil
 }
 
+// SetLifetime sets/overrides the Lifetime of the SignerConfig
+func (sc *SignerConfig) SetLifetime(l time.Duration) error {
+	if err := validateLifetime(l); err != nil {
+		return err
+	}
+	sc.Lifetime = l
+	return nil
+}
+
+// SetClock sets/overrides the Clock of the SignerConfig
+func (sc *SignerConfig) SetClock(c func() time.Time) {
+	sc.Clock = c
+}
+
 // SetHashAlgo sets/override the hashing algorithm of the SignerConfig
 func (sc *SignerConfig) SetHashAlgo(ha crypto.Hash) error {
 	if !sc.HashAlgoIsValid(ha) {
@@ -264,6 +390,25 @@ func (sc *SignerConfig) SetHeaderFields(fl ...string) error {
 	return nil
 }
 
+// SetBodyLength sets/overrides the body length limit of the SignerConfig. Please read
+// the security warning of SignerConfig.BodyLength before using it
+func (sc *SignerConfig) SetBodyLength(l int64) error {
+	if l < BodyLengthAll {
+		return fmt.Errorf("%d: %w", l, ErrInvalidBodyLength)
+	}
+	sc.BodyLength = l
+	return nil
+}
+
+// SetOversigning sets/overrides the OversignHeaders of the SignerConfig. If no header
+// fields are given, the DefaultOversignHeaders are used
+func (sc *SignerConfig) SetOversigning(fl ...string) {
+	if len(fl) == 0 {
+		fl = DefaultOversignHeaders
+	}
+	sc.OversignHeaders = append([]string(nil), fl...)
+}
+
 // HashAlgoIsValid returns true if a the provided crypto.Hash is a valid algorithm for the SignerConfig
 func (sc *SignerConfig) HashAlgoIsValid(ha crypto.Hash) bool {
 	switch ha.String() {
@@ -292,3 +437,28 @@ func (sc *SignerConfig) SetSelector(s string) error {
 	sc.Selector = s
 	return nil
 }
+
+// validateExpiration returns ErrInvalidExpiration if the given expiration time is not
+// after the current time of the Clock of the SignerConfig
+func (sc *SignerConfig) validateExpiration(x time.Time) error {
+	if !x.After(sc.now()) {
+		return ErrInvalidExpiration
+	}
+	return nil
+}
+
+// validateLifetime returns ErrInvalidLifetime if the given lifetime is less than a second
+func validateLifetime(l time.Duration) error {
+	if l < time.Second {
+		return fmt.Errorf("%s: %w", l, ErrInvalidLifetime)
+	}
+	return nil
+}
+
+// now returns the current time of the Clock of the SignerConfig
+func (sc *SignerConfig) now() time.Time {
+	if sc.Clock == nil {
+		return time.Now()
+	}
+	return sc.Clock()
+}
@@ -6,6 +6,7 @@ package dkim
 
 import (
 	"crypto"
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -248,3 +249,95 @@ func TestNewConfig_WithExpiration(t *testing.T) {
 		t.Errorf("yesterday as value for SetExpiration() expected to fail, but did not")
 	}
 }
+
+func TestNewConfig_WithSetOversigning(t *testing.T) {
+	c, err := NewConfig(TestDomain, TestSelector, WithOversigning())
+	if err != nil {
+		t.Errorf("NewConfig failed: %s", err)
+	}
+	if strings.Join(c.OversignHeaders, ",") != strings.Join(DefaultOversignHeaders, ",") {
+		t.Errorf("WithOversigning failed. Expected: %s, got: %s", DefaultOversignHeaders, c.OversignHeaders)
+	}
+	c.OversignHeaders[0] = "X-Test"
+	if DefaultOversignHeaders[0] != "From" {
+		t.Errorf("WithOversigning failed. DefaultOversignHeaders were modified")
+	}
+	c.SetOversigning("From", "Subject")
+	if strings.Join(c.OversignHeaders, ",") != "From,Subject" {
+		t.Errorf("SetOversigning failed. Expected: From,Subject, got: %s", c.OversignHeaders)
+	}
+}
+
+func TestNewConfig_WithSetBodyLength(t *testing.T) {
+	c, err := NewConfig(TestDomain, TestSelector, WithBodyLength(BodyLengthAll))
+	if err != nil {
+		t.Errorf("NewConfig failed: %s", err)
+	}
+	if c.BodyLength != BodyLengthAll {
+		t.Errorf("WithBodyLength failed. Expected: %d, got: %d", BodyLengthAll, c.BodyLength)
+	}
+	if err = c.SetBodyLength(1024); err != nil {
+		t.Errorf("SetBodyLength failed: %s", err)
+	}
+	if c.BodyLength != 1024 {
+		t.Errorf("SetBodyLength failed. Expected: %d, got: %d", 1024, c.BodyLength)
+	}
+	if _, err = NewConfig(TestDomain, TestSelector, WithBodyLength(-2)); !errors.Is(err, ErrInvalidBodyLength) {
+		t.Errorf("WithBodyLength with negative length was supposed to fail with ErrInvalidBodyLength, got: %v", err)
+	}
+}
+
+func TestNewConfig_WithSetClock(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	// The expiration is validated against the clock instead of the current time,
+	// independent of the order of the options
+	if _, err := NewConfig(TestDomain, TestSelector, WithExpiration(now.Add(time.Hour)), WithClock(clock)); err != nil {
+		t.Errorf("NewConfig with expiration before clock failed: %s", err)
+	}
+	if _, err := NewConfig(TestDomain, TestSelector, WithExpiration(now.Add(-time.Hour)),
+		WithClock(clock)); !errors.Is(err, ErrInvalidExpiration) {
+		t.Errorf("NewConfig with expiration before the clock time was supposed to fail, got: %v", err)
+	}
+	c, err := NewConfig(TestDomain, TestSelector, WithClock(clock), WithExpiration(now.Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("NewConfig with clock and expiration failed: %s", err)
+	}
+	if !c.now().Equal(now) {
+		t.Errorf("WithClock failed. Expected: %s, got: %s", now, c.now())
+	}
+	if err = c.SetExpiration(now.Add(-time.Second)); !errors.Is(err, ErrInvalidExpiration) {
+		t.Errorf("SetExpiration before the clock time was supposed to fail, got: %v", err)
+	}
+	c.SetClock(nil)
+	if err = c.SetExpiration(now.Add(time.Hour)); !errors.Is(err, ErrInvalidExpiration) {
+		t.Errorf("SetExpiration in the past without clock was supposed to fail, got: %v", err)
+	}
+}
+
+func TestNewConfig_WithSetLifetime(t *testing.T) {
+	c, err := NewConfig(TestDomain, TestSelector, WithLifetime(time.Hour*24*7))
+	if err != nil {
+		t.Fatalf("NewConfig with lifetime failed: %s", err)
+	}
+	if c.Lifetime != time.Hour*24*7 {
+		t.Errorf("WithLifetime failed. Expected: %s, got: %s", time.Hour*24*7, c.Lifetime)
+	}
+	for _, l := range []time.Duration{-time.Hour, time.Millisecond * 999} {
+		if _, err = NewConfig(TestDomain, TestSelector, WithLifetime(l)); !errors.Is(err, ErrInvalidLifetime) {
+			t.Errorf("WithLifetime with %s was supposed to fail with ErrInvalidLifetime, got: %v", l, err)
+		}
+	}
+	if err = c.SetLifetime(time.Hour); err != nil {
+		t.Errorf("SetLifetime failed: %s", err)
+	}
+	for _, l := range []time.Duration{0, -time.Hour, time.Millisecond * 999} {
+		if err = c.SetLifetime(l); !errors.Is(err, ErrInvalidLifetime) {
+			t.Errorf("SetLifetime with %s was supposed to fail with ErrInvalidLifetime, got: %v", l, err)
+		}
+	}
+	if c.Lifetime != time.Hour {
+		t.Errorf("SetLifetime with invalid lifetime was not supposed to change the lifetime, got: %s", c.Lifetime)
+	}
+}
@@ -5,28 +5,43 @@
 package dkim
 
 import (
-	"bufio"
-	"bytes"
 	"crypto"
 	"crypto/ed25519"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto/rsa"
 	"errors"
 	"fmt"
-	"io"
 	"strings"
+	"time"
 
 	"github.com/emersion/go-msgauth/dkim"
 	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+	"github.com/wneessen/go-mail-middleware/log"
 )
 
 // Middleware is the middleware struct for the DKIM middleware
 type Middleware struct {
-	so *dkim.SignOptions
+	so       []*signerOptions
+	registry SignerRegistry
+	policy   UnknownDomainPolicy
+	fallback string
+	parents  bool
+	rotation *Rotation
+
+	errHeader mail.Header
+	failure   FailurePolicy
+	sigPolicy SignaturePolicy
+	logger    *log.Logger
+	onError   ErrorHandler
 }
 
-// Type is the type of Middleware
-const Type mail.MiddlewareType = "dkim"
+const (
+	// Type is the type of Middleware
+	Type mail.MiddlewareType = "dkim"
+	// MinRSAKeyBits is the minimum size of RSA keys that are accepted for signing
+	// See: https://www.rfc-editor.org/rfc/rfc8301.html#section-3.2
+	MinRSAKeyBits = 1024
+)
 
 var (
 	ErrInvalidHashAlgo         = errors.New("unsupported hashing algorithm")
@@ -36,63 +51,187 @@ var (
 	ErrInvalidExpiration       = errors.New("expiration date must be in the future")
 	ErrEmptySelector           = errors.New("DKIM domain selector must not be empty")
 	ErrFromRequired            = errors.New(`the "From" field is required`)
+	ErrNoConfig                = errors.New("no SignerConfig provided")
+	ErrNoSigner                = errors.New("no crypto.Signer provided")
+	ErrKeyTooShort             = errors.New("RSA key is too short")
 )
 
+// signerOptions are the dkim.SignOptions of a signer of the Middleware along with the
+// header fields that are oversigned, the body length limit, the signature lifetime and
+// the clock
+type signerOptions struct {
+	*dkim.SignOptions
+	oversign   []string
+	bodyLength int64
+	lifetime   time.Duration
+	clock      func() time.Time
+}
+
 // NewFromRSAKey returns a new Middlware from a given RSA private key
 // byte slice and a SignerConfig
-func NewFromRSAKey(k []byte, sc *SignerConfig) (*Middleware, error) {
-	dp, _ := pem.Decode(k)
-	if dp == nil {
-		return nil, ErrDecodePEMFailed
-	}
-	pk, err := x509.ParsePKCS1PrivateKey(dp.Bytes)
+func NewFromRSAKey(k []byte, sc *SignerConfig, o ...Option) (*Middleware, error) {
+	pk, err := ParseRSAKey(k)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, err
 	}
-	return newMiddleware(sc, pk)
+	return newMiddleware(sc, pk, o...)
 }
 
 // NewFromEd25519Key returns a new Signer instance from a given PEM encoded Ed25519
 // private key
-func NewFromEd25519Key(k []byte, sc *SignerConfig) (*Middleware, error) {
-	var pk ed25519.PrivateKey
-	dp, _ := pem.Decode(k)
-	if dp == nil {
-		return nil, ErrDecodePEMFailed
+func NewFromEd25519Key(k []byte, sc *SignerConfig, o ...Option) (*Middleware, error) {
+	pk, err := ParseEd25519Key(k)
+	if err != nil {
+		return nil, err
+	}
+	return newMiddleware(sc, pk, o...)
+}
+
+// NewFromSigner returns a new Middleware from a given crypto.Signer and a SignerConfig.
+// This allows to use keys that are not available in memory, e.g. keys stored in a KMS
+// or an HSM. The public key of the crypto.Signer must be an RSA key with at least
+// MinRSAKeyBits bits or an Ed25519 key
+func NewFromSigner(cs crypto.Signer, sc *SignerConfig, o ...Option) (*Middleware, error) {
+	return newMiddleware(sc, cs, o...)
+}
+
+// ParseRSAKey parses a PEM encoded RSA private key in PKCS#1 or PKCS#8 format. For
+// encrypted keys, use ParsePrivateKey
+func ParseRSAKey(k []byte) (*rsa.PrivateKey, error) {
+	pk, err := ParsePrivateKey(k, nil)
+	if err != nil {
+		return nil, err
+	}
+	rk, ok := pk.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrNotRSAKey
 	}
-	apk, err := x509.ParsePKCS8PrivateKey(dp.Bytes)
+	return rk, nil
+}
+
+// ParseEd25519Key parses a PEM encoded Ed25519 private key in PKCS#8 format. For
+// encrypted keys, use ParsePrivateKey
+func ParseEd25519Key(k []byte) (ed25519.PrivateKey, error) {
+	pk, err := ParsePrivateKey(k, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, err
 	}
-	switch tpk := apk.(type) {
-	case ed25519.PrivateKey:
-		pk = tpk
-	default:
+	ek, ok := pk.(ed25519.PrivateKey)
+	if !ok {
 		return nil, ErrNotEd25519Key
 	}
-	return newMiddleware(sc, pk)
+	return ek, nil
 }
 
-// Handle is the handler method that satisfies the mail.Middleware interface
-func (d Middleware) Handle(m *mail.Msg) *mail.Msg {
-	ibuf := bytes.NewBuffer(nil)
-	_, err := m.WriteToSkipMiddleware(ibuf, Type)
+// AddSigner adds another signer with the given SignerConfig and crypto.Signer to the
+// Middleware. The Middleware adds one DKIM-Signature header per signer to the mail.Msg,
+// which allows to sign a mail with different keys and algorithms at the same time,
+// e.g. with RSA and Ed25519 as recommended by RFC 8463
+func (d *Middleware) AddSigner(sc *SignerConfig, cs crypto.Signer) error {
+	so, err := signOptions(sc, cs)
 	if err != nil {
-		return m
+		return err
 	}
+	d.so = append(d.so, so)
+	d.warnBodyLength(so)
+	return nil
+}
 
-	var obuf bytes.Buffer
-	if err := dkim.Sign(&obuf, ibuf, d.so); err != nil {
-		return m
+// AddRSAKey adds another signer from a given RSA private key byte slice and a
+// SignerConfig to the Middleware. See AddSigner for details
+func (d *Middleware) AddRSAKey(k []byte, sc *SignerConfig) error {
+	pk, err := ParseRSAKey(k)
+	if err != nil {
+		return err
 	}
-	br := bufio.NewReader(&obuf)
-	h, err := extractDKIMHeader(br)
+	return d.AddSigner(sc, pk)
+}
+
+// AddEd25519Key adds another signer from a given PEM encoded Ed25519 private key and a
+// SignerConfig to the Middleware. See AddSigner for details
+func (d *Middleware) AddEd25519Key(k []byte, sc *SignerConfig) error {
+	pk, err := ParseEd25519Key(k)
 	if err != nil {
+		return err
+	}
+	return d.AddSigner(sc, pk)
+}
+
+// Handle is the handler method that satisfies the mail.Middleware interface. All
+// signers of the Middleware sign the same canonical form of the mail.Msg, so that
+// none of the DKIM-Signature headers covers another one. The body of the mail.Msg is
+// hashed while it is written, so that the mail.Msg is not held in memory as a whole
+// for signing. If the Middleware has a
+// SignerRegistry, the signers for the sender domain of the mail.Msg are added. If the
+// Middleware has a Rotation, its active key is added.
+//
+// The new DKIM-Signature headers are prepended to the DKIM-Signature headers that the
+// mail.Msg already carries. Stale signatures of the Middleware itself are removed
+// according to the SignaturePolicy of the Middleware.
+//
+// If the mail.Msg can not be signed, it is handled according to the FailurePolicy of
+// the Middleware. This includes signers with an absolute expiration time that has
+// already passed, since their signatures would be invalid on arrival
+func (d Middleware) Handle(m *mail.Msg) *mail.Msg {
+	sol := d.so
+	if d.registry != nil {
+		rsol, err := d.registrySignOptions(m)
+		if err != nil {
+			return d.fail(m, fmt.Errorf("failed to look up signers: %w", err))
+		}
+		sol = append(sol[:len(sol):len(sol)], rsol...)
+	}
+	if d.rotation != nil {
+		so, err := d.rotation.signOptions()
+		if err != nil {
+			return d.fail(m, err)
+		}
+		sol = append(sol[:len(sol):len(sol)], so)
+	}
+	if len(sol) == 0 {
 		return m
 	}
-	if h != "" {
-		m.SetGenHeaderPreformatted("DKIM-Signature", h)
+
+	// The mail message is written to the BodyHashers in a single pass. Signers with the
+	// same body hash parameters share a BodyHasher
+	type bodyParams struct {
+		hash   crypto.Hash
+		canon  dkim.Canonicalization
+		length int64
+	}
+	bm := make(map[bodyParams]*mailauth.BodyHasher)
+	bhl := make([]*mailauth.BodyHasher, len(sol))
+	for i, so := range sol {
+		bp := bodyParams{so.hash(), canonicalization(so.BodyCanonicalization), so.bodyLength}
+		if bm[bp] == nil {
+			bm[bp] = mailauth.NewBodyHasher(bp.hash, bp.canon, bp.length)
+		}
+		bhl[i] = bm[bp]
+	}
+	ul := make([]*mailauth.BodyHasher, 0, len(bm))
+	for _, bh := range bm {
+		ul = append(ul, bh)
+	}
+	mh := mailauth.NewMessageHasher(ul...)
+	if _, err := m.WriteToSkipMiddleware(mh, Type); err != nil {
+		return d.fail(m, fmt.Errorf("failed to write mail message: %w", err))
 	}
+	hfl, err := mh.Close()
+	if err != nil {
+		return d.fail(m, fmt.Errorf("failed to parse mail message header: %w", err))
+	}
+
+	hfl, esl := d.existingSignatures(m, hfl, sol)
+	hl := make([]string, 0, len(sol)+len(esl))
+	for i, so := range sol {
+		h, err := so.sign(hfl, bhl[i], so.now())
+		if err != nil {
+			return d.fail(m, fmt.Errorf("failed to sign mail message with selector %q: %w", so.Selector, err))
+		}
+		hl = append(hl, h)
+	}
+	hl = append(hl, esl...)
+	m.SetGenHeaderPreformatted(headerDKIMSignature, strings.Join(hl, mail.SingleNewLine+headerDKIMSignature+": "))
 	return m
 }
 
@@ -105,55 +244,150 @@ func (d Middleware) Type() mail.MiddlewareType {
 // It takes a SignerConfig and a crypto.Signer as arguments.
 //
 // This method is invoked by the different New*() methods
-func newMiddleware(sc *SignerConfig, cs crypto.Signer) (*Middleware, error) {
-	so := &dkim.SignOptions{
-		Domain:                 sc.Domain,
-		Selector:               sc.Selector,
-		Identifier:             sc.AUID,
-		Signer:                 cs,
-		Hash:                   sc.HashAlgo,
-		HeaderCanonicalization: sc.CanonicalizationHeader,
-		BodyCanonicalization:   sc.CanonicalizationBody,
-		HeaderKeys:             sc.HeaderFields,
-		Expiration:             sc.Expiration,
-	}
-
-	return &Middleware{so: so}, nil
-}
-
-// extractDKIMHeader is a helper method to extract the generated DKIM mail header
-// from output of the mail.Msg
-func extractDKIMHeader(br *bufio.Reader) (string, error) {
-	var h []string
-	for {
-		l, err := br.ReadString('\n')
-		if err != nil {
-			switch {
-			case errors.Is(err, io.EOF):
-				break
-			default:
-				return "", fmt.Errorf("failed to parse mail message header: %w", err)
+func newMiddleware(sc *SignerConfig, cs crypto.Signer, o ...Option) (*Middleware, error) {
+	so, err := signOptions(sc, cs)
+	if err != nil {
+		return nil, err
+	}
+	d := &Middleware{so: []*signerOptions{so}}
+	d.applyOptions(o)
+	d.warnBodyLength(so)
+	return d, nil
+}
+
+// warnBodyLength logs a warning if the given signerOptions do not protect the complete
+// body with the signature, since this is a security risk
+func (d *Middleware) warnBodyLength(so *signerOptions) {
+	if so.bodyLength != 0 && d.logger != nil {
+		d.logger.Warnf("signatures with selector %q have a body length limit. content appended to "+
+			"the body after signing is not protected by the signature", so.Selector)
+	}
+}
+
+// signOptions returns the dkim.SignOptions for the given SignerConfig and crypto.Signer
+func signOptions(sc *SignerConfig, cs crypto.Signer) (*signerOptions, error) {
+	if sc == nil {
+		return nil, ErrNoConfig
+	}
+	if err := validateSigner(cs); err != nil {
+		return nil, err
+	}
+	if err := validateConfig(sc); err != nil {
+		return nil, err
+	}
+	return &signerOptions{
+		SignOptions: &dkim.SignOptions{
+			Domain:                 sc.Domain,
+			Selector:               sc.Selector,
+			Identifier:             sc.AUID,
+			Signer:                 cs,
+			Hash:                   sc.HashAlgo,
+			HeaderCanonicalization: sc.CanonicalizationHeader,
+			BodyCanonicalization:   sc.CanonicalizationBody,
+			HeaderKeys:             sc.HeaderFields,
+			Expiration:             sc.Expiration,
+		},
+		oversign:   sc.OversignHeaders,
+		bodyLength: sc.BodyLength,
+		lifetime:   sc.Lifetime,
+		clock:      sc.Clock,
+	}, nil
+}
+
+// now returns the current time of the clock of the signerOptions
+func (so *signerOptions) now() time.Time {
+	if so.clock == nil {
+		return time.Now()
+	}
+	return so.clock()
+}
+
+// expiration returns the expiration time of a signature with the given signing time.
+// It is the earlier of the absolute expiration time and the signing time plus the
+// lifetime of the signerOptions. A zero time is returned if the signature does not
+// expire
+func (so *signerOptions) expiration(t time.Time) time.Time {
+	x := so.Expiration
+	if so.lifetime > 0 {
+		if lx := t.Add(so.lifetime); x.IsZero() || lx.Before(x) {
+			x = lx
+		}
+	}
+	return x
+}
+
+// headerKeys returns the names of the header fields that are signed for a mail message
+// with the given header field names. Without a list of header fields, all header fields
+// except for DKIM-Signature header fields are signed, since existing signatures might be
+// replaced. If header fields are oversigned, each of them is added to the list once more
+// than it occurs in the mail message
+func (so *signerOptions) headerKeys(hn []string) []string {
+	hk := so.HeaderKeys
+	if hk == nil {
+		hk = make([]string, 0, len(hn))
+		for _, n := range hn {
+			if !strings.EqualFold(n, headerDKIMSignature) {
+				hk = append(hk, n)
 			}
 		}
-		if len(l) == 0 {
-			break
+	}
+	if len(so.oversign) == 0 {
+		return hk
+	}
+	hk = append([]string(nil), hk...)
+	for _, o := range so.oversign {
+		n := countFields(hn, o) + 1 - countFields(hk, o)
+		for i := 0; i < n; i++ {
+			hk = append(hk, o)
 		}
-		if len(l) == 2 && (l[0] == '\r' && l[1] == '\n') {
-			break
+	}
+	return hk
+}
+
+// validateSigner validates that the public key of the given crypto.Signer is an RSA key
+// with at least MinRSAKeyBits bits or an Ed25519 key
+func validateSigner(cs crypto.Signer) error {
+	if cs == nil {
+		return ErrNoSigner
+	}
+	switch pk := cs.Public().(type) {
+	case *rsa.PublicKey:
+		if pk.N.BitLen() < MinRSAKeyBits {
+			return fmt.Errorf("%d bits: %w", pk.N.BitLen(), ErrKeyTooShort)
 		}
-		if len(h) > 0 && (l[0] == ' ' || l[0] == '\t') {
-			h[len(h)-1] += l
-		} else {
-			h = append(h, l)
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("%T: %w", pk, ErrUnsupportedKey)
+	}
+	return nil
+}
+
+// countFields returns the number of occurrences of the header field name n in the
+// given list of header field names
+func countFields(hl []string, n string) int {
+	c := 0
+	for _, h := range hl {
+		if strings.EqualFold(h, n) {
+			c++
 		}
 	}
-	for i := range h {
-		s := strings.SplitN(h[i], ": ", 2)
-		if len(s) == 2 && s[0] == "DKIM-Signature" {
-			hv := s[1]
-			hv = strings.TrimRight(hv, mail.SingleNewLine)
-			return hv, nil
+	return c
+}
+
+// validateConfig validates the hash algorithm, canonicalizations and header fields of the
+// given SignerConfig, since they can also be set directly instead of using the
+// SignerOption functions
+func validateConfig(sc *SignerConfig) error {
+	if sc.HashAlgo != 0 && !sc.HashAlgoIsValid(sc.HashAlgo) {
+		return fmt.Errorf("%s: %w", sc.HashAlgo.String(), ErrInvalidHashAlgo)
+	}
+	for _, c := range []dkim.Canonicalization{sc.CanonicalizationHeader, sc.CanonicalizationBody} {
+		if c != "" && !sc.CanonicalizationIsValid(c) {
+			return fmt.Errorf("%s: %w", c, ErrInvalidCanonicalization)
 		}
 	}
-	return "", nil
+	if sc.HeaderFields != nil && countFields(sc.HeaderFields, "From") == 0 {
+		return ErrFromRequired
+	}
+	return nil
 }
@@ -5,7 +5,6 @@
 package dkim
 
 import (
-	"bufio"
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
@@ -13,14 +12,19 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-msgauth/dkim"
 	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+	"github.com/wneessen/go-mail-middleware/log"
 )
 
 const (
@@ -250,7 +254,7 @@ func TestMiddleware_Handle(t *testing.T) {
 		t.Errorf("failed writing message to memory: %s", err)
 	}
 
-	verifyEmailWithDKIM(t, &buf, mw.so.Signer)
+	verifyEmailWithDKIM(t, &buf, mw.so[0].Signer)
 }
 
 func TestMiddleware_Handle_Multipart(t *testing.T) {
@@ -299,10 +303,291 @@ func TestMiddleware_Handle_Multipart(t *testing.T) {
 	}
 
 	// DKIM signature should be valid
-	verifyEmailWithDKIM(t, &buf, mw.so.Signer)
+	verifyEmailWithDKIM(t, &buf, mw.so[0].Signer)
 }
 
-func TestExtractDKIMHeader(t *testing.T) {
+func TestMiddleware_Handle_MultipleSigners(t *testing.T) {
+	rc, err := NewConfig(TestDomain, "rsa")
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	ec, err := NewConfig(TestDomain, "ed")
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	mw, err := NewFromRSAKey([]byte(rsaTestKey), rc)
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	if err = mw.AddEd25519Key([]byte(ed25519TestKey), ec); err != nil {
+		t.Fatalf("failed to add Ed25519 signer: %s", err)
+	}
+	if err = mw.AddRSAKey([]byte(ed25519TestKey), rc); err == nil {
+		t.Errorf("AddRSAKey with Ed25519 key was supposed to fail, but didn't")
+	}
+	if err = mw.AddSigner(nil, mw.so[0].Signer); !errors.Is(err, ErrNoConfig) {
+		t.Errorf("AddSigner without config was supposed to fail with ErrNoConfig, got: %s", err)
+	}
+
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	if c := strings.Count(buf.String(), "DKIM-Signature: "); c != 2 {
+		t.Errorf("expected 2 DKIM-Signature headers, got: %d", c)
+	}
+
+	rl, err := Verify(&buf, NewMapLookup(map[string]string{
+		"rsa._domainkey." + TestDomain: testKeyRecord(t, mw.so[0].Signer, "rsa"),
+		"ed._domainkey." + TestDomain:  testKeyRecord(t, mw.so[1].Signer, "ed25519"),
+	}))
+	if err != nil {
+		t.Fatalf("failed to verify DKIM signatures: %s", err)
+	}
+	if len(rl) != 2 {
+		t.Fatalf("expected 2 verification results, got: %d", len(rl))
+	}
+	for i, ex := range []string{"rsa", "ed"} {
+		if rl[i].Selector != ex || !rl[i].Pass() {
+			t.Errorf("DKIM signature %d (s=%s) did not verify: %s", i, rl[i].Selector, rl[i].Err)
+		}
+		if strings.Contains(strings.ToLower(strings.Join(rl[i].HeaderKeys, ":")), "dkim-signature") {
+			t.Errorf("DKIM signature %d must not cover another DKIM-Signature header", i)
+		}
+	}
+}
+
+func TestMiddleware_Handle_Oversigning(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	tests := []struct {
+		n  string
+		hf []string
+		ex string
+	}{
+		{
+			"All header fields", nil,
+			"date:mime-version:message-id:subject:user-agent:x-mailer:from:to:content-transfer-encoding:" +
+				"content-type:from:to:subject:date:reply-to:content-type",
+		},
+		{
+			"Selected header fields", []string{"From", "Subject"},
+			"from:subject:from:to:to:subject:date:date:reply-to:content-type:content-type",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			co, err := NewConfig(TestDomain, TestSelector, WithOversigning())
+			if err != nil {
+				t.Fatalf("failed to generate new config: %s", err)
+			}
+			co.HeaderFields = tt.hf
+			mw, err := NewFromSigner(rk, co)
+			if err != nil {
+				t.Fatalf("failed to generate new middleware: %s", err)
+			}
+			m := mail.NewMsg(mail.WithMiddleware(mw))
+			if err = m.From("toni.sender@test.tld"); err != nil {
+				t.Fatalf("failed to set From address: %s", err)
+			}
+			if err = m.To("tina.recipient@test.tld"); err != nil {
+				t.Fatalf("failed to set To address: %s", err)
+			}
+			m.Subject("This is a subject")
+			m.SetDate()
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+			buf := bytes.Buffer{}
+			if _, err = m.WriteTo(&buf); err != nil {
+				t.Fatalf("failed writing message to memory: %s", err)
+			}
+
+			hk := strings.ToLower(testSignatureTags(t, buf.Bytes())["h"])
+			if hk != tt.ex {
+				t.Errorf("oversigning failed, expected h= tag: %s, got: %s", tt.ex, hk)
+			}
+			lookup := testLookup(t, rk, "rsa")
+			if rl, err := Verify(bytes.NewReader(buf.Bytes()), lookup); err != nil || len(rl) != 1 || !rl[0].Pass() {
+				t.Errorf("oversigned mail did not verify: %v", err)
+			}
+
+			// Adding another instance of an oversigned header field breaks the signature
+			for _, f := range []string{"From: mallory@test.tld", "Subject: Changed", "Reply-To: mallory@test.tld"} {
+				tm := append([]byte(f+mail.SingleNewLine), buf.Bytes()...)
+				rl, err := Verify(bytes.NewReader(tm), lookup)
+				if err != nil {
+					t.Fatalf("failed to verify DKIM signatures: %s", err)
+				}
+				if len(rl) != 1 || rl[0].Pass() {
+					t.Errorf("mail with added %q was not supposed to verify", f)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMiddleware_Handle_LargeAttachment(b *testing.B) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		b.Fatalf("failed to parse RSA key: %s", err)
+	}
+	co, err := NewConfig(TestDomain, TestSelector)
+	if err != nil {
+		b.Fatalf("failed to generate new config: %s", err)
+	}
+	mw, err := NewFromSigner(rk, co)
+	if err != nil {
+		b.Fatalf("failed to generate new middleware: %s", err)
+	}
+	for _, size := range []int{1 << 20, 20 << 20} {
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			m := mail.NewMsg(mail.WithMiddleware(mw))
+			if err := m.From("toni.sender@test.tld"); err != nil {
+				b.Fatalf("failed to set From address: %s", err)
+			}
+			m.Subject("This is a subject")
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+			m.AttachReadSeeker("attachment.bin", bytes.NewReader(bytes.Repeat([]byte("0123456789abcdef"), size/16)))
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := m.WriteTo(io.Discard); err != nil {
+					b.Fatalf("failed writing message: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_Deterministic(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	co, err := NewConfig(TestDomain, TestSelector, WithClock(func() time.Time { return now }),
+		WithExpiration(now.Add(time.Hour*24)), WithHeaderFields("From", "To", "Subject", "Date", "Message-ID"))
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	mw, err := NewFromRSAKey([]byte(rsaTestKey), co)
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	sign := func() string {
+		m := mail.NewMsg(mail.WithMiddleware(mw))
+		if err := m.From("toni.sender@test.tld"); err != nil {
+			t.Fatalf("failed to set From address: %s", err)
+		}
+		if err := m.To("tina.recipient@test.tld"); err != nil {
+			t.Fatalf("failed to set To address: %s", err)
+		}
+		m.Subject("This is a subject")
+		m.SetDateWithValue(now)
+		m.SetMessageIDWithValue("golden@test.tld")
+		m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+		buf := bytes.Buffer{}
+		if _, err := m.WriteTo(&buf); err != nil {
+			t.Fatalf("failed writing message to memory: %s", err)
+		}
+		hl, _, err := mailauth.SplitMessage(buf.Bytes())
+		if err != nil {
+			t.Fatalf("failed to parse mail message: %s", err)
+		}
+		for _, h := range hl {
+			if h.Name == headerDKIMSignature {
+				return h.Raw
+			}
+		}
+		t.Fatalf("mail message has no DKIM-Signature header field")
+		return ""
+	}
+
+	sig := sign()
+	if s := sign(); s != sig {
+		t.Errorf("signing with a fixed clock is not reproducible:\n%s\n%s", sig, s)
+	}
+	if sig != testGoldenSignature {
+		t.Errorf("signature does not match the golden signature:\n%s", sig)
+	}
+}
+
+func TestMiddleware_Handle_Expiration(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		n string
+		// o are the SignerOptions besides the clock
+		o []SignerOption
+		// now is the time of signing
+		now time.Time
+		// ex is the expected expiration time. A zero time means that the mail is not signed
+		ex time.Time
+	}{
+		{"Lifetime", []SignerOption{WithLifetime(time.Hour * 24 * 7)}, start.Add(time.Hour * 24 * 30),
+			start.Add(time.Hour * 24 * 37)},
+		{"Absolute expiration", []SignerOption{WithExpiration(start.Add(time.Hour))}, start,
+			start.Add(time.Hour)},
+		{"Expiration before lifetime ends", []SignerOption{
+			WithExpiration(start.Add(time.Hour)),
+			WithLifetime(time.Hour * 2),
+		}, start, start.Add(time.Hour)},
+		{"Lifetime ends before expiration", []SignerOption{
+			WithExpiration(start.Add(time.Hour * 3)),
+			WithLifetime(time.Hour * 2),
+		}, start, start.Add(time.Hour * 2)},
+		{"Absolute expiration passed", []SignerOption{WithExpiration(start.Add(time.Hour))},
+			start.Add(time.Hour), time.Time{}},
+		{"Lifetime with absolute expiration passed", []SignerOption{
+			WithExpiration(start.Add(time.Hour)),
+			WithLifetime(time.Hour),
+		}, start.Add(time.Hour * 2), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			now := start
+			co, err := NewConfig(TestDomain, TestSelector,
+				append([]SignerOption{WithClock(func() time.Time { return now })}, tt.o...)...)
+			if err != nil {
+				t.Fatalf("failed to generate new config: %s", err)
+			}
+			var herr error
+			mw, err := NewFromSigner(rk, co, WithLogger(log.New(io.Discard, "dkim", log.LevelWarn)),
+				WithErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+			if err != nil {
+				t.Fatalf("failed to generate new middleware: %s", err)
+			}
+			now = tt.now
+			raw := testRemoteSignerMail(t, mw).Bytes()
+			if tt.ex.IsZero() {
+				if bytes.Contains(raw, []byte(headerDKIMSignature+": ")) {
+					t.Errorf("mail with expired signature was not supposed to be signed")
+				}
+				if !errors.Is(herr, ErrInvalidExpiration) {
+					t.Errorf("ErrorHandler was supposed to be called with ErrInvalidExpiration, got: %v", herr)
+				}
+				return
+			}
+			tags := testSignatureTags(t, raw)
+			if tags["t"] != strconv.FormatInt(tt.now.Unix(), 10) {
+				t.Errorf("unexpected signing time, expected: %d, got: %s", tt.now.Unix(), tags["t"])
+			}
+			if tags["x"] != strconv.FormatInt(tt.ex.Unix(), 10) {
+				t.Errorf("unexpected expiration time, expected: %d, got: %s", tt.ex.Unix(), tags["x"])
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_SignatureHeader(t *testing.T) {
 	co, err := NewConfig(TestDomain, TestSelector)
 	if err != nil {
 		t.Errorf("failed to generate new config: %s", err)
@@ -315,22 +600,24 @@ func TestExtractDKIMHeader(t *testing.T) {
 	m.Subject("This is a subject")
 	m.SetDate()
 	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
-	br := bufio.NewReader(m.NewReader())
-	sig, err := extractDKIMHeader(br)
-	if err != nil {
-		t.Errorf("failed to extract DKIM header: %s", err)
-	}
-	if !strings.HasPrefix(sig, "a=rsa-sha256") {
-		t.Errorf("extractDKIMHeader failed. Expected prefix not found")
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
 	}
-	m = &mail.Msg{}
-	br = bufio.NewReader(m.NewReader())
-	_, err = extractDKIMHeader(br)
-	if err != nil {
-		t.Errorf("failed to extract DKIM header: %s", err)
+	if !strings.Contains(buf.String(), "\r\nDKIM-Signature: a=rsa-sha256;") {
+		t.Errorf("DKIM-Signature header failed. Expected prefix not found")
 	}
 }
 
+// testGoldenSignature is the DKIM-Signature header field of the mail message that is
+// signed in TestMiddleware_Handle_Deterministic
+const testGoldenSignature = "DKIM-Signature: a=rsa-sha256;\r\n" +
+	" bh=DZd20UktqHJjZytUFNIw+/4jGYoXyEWv5S4TkqxkU58=; c=simple/simple;\r\n" +
+	" d=test.tld; h=From:To:Subject:Date:Message-ID; s=mail; t=1717243200; v=1;\r\n" +
+	" x=1717329600; b=mtojy9IeT4cX4ORNpECr04gW8up8Rm2i6F8mW7RDhDQbmx8cmmuNSdzx8mt\r\n" +
+	" 6/UDUTaV4XThDd2CJxRPXOTDYQ0RwAlOlhxko56c/cpqdv71w+5IZdU1+zDiE/ec7lvP8J/OzFi\r\n" +
+	" moEu3/4Cm2ytsRMpUJiZTAOSPqwC/MlnCG9Bs=\r\n"
+
 // Decode and verify DKIM signature for reader of incoming email
 func verifyEmailWithDKIM(t *testing.T, r io.Reader, sk crypto.Signer) {
 	pubKeyBytes, err := x509.MarshalPKIXPublicKey(sk.Public())
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// FailurePolicy is an alias type for an int
+type FailurePolicy int
+
+// ErrorHandler is a function that is called with the mail.Msg and the error whenever
+// the Middleware fails to sign a mail
+type ErrorHandler func(msg *mail.Msg, err error)
+
+// Option returns a function that can be used for grouping Middleware options
+type Option func(d *Middleware)
+
+const (
+	// FailOpen will send a mail that could not be signed without a DKIM signature. The
+	// error is logged and handed to the ErrorHandler. This is the default
+	FailOpen FailurePolicy = iota
+	// FailMark will send a mail that could not be signed without a DKIM signature, but
+	// notes the error in the error header of the mail (HeaderError by default)
+	FailMark
+	// FailClosed will make a mail that could not be signed undeliverable. The recipients
+	// are removed, the error is noted in the error header and writing the mail fails with
+	// an error wrapping ErrNotSigned
+	FailClosed
+)
+
+// HeaderError is the default mail header field that is set on a mail.Msg that the
+// Middleware failed to sign with the FailMark or FailClosed FailurePolicy
+const HeaderError mail.Header = "X-DKIM-Error"
+
+// ErrNotSigned is returned when writing a mail.Msg that the Middleware failed to sign
+// with the FailClosed FailurePolicy. It prevents the mail from being sent unsigned
+var ErrNotSigned = errors.New("dkim: mail message could not be signed")
+
+// recipientHeaders are the address headers that hold the recipients of a mail.Msg
+var recipientHeaders = []mail.AddrHeader{mail.HeaderTo, mail.HeaderCc, mail.HeaderBcc}
+
+// WithErrorHandler sets an ErrorHandler for the Middleware, that is called for every
+// mail that the Middleware fails to sign, independent of the FailurePolicy
+func WithErrorHandler(f ErrorHandler) Option {
+	return func(d *Middleware) {
+		d.onError = f
+	}
+}
+
+// WithErrorHeader sets the mail header field that is used by the FailMark and FailClosed
+// FailurePolicy to note the signing error
+func WithErrorHeader(h mail.Header) Option {
+	return func(d *Middleware) {
+		d.errHeader = h
+	}
+}
+
+// WithFailurePolicy sets the FailurePolicy for the Middleware. FailMark and FailClosed
+// can be used as strict mode, so that signing failures do not go unnoticed
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(d *Middleware) {
+		d.failure = p
+	}
+}
+
+// WithLogger sets a log.Logger for the Middleware
+func WithLogger(l *log.Logger) Option {
+	return func(d *Middleware) {
+		d.logger = l
+	}
+}
+
+// String satisfies the fmt.Stringer interface for the FailurePolicy type
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailOpen:
+		return "fail-open"
+	case FailMark:
+		return "mark"
+	case FailClosed:
+		return "fail-closed"
+	default:
+		return "unknown"
+	}
+}
+
+// applyOptions applies the given Option functions to the Middleware and sets the
+// defaults for all options that were not provided
+func (d *Middleware) applyOptions(o []Option) {
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		co(d)
+	}
+	if d.logger == nil {
+		d.logger = log.New(os.Stderr, "dkim", log.LevelWarn)
+	}
+}
+
+// fail handles a signing error for the given mail.Msg according to the configured
+// FailurePolicy. The ErrorHandler of the Middleware is called first, independent of
+// the policy
+func (d Middleware) fail(m *mail.Msg, err error) *mail.Msg {
+	if d.onError != nil {
+		d.onError(m, err)
+	}
+	eh := d.errHeader
+	if eh == "" {
+		eh = HeaderError
+	}
+	switch d.failure {
+	case FailMark:
+		d.logError("%s. sending mail unsigned", err)
+		m.SetGenHeader(eh, err.Error())
+	case FailClosed:
+		d.logError("%s. mail will not be sent", err)
+		for _, h := range recipientHeaders {
+			m.SetAddrHeaderFromMailAddress(h)
+		}
+		m.SetGenHeader(eh, err.Error())
+		m.UnsetAllParts()
+		m.SetBodyWriter(mail.TypeTextPlain, func(io.Writer) (int64, error) {
+			return 0, fmt.Errorf("%w: %w", ErrNotSigned, err)
+		}, mail.WithPartEncoding(mail.NoEncoding))
+	default:
+		d.logError("%s. sending mail unsigned", err)
+	}
+	return m
+}
+
+// logError logs an error message with the log.Logger of the Middleware, if present
+func (d Middleware) logError(f string, v ...interface{}) {
+	if d.logger != nil {
+		d.logger.Errorf(f, v...)
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// errSignerFailed is the error returned by the failingSigner
+var errSignerFailed = errors.New("signer failed")
+
+// failingSigner is a crypto.Signer that always fails to sign
+type failingSigner struct {
+	crypto.Signer
+}
+
+// Sign satisfies the crypto.Signer interface for the failingSigner type
+func (failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errSignerFailed
+}
+
+func TestFailurePolicy_String(t *testing.T) {
+	tests := []struct {
+		p  FailurePolicy
+		ex string
+	}{
+		{FailOpen, "fail-open"},
+		{FailMark, "mark"},
+		{FailClosed, "fail-closed"},
+		{FailurePolicy(99), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ex, func(t *testing.T) {
+			if tt.p.String() != tt.ex {
+				t.Errorf("FailurePolicy.String failed, expected: %s, got: %s", tt.ex, tt.p.String())
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_Failure(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	tests := []struct {
+		n  string
+		p  FailurePolicy
+		h  mail.Header
+		eh mail.Header
+	}{
+		{"Fail open", FailOpen, "", ""},
+		{"Mark", FailMark, "", HeaderError},
+		{"Mark with custom header", FailMark, "X-Signing-Failed", "X-Signing-Failed"},
+		{"Fail closed", FailClosed, "", HeaderError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			var herr error
+			lbuf := bytes.Buffer{}
+			mw, err := newMiddleware(testRegistryConfig(t, TestDomain), failingSigner{rk},
+				WithFailurePolicy(tt.p), WithErrorHeader(tt.h),
+				WithLogger(log.New(&lbuf, "dkim", log.LevelWarn)),
+				WithErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+			if err != nil {
+				t.Fatalf("failed to generate new middleware: %s", err)
+			}
+			m := mail.NewMsg(mail.WithMiddleware(mw))
+			if err = m.From("toni.sender@test.tld"); err != nil {
+				t.Fatalf("failed to set From address: %s", err)
+			}
+			if err = m.To("tina.recipient@example.com"); err != nil {
+				t.Fatalf("failed to set To address: %s", err)
+			}
+			m.Subject("This is a subject")
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+			buf := bytes.Buffer{}
+			_, err = m.WriteTo(&buf)
+
+			if !errors.Is(herr, errSignerFailed) {
+				t.Errorf("ErrorHandler was supposed to be called with the signing error, got: %v", herr)
+			}
+			if !strings.Contains(lbuf.String(), "ERROR: ") {
+				t.Errorf("signing error was supposed to be logged, got: %q", lbuf.String())
+			}
+			if tt.p == FailClosed {
+				if !errors.Is(err, ErrNotSigned) || !errors.Is(err, errSignerFailed) {
+					t.Errorf("WriteTo was supposed to fail with ErrNotSigned, got: %v", err)
+				}
+				if len(m.GetToString()) != 0 {
+					t.Errorf("recipients of mail were supposed to be removed, got: %v", m.GetToString())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed writing message to memory: %s", err)
+			}
+			if strings.Contains(buf.String(), "DKIM-Signature: ") {
+				t.Errorf("mail was not supposed to be signed")
+			}
+			if tt.eh == "" {
+				if strings.Contains(buf.String(), string(HeaderError)) {
+					t.Errorf("mail was not supposed to be marked with %s", HeaderError)
+				}
+				return
+			}
+			if !strings.Contains(buf.String(), string(tt.eh)+": ") {
+				t.Errorf("mail was supposed to be marked with %s", tt.eh)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_FailureNoActiveKey(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	r, err := NewRotation(testRegistryConfig(t, TestDomain), []RotationEntry{
+		{Selector: "future", Key: rk, ValidFrom: time.Now().Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("failed to create rotation: %s", err)
+	}
+	var herr error
+	mw, err := NewFromRotation(r, WithFailurePolicy(FailMark),
+		WithLogger(log.New(io.Discard, "dkim", log.LevelWarn)),
+		WithErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	if !errors.Is(herr, ErrNoActiveKey) {
+		t.Errorf("ErrorHandler was supposed to be called with ErrNoActiveKey, got: %v", herr)
+	}
+	if !strings.Contains(buf.String(), string(HeaderError)+": "+ErrNoActiveKey.Error()) {
+		t.Errorf("mail was supposed to be marked with %s", HeaderError)
+	}
+}
@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/pbkdf2"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+// KeySource is a function that returns a PEM encoded private key
+type KeySource func() ([]byte, error)
+
+// pemEncryptedKey is the PEM block type of an encrypted PKCS#8 private key
+const pemEncryptedKey = "ENCRYPTED PRIVATE KEY"
+
+var (
+	// ErrEncryptedKey is returned if an encrypted private key is parsed without a passphrase
+	ErrEncryptedKey = errors.New("private key is encrypted, but no passphrase was provided")
+	// ErrInvalidPassphrase is returned if an encrypted private key could not be decrypted
+	// with the provided passphrase
+	ErrInvalidPassphrase = errors.New("failed to decrypt private key: invalid passphrase")
+	// ErrKeyEnvEmpty is returned if the environment variable of a KeySource is not set
+	ErrKeyEnvEmpty = errors.New("environment variable for private key is not set or empty")
+	// ErrNoKeySource should be returned if a KeySource is needed but not provided
+	ErrNoKeySource = errors.New("no private key source provided")
+	// ErrNotRSAKey is returned if a private key is not of type RSA
+	ErrNotRSAKey = errors.New("provided key is not of type RSA")
+	// ErrUnsupportedKey is returned if a private key other than RSA or Ed25519 is provided
+	ErrUnsupportedKey = errors.New("unsupported private key type. only RSA and Ed25519 keys are supported")
+	// ErrUnsupportedKeyEncryption is returned if the encryption scheme of an encrypted
+	// private key is not supported
+	ErrUnsupportedKeyEncryption = errors.New("unsupported private key encryption scheme")
+)
+
+// OIDs of the supported PKCS#5 v2.0 encryption schemes
+// See: https://www.rfc-editor.org/rfc/rfc8018.html#appendix-A
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the ASN.1 structure of an encrypted PKCS#8 private key
+// See: https://www.rfc-editor.org/rfc/rfc5958.html#section-3
+type encryptedPrivateKeyInfo struct {
+	Algo          pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the ASN.1 parameters of the PBES2 encryption scheme
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the ASN.1 parameters of the PBKDF2 key derivation function
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// NewFromKeySource returns a new Middleware from a private key of the given KeySource and
+// a SignerConfig. The key is parsed with ParsePrivateKey, so that RSA and Ed25519 keys in
+// PKCS#1 or PKCS#8 format, plain or encrypted with the passphrase p, are supported
+func NewFromKeySource(ks KeySource, p []byte, sc *SignerConfig, o ...Option) (*Middleware, error) {
+	pk, err := LoadPrivateKey(ks, p)
+	if err != nil {
+		return nil, err
+	}
+	return newMiddleware(sc, pk, o...)
+}
+
+// KeyFromBytes returns a KeySource for the given PEM encoded private key
+func KeyFromBytes(k []byte) KeySource {
+	return func() ([]byte, error) {
+		return k, nil
+	}
+}
+
+// KeyFromFile returns a KeySource that reads a PEM encoded private key from the given file
+func KeyFromFile(f string) KeySource {
+	return func() ([]byte, error) {
+		k, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
+		return k, nil
+	}
+}
+
+// KeyFromEnv returns a KeySource that reads a private key from the environment variable
+// with the given name. Since line breaks are cumbersome in environment variables, the
+// PEM encoded key may also be base64 encoded as a whole
+func KeyFromEnv(n string) KeySource {
+	return func() ([]byte, error) {
+		v := strings.TrimSpace(os.Getenv(n))
+		if v == "" {
+			return nil, fmt.Errorf("%s: %w", n, ErrKeyEnvEmpty)
+		}
+		if strings.HasPrefix(v, "-----BEGIN ") {
+			return []byte(v), nil
+		}
+		k, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode private key from %s: %w", n, err)
+		}
+		return k, nil
+	}
+}
+
+// LoadPrivateKey loads a private key from the given KeySource and parses it with
+// ParsePrivateKey
+func LoadPrivateKey(ks KeySource, p []byte) (crypto.Signer, error) {
+	if ks == nil {
+		return nil, ErrNoKeySource
+	}
+	k, err := ks()
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(k, p)
+}
+
+// ParsePrivateKey parses a PEM encoded RSA or Ed25519 private key. RSA keys are accepted
+// in PKCS#1 and PKCS#8 format, Ed25519 keys in PKCS#8 format. Encrypted keys are
+// decrypted with the passphrase p. Both, encrypted PKCS#8 keys (PBES2 with PBKDF2 and
+// AES-CBC, as created by "openssl genpkey -aes256") and legacy encrypted PEM blocks
+// with a "Proc-Type: 4,ENCRYPTED" header are supported
+func ParsePrivateKey(k, p []byte) (crypto.Signer, error) {
+	dp, _ := pem.Decode(k)
+	if dp == nil {
+		return nil, ErrDecodePEMFailed
+	}
+	der := dp.Bytes
+	var err error
+	switch {
+	case dp.Type == pemEncryptedKey:
+		if der, err = decryptPKCS8(der, p); err != nil {
+			return nil, err
+		}
+	//nolint:staticcheck // legacy encrypted PEM blocks are still created by "openssl rsa -aes256"
+	case x509.IsEncryptedPEMBlock(dp):
+		if len(p) == 0 {
+			return nil, ErrEncryptedKey
+		}
+		//nolint:staticcheck // see above
+		if der, err = x509.DecryptPEMBlock(dp, p); err != nil {
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, ErrInvalidPassphrase
+			}
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+	}
+
+	if pk, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return pk, nil
+	}
+	if _, err = x509.ParseECPrivateKey(der); err == nil {
+		return nil, ErrUnsupportedKey
+	}
+	apk, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	switch pk := apk.(type) {
+	case *rsa.PrivateKey:
+		return pk, nil
+	case ed25519.PrivateKey:
+		return pk, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// decryptPKCS8 decrypts the DER encoded, encrypted PKCS#8 private key with the given
+// passphrase and returns the DER encoded, unencrypted PKCS#8 private key
+// See: https://www.rfc-editor.org/rfc/rfc8018.html#section-6.2
+func decryptPKCS8(der, p []byte) ([]byte, error) {
+	if len(p) == 0 {
+		return nil, ErrEncryptedKey
+	}
+	var epki encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &epki); err != nil {
+		return nil, fmt.Errorf("failed to parse encrypted private key: %w", err)
+	}
+	if !epki.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%s: %w", epki.Algo.Algorithm, ErrUnsupportedKeyEncryption)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(epki.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%s: %w", params.KeyDerivationFunc.Algorithm, ErrUnsupportedKeyEncryption)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %w", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("%s: %w", kdf.PRF.Algorithm, ErrUnsupportedKeyEncryption)
+	}
+	var kl int
+	switch es := params.EncryptionScheme.Algorithm; {
+	case es.Equal(oidAES128CBC):
+		kl = 16
+	case es.Equal(oidAES192CBC):
+		kl = 24
+	case es.Equal(oidAES256CBC):
+		kl = 32
+	default:
+		return nil, fmt.Errorf("%s: %w", es, ErrUnsupportedKeyEncryption)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse encryption scheme parameters: %w", err)
+	}
+
+	key, err := pbkdf2.Key(prf, string(p), kdf.Salt, kdf.Iterations, kl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	data := epki.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("invalid encrypted private key data: %w", ErrUnsupportedKeyEncryption)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// Remove the PKCS#7 padding. An invalid padding is the result of a wrong passphrase
+	pl := int(out[len(out)-1])
+	if pl == 0 || pl > block.BlockSize() ||
+		!bytes.Equal(out[len(out)-pl:], bytes.Repeat([]byte{byte(pl)}, pl)) {
+		return nil, ErrInvalidPassphrase
+	}
+	return out[:len(out)-pl], nil
+}
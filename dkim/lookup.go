@@ -0,0 +1,255 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bufio"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// TXTLookupFunc is a function that returns the DNS TXT records of the given domain
+// name. It has the same signature as net.LookupTXT, which is used if no TXTLookupFunc
+// is provided
+type TXTLookupFunc func(domain string) ([]string, error)
+
+var (
+	// ErrTXTNotFound is returned by the TXTLookupFunc of NewMapLookup and NewZoneFileLookup
+	// if no TXT record is available for the requested domain name
+	ErrTXTNotFound = errors.New("no TXT record found for domain")
+	// ErrInvalidKeyRecord is returned if a DKIM key record is malformed or holds a not
+	// supported key type
+	ErrInvalidKeyRecord = errors.New("invalid DKIM key record")
+	// ErrKeyRevoked is returned if the public key of a DKIM key record has been revoked
+	ErrKeyRevoked = errors.New("DKIM key has been revoked")
+)
+
+// NewMapLookup returns a TXTLookupFunc that serves the TXT records from the given map
+// of domain names (e.g. "mail._domainkey.example.com") to TXT record values instead of
+// querying the DNS
+func NewMapLookup(rm map[string]string) TXTLookupFunc {
+	zm := make(map[string][]string, len(rm))
+	for n, r := range rm {
+		zm[zoneName(n)] = append(zm[zoneName(n)], r)
+	}
+	return zoneLookup(zm)
+}
+
+// NewZoneFileLookup returns a TXTLookupFunc that serves the TXT records of the given
+// DNS zone file instead of querying the DNS. Only TXT records are read, all other
+// resource records are ignored. The $ORIGIN directive, relative owner names, comments
+// and multi-line records in parentheses are supported
+func NewZoneFileLookup(r io.Reader) (TXTLookupFunc, error) {
+	zm := make(map[string][]string)
+	var origin, owner, rec string
+	depth := 0
+	ln := 0
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		ln++
+		l := stripZoneComment(sc.Text())
+		depth += parenDepth(l)
+		rec += " " + l
+		if depth > 0 {
+			continue
+		}
+		if depth < 0 {
+			return nil, fmt.Errorf("line %d: unbalanced parentheses in zone file", ln)
+		}
+		f, err := zoneFields(rec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", ln, err)
+		}
+		startsBlank := len(rec) > 1 && (rec[1] == ' ' || rec[1] == '\t')
+		rec = ""
+		if len(f) == 0 {
+			continue
+		}
+		if strings.EqualFold(f[0], "$ORIGIN") {
+			if len(f) < 2 {
+				return nil, fmt.Errorf("line %d: $ORIGIN without domain name", ln)
+			}
+			origin = zoneName(f[1])
+			continue
+		}
+		if strings.HasPrefix(f[0], "$") {
+			continue
+		}
+		if !startsBlank {
+			owner = absoluteName(f[0], origin)
+			f = f[1:]
+		}
+		for len(f) > 0 && isTTLOrClass(f[0]) {
+			f = f[1:]
+		}
+		if len(f) < 2 || !strings.EqualFold(f[0], "TXT") {
+			continue
+		}
+		zm[owner] = append(zm[owner], strings.Join(f[1:], ""))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read zone file: %w", err)
+	}
+	if depth != 0 {
+		return nil, errors.New("unexpected end of zone file in parentheses")
+	}
+	return zoneLookup(zm), nil
+}
+
+// LookupPublicKey looks up the DKIM key record of the given domain and selector with the
+// given TXTLookupFunc and returns the published public key. The public key is either of
+// type *rsa.PublicKey or ed25519.PublicKey. If the TXTLookupFunc is nil, the DNS is
+// queried with net.LookupTXT
+func LookupPublicKey(lookup TXTLookupFunc, domain, selector string) (crypto.PublicKey, error) {
+	r, err := LookupKeyRecord(lookup, domain, selector)
+	if err != nil {
+		return nil, err
+	}
+	if r.PublicKey == nil {
+		return nil, ErrKeyRevoked
+	}
+	return r.PublicKey, nil
+}
+
+// LookupKeyRecord looks up the DKIM key record of the given domain and selector with the
+// given TXTLookupFunc and parses it with ParseKeyRecord. If the TXTLookupFunc is nil, the
+// DNS is queried with net.LookupTXT
+func LookupKeyRecord(lookup TXTLookupFunc, domain, selector string) (*KeyRecord, error) {
+	if lookup == nil {
+		lookup = net.LookupTXT
+	}
+	rl, err := lookup(selector + "._domainkey." + domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up DKIM key record: %w", err)
+	}
+	if len(rl) == 0 {
+		return nil, ErrTXTNotFound
+	}
+	r, err := ParseKeyRecord(strings.Join(rl, ""))
+	if err != nil {
+		return nil, err
+	}
+	r.Domain, r.Selector = domain, selector
+	return r, nil
+}
+
+// zoneLookup returns a TXTLookupFunc for the given map of normalized domain names to
+// TXT records. A not existing domain name results in a non-temporary net.DNSError
+// wrapping ErrTXTNotFound, just like a NXDOMAIN response of the DNS
+func zoneLookup(zm map[string][]string) TXTLookupFunc {
+	return func(domain string) ([]string, error) {
+		r, ok := zm[zoneName(domain)]
+		if !ok {
+			return nil, &net.DNSError{Err: ErrTXTNotFound.Error(), Name: domain, IsNotFound: true,
+				UnwrapErr: ErrTXTNotFound}
+		}
+		return r, nil
+	}
+}
+
+// zoneName normalizes a domain name for the use as a lookup key
+func zoneName(n string) string {
+	return strings.ToLower(strings.TrimSuffix(n, "."))
+}
+
+// absoluteName returns the normalized absolute domain name of the owner name n of a
+// zone file record relative to the origin o
+func absoluteName(n, o string) string {
+	switch {
+	case n == "@":
+		return o
+	case strings.HasSuffix(n, "."), o == "":
+		return zoneName(n)
+	default:
+		return zoneName(n + "." + o)
+	}
+}
+
+// isTTLOrClass returns true if the given zone file field is a TTL (e.g. "3600" or "1h30m")
+// or a DNS class
+func isTTLOrClass(f string) bool {
+	switch strings.ToUpper(f) {
+	case "IN", "CH", "HS":
+		return true
+	}
+	return f != "" && f[0] >= '0' && f[0] <= '9' && strings.Trim(strings.ToLower(f), "0123456789smhdw") == ""
+}
+
+// stripZoneComment removes a trailing comment from a line of a zone file
+func stripZoneComment(l string) string {
+	q := false
+	for i := 0; i < len(l); i++ {
+		switch {
+		case l[i] == '\\':
+			i++
+		case l[i] == '"':
+			q = !q
+		case l[i] == ';' && !q:
+			return l[:i]
+		}
+	}
+	return l
+}
+
+// parenDepth returns the difference of opening and closing parentheses outside of
+// quoted character strings in a line of a zone file
+func parenDepth(l string) int {
+	d := 0
+	q := false
+	for i := 0; i < len(l); i++ {
+		switch {
+		case l[i] == '\\':
+			i++
+		case l[i] == '"':
+			q = !q
+		case l[i] == '(' && !q:
+			d++
+		case l[i] == ')' && !q:
+			d--
+		}
+	}
+	return d
+}
+
+// zoneFields splits a zone file record into its fields. Quoted character strings are
+// returned without the quotes. Parentheses outside of quoted character strings are
+// treated as whitespace
+func zoneFields(s string) ([]string, error) {
+	var f []string
+	var sb strings.Builder
+	inField, q := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			sb.WriteByte(s[i])
+			inField = true
+		case c == '"':
+			q = !q
+			inField = true
+		case (c == ' ' || c == '\t' || c == '(' || c == ')') && !q:
+			if inField {
+				f = append(f, sb.String())
+				sb.Reset()
+				inField = false
+			}
+		default:
+			sb.WriteByte(c)
+			inField = true
+		}
+	}
+	if q {
+		return nil, errors.New("unterminated quoted string in zone file")
+	}
+	if inField {
+		f = append(f, sb.String())
+	}
+	return f, nil
+}
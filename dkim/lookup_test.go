@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testZoneFile = `$ORIGIN test.tld.
+$TTL 3600
+@               IN  SOA   ns1.test.tld. hostmaster.test.tld. ( 1 7200 3600 1209600 3600 )
+                IN  NS    ns1.test.tld.
+mail._domainkey IN  TXT   "v=DKIM1; k=rsa; p=MIGf" ; the RSA key
+ed._domainkey   1h  TXT   ( "v=DKIM1; k=ed25519; "  ; multi-line record
+                            "p=AAAA" )
+                IN  TXT   "second; record"
+quoted._domainkey.other.tld. IN TXT "v=DKIM1; p=a\"b(c"
+`
+
+func TestNewMapLookup(t *testing.T) {
+	l := NewMapLookup(map[string]string{"Mail._domainkey.Test.tld.": "v=DKIM1; p=abc"})
+	r, err := l("mail._domainkey.test.tld")
+	if err != nil {
+		t.Fatalf("lookup failed: %s", err)
+	}
+	if len(r) != 1 || r[0] != "v=DKIM1; p=abc" {
+		t.Errorf("lookup failed. Unexpected TXT records: %s", r)
+	}
+	_, err = l("unknown._domainkey.test.tld")
+	if !errors.Is(err, ErrTXTNotFound) {
+		t.Errorf("lookup of unknown domain was supposed to fail with ErrTXTNotFound, got: %s", err)
+	}
+	var de *net.DNSError
+	if !errors.As(err, &de) || !de.IsNotFound || de.Temporary() {
+		t.Errorf("lookup of unknown domain was supposed to return a permanent net.DNSError, got: %s", err)
+	}
+}
+
+func TestNewZoneFileLookup(t *testing.T) {
+	l, err := NewZoneFileLookup(strings.NewReader(testZoneFile))
+	if err != nil {
+		t.Fatalf("NewZoneFileLookup failed: %s", err)
+	}
+	tests := []struct {
+		d  string
+		ex []string
+	}{
+		{"mail._domainkey.test.tld", []string{"v=DKIM1; k=rsa; p=MIGf"}},
+		{"ed._domainkey.test.tld.", []string{"v=DKIM1; k=ed25519; p=AAAA", "second; record"}},
+		{"quoted._domainkey.other.tld", []string{`v=DKIM1; p=a"b(c`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d, func(t *testing.T) {
+			r, err := l(tt.d)
+			if err != nil {
+				t.Fatalf("lookup failed: %s", err)
+			}
+			if strings.Join(r, "|") != strings.Join(tt.ex, "|") {
+				t.Errorf("lookup failed. Expected: %q, got: %q", tt.ex, r)
+			}
+		})
+	}
+	if _, err = l("test.tld"); !errors.Is(err, ErrTXTNotFound) {
+		t.Errorf("lookup of domain without TXT record was supposed to fail with ErrTXTNotFound, got: %s", err)
+	}
+}
+
+func TestNewZoneFileLookup_fails(t *testing.T) {
+	tests := []struct {
+		n string
+		z string
+	}{
+		{"unbalanced parentheses", "mail._domainkey.test.tld. IN TXT ( \"v=DKIM1\""},
+		{"unexpected closing parenthesis", "mail._domainkey.test.tld. IN TXT \"v=DKIM1\" )"},
+		{"unterminated quoted string", "mail._domainkey.test.tld. IN TXT \"v=DKIM1"},
+		{"$ORIGIN without domain", "$ORIGIN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			if _, err := NewZoneFileLookup(strings.NewReader(tt.z)); err == nil {
+				t.Errorf("NewZoneFileLookup was supposed to fail, but didn't")
+			}
+		})
+	}
+}
+
+func TestLookupPublicKey(t *testing.T) {
+	rsaKey, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	edKey, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	l := NewMapLookup(map[string]string{
+		"rsa._domainkey.test.tld":     testKeyRecord(t, rsaKey, "rsa"),
+		"ed._domainkey.test.tld":      testKeyRecord(t, edKey, "ed25519"),
+		"revoked._domainkey.test.tld": "v=DKIM1; k=rsa; p=",
+		"invalid._domainkey.test.tld": "v=DKIM1; k=dsa; p=AAAA",
+		"version._domainkey.test.tld": "v=DKIM2; p=AAAA",
+	})
+	pk, err := LookupPublicKey(l, TestDomain, "rsa")
+	if err != nil {
+		t.Errorf("LookupPublicKey for RSA key failed: %s", err)
+	}
+	if !rsaKey.PublicKey.Equal(pk) {
+		t.Errorf("LookupPublicKey for RSA key failed. Public key mismatch")
+	}
+	pk, err = LookupPublicKey(l, TestDomain, "ed")
+	if err != nil {
+		t.Errorf("LookupPublicKey for Ed25519 key failed: %s", err)
+	}
+	if !edKey.Public().(ed25519.PublicKey).Equal(pk) {
+		t.Errorf("LookupPublicKey for Ed25519 key failed. Public key mismatch")
+	}
+
+	tests := []struct {
+		s  string
+		ex error
+	}{
+		{"revoked", ErrKeyRevoked},
+		{"invalid", ErrInvalidKeyRecord},
+		{"version", ErrInvalidKeyRecord},
+		{"unknown", ErrTXTNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if _, err := LookupPublicKey(l, TestDomain, tt.s); !errors.Is(err, tt.ex) {
+				t.Errorf("LookupPublicKey was supposed to fail with %s, got: %s", tt.ex, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+const (
+	// FlagTesting is the "t=y" flag of a DKIM key record. It marks a domain that is
+	// testing DKIM, so that verifiers must not treat mails differently from unsigned mails
+	FlagTesting = "y"
+	// FlagStrict is the "t=s" flag of a DKIM key record. It requires that the domain of
+	// the "i=" tag of a signature matches the "d=" tag exactly, without subdomains
+	FlagStrict = "s"
+	// ServiceEmail is the "s=email" service type of a DKIM key record
+	ServiceEmail = "email"
+	// DefaultRSAKeyBits is the recommended size of generated RSA keys
+	// See: https://www.rfc-editor.org/rfc/rfc8301.html#section-3.2
+	DefaultRSAKeyBits = 2048
+)
+
+// txtStringLength is the maximum length of a single character string of a DNS TXT record
+const txtStringLength = 255
+
+// KeyRecord is a DKIM key record as published in the DNS TXT record at
+// "<selector>._domainkey.<domain>"
+// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-3.6.1
+type KeyRecord struct {
+	// Domain is the signing domain of the key
+	Domain string
+	// Selector is the DKIM domain selector of the key
+	Selector string
+	// Flags are the flags of the "t=" tag (FlagTesting and FlagStrict)
+	Flags []string
+	// HashAlgos are the acceptable hash algorithms of the "h=" tag. If empty, all hash
+	// algorithms are acceptable
+	HashAlgos []crypto.Hash
+	// PublicKey is the RSA or Ed25519 public key of the "p=" tag. If nil, the key has
+	// been revoked
+	PublicKey crypto.PublicKey
+	// Services are the service types of the "s=" tag. If empty, all service types are
+	// acceptable
+	Services []string
+}
+
+// GenerateRSAKey generates a new RSA key with the given number of bits. The key is
+// returned along with its PEM encoded form in PKCS#1 format, as accepted by NewFromRSAKey
+func GenerateRSAKey(bits int) (*rsa.PrivateKey, []byte, error) {
+	if bits < MinRSAKeyBits {
+		return nil, nil, fmt.Errorf("%d bits: %w", bits, ErrKeyTooShort)
+	}
+	pk, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate RSA key: %w", err)
+	}
+	return pk, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pk)}), nil
+}
+
+// GenerateEd25519Key generates a new Ed25519 key. The key is returned along with its PEM
+// encoded form in PKCS#8 format, as accepted by NewFromEd25519Key
+func GenerateEd25519Key() (ed25519.PrivateKey, []byte, error) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(pk)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal Ed25519 key: %w", err)
+	}
+	return pk, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// NewKeyRecord returns the KeyRecord for the given public key and SignerConfig. The "h="
+// tag is derived from the HashAlgo of the SignerConfig. The FlagStrict flag is set, if
+// the SignerConfig has no AUID or an AUID in the signing domain itself, so that a
+// signature with an AUID of a subdomain is rejected by verifiers
+func NewKeyRecord(pk crypto.PublicKey, sc *SignerConfig) (*KeyRecord, error) {
+	if sc == nil {
+		return nil, ErrNoConfig
+	}
+	if sc.Selector == "" {
+		return nil, ErrEmptySelector
+	}
+	switch pk.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("%T: %w", pk, ErrUnsupportedKey)
+	}
+	r := &KeyRecord{
+		Domain:    sc.Domain,
+		Selector:  sc.Selector,
+		PublicKey: pk,
+		Services:  []string{ServiceEmail},
+	}
+	if sc.HashAlgo != 0 {
+		r.HashAlgos = []crypto.Hash{sc.HashAlgo}
+	}
+	_, ad, _ := strings.Cut(sc.AUID, "@")
+	if ad == "" || strings.EqualFold(ad, sc.Domain) {
+		r.Flags = append(r.Flags, FlagStrict)
+	}
+	return r, nil
+}
+
+// ParseKeyRecord parses the given value of a DNS TXT record as DKIM key record. Since the
+// value does not include the DNS name of the record, Domain and Selector of the returned
+// KeyRecord are empty. An empty "p=" tag of a revoked key results in a KeyRecord without
+// PublicKey. Unknown hash algorithms of the "h=" tag are ignored
+// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-3.6.1
+func ParseKeyRecord(v string) (*KeyRecord, error) {
+	tm := signatureTags(v)
+	if ver, ok := tm["v"]; ok && ver != "DKIM1" {
+		return nil, fmt.Errorf("unsupported version %q: %w", ver, ErrInvalidKeyRecord)
+	}
+	p, ok := tm["p"]
+	if !ok {
+		return nil, fmt.Errorf("missing public key: %w", ErrInvalidKeyRecord)
+	}
+	r := &KeyRecord{
+		Flags:    tagList(tm["t"]),
+		Services: tagList(tm["s"]),
+	}
+	for _, h := range tagList(tm["h"]) {
+		switch strings.ToLower(h) {
+		case "sha1":
+			r.HashAlgos = append(r.HashAlgos, crypto.SHA1)
+		case "sha256":
+			r.HashAlgos = append(r.HashAlgos, crypto.SHA256)
+		}
+	}
+	k := tm["k"]
+	if k != "" && k != "rsa" && k != "ed25519" {
+		return nil, fmt.Errorf("unsupported key type %q: %w", k, ErrInvalidKeyRecord)
+	}
+	if p == "" {
+		return r, nil
+	}
+	kd, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", ErrInvalidKeyRecord)
+	}
+	if k == "ed25519" {
+		if len(kd) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key size: %w", ErrInvalidKeyRecord)
+		}
+		r.PublicKey = ed25519.PublicKey(kd)
+		return r, nil
+	}
+	pk, err := x509.ParsePKIXPublicKey(kd)
+	if err != nil {
+		rpk, rerr := x509.ParsePKCS1PublicKey(kd)
+		if rerr != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", ErrInvalidKeyRecord)
+		}
+		pk = rpk
+	}
+	rpk, ok := pk.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not of type RSA: %w", ErrInvalidKeyRecord)
+	}
+	r.PublicKey = rpk
+	return r, nil
+}
+
+// Name returns the DNS name of the KeyRecord
+func (r *KeyRecord) Name() string {
+	return r.Selector + "._domainkey." + r.Domain
+}
+
+// String satisfies the fmt.Stringer interface for the KeyRecord type. It returns the
+// value of the DNS TXT record
+func (r *KeyRecord) String() string {
+	tags := []string{"v=DKIM1"}
+	if len(r.HashAlgos) > 0 {
+		hl := make([]string, 0, len(r.HashAlgos))
+		for _, h := range r.HashAlgos {
+			hl = append(hl, hashName(h))
+		}
+		tags = append(tags, "h="+strings.Join(hl, ":"))
+	}
+	tags = append(tags, "k="+r.KeyType())
+	if len(r.Services) > 0 {
+		tags = append(tags, "s="+strings.Join(r.Services, ":"))
+	}
+	if len(r.Flags) > 0 {
+		tags = append(tags, "t="+strings.Join(r.Flags, ":"))
+	}
+	var p []byte
+	switch pk := r.PublicKey.(type) {
+	case *rsa.PublicKey:
+		p, _ = x509.MarshalPKIXPublicKey(pk)
+	case ed25519.PublicKey:
+		p = pk
+	}
+	return strings.Join(append(tags, "p="+base64.StdEncoding.EncodeToString(p)), "; ")
+}
+
+// KeyType returns the key type of the "k=" tag of the KeyRecord
+func (r *KeyRecord) KeyType() string {
+	if _, ok := r.PublicKey.(ed25519.PublicKey); ok {
+		return "ed25519"
+	}
+	return "rsa"
+}
+
+// ZoneEntry returns the KeyRecord as DNS zone file entry. Since a single character
+// string of a TXT record is limited to 255 bytes, the record value is split into
+// multiple character strings if necessary
+func (r *KeyRecord) ZoneEntry() string {
+	v := r.String()
+	var sl []string
+	for len(v) > txtStringLength {
+		sl = append(sl, `"`+v[:txtStringLength]+`"`)
+		v = v[txtStringLength:]
+	}
+	sl = append(sl, `"`+v+`"`)
+	if len(sl) == 1 {
+		return fmt.Sprintf("%s. IN TXT %s", r.Name(), sl[0])
+	}
+	return fmt.Sprintf("%s. IN TXT ( %s )", r.Name(), strings.Join(sl, "\n\t"))
+}
+
+// HasFlag returns true if the "t=" tag of the KeyRecord holds the given flag
+func (r *KeyRecord) HasFlag(f string) bool {
+	for _, rf := range r.Flags {
+		if strings.EqualFold(rf, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashName returns the DKIM name of the given hash algorithm
+func hashName(h crypto.Hash) string {
+	switch h {
+	case crypto.SHA1:
+		return "sha1"
+	case crypto.SHA256:
+		return "sha256"
+	default:
+		return strings.ToLower(strings.ReplaceAll(h.String(), "-", ""))
+	}
+}
+
+// tagList splits the colon separated value of a DKIM key record tag into its elements
+func tagList(v string) []string {
+	var l []string
+	for _, e := range strings.Split(v, ":") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
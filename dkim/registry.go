@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wneessen/go-mail"
+)
+
+// UnknownDomainPolicy is an alias type for an int
+type UnknownDomainPolicy int
+
+const (
+	// LeaveUnsigned will send mails with a sender domain that is not part of the
+	// SignerRegistry without a DKIM signature
+	LeaveUnsigned UnknownDomainPolicy = iota
+	// SignWithFallback will sign mails with a sender domain that is not part of the
+	// SignerRegistry with the signers of the fallback domain
+	SignWithFallback
+)
+
+const (
+	// domainKeySuffix is the file name suffix of the PEM files of a directory registry
+	domainKeySuffix = ".pem"
+	// headerSender is the name of the Sender header field
+	headerSender = "Sender"
+)
+
+var (
+	// ErrNoFallbackDomain should be returned if the SignWithFallback policy is used
+	// without a fallback domain
+	ErrNoFallbackDomain = errors.New("no fallback domain provided")
+	// ErrNoRegistry should be returned if a SignerRegistry is needed but not provided
+	ErrNoRegistry = errors.New("no signer registry provided")
+	// ErrUnknownDomain should be returned by a SignerRegistry if no signer is available
+	// for a domain
+	ErrUnknownDomain = errors.New("no signer found for domain")
+)
+
+// RegistryEntry is a signer of a SignerRegistry, consisting of a SignerConfig and the
+// corresponding private key
+type RegistryEntry struct {
+	Config *SignerConfig
+	Key    crypto.Signer
+}
+
+// SignerRegistry is an interface for looking up the signers of a sender domain
+type SignerRegistry interface {
+	// Signers returns the signers for the given domain. If no signer is available
+	// for the domain, an error wrapping ErrUnknownDomain is returned
+	Signers(domain string) ([]RegistryEntry, error)
+}
+
+// RegistryFunc is a function that satisfies the SignerRegistry interface. It allows
+// to use a callback, e.g. a database lookup, as SignerRegistry
+type RegistryFunc func(domain string) ([]RegistryEntry, error)
+
+// MapRegistry is a simple, in-memory SignerRegistry that maps (lower-case) domains to
+// their signers
+type MapRegistry map[string][]RegistryEntry
+
+// NewFromRegistry returns a new Middleware that signs each mail with the signers of its
+// sender domain from the given SignerRegistry. The sender domain is taken from the From
+// header, or the Sender header if the From domain is not part of the SignerRegistry. Only
+// the exact sender domain is looked up, unless WithParentDomains is given.
+//
+// Mails with a sender domain that is not part of the SignerRegistry are handled based on
+// the UnknownDomainPolicy p. For the SignWithFallback policy a fallback domain fd must
+// be given
+func NewFromRegistry(r SignerRegistry, p UnknownDomainPolicy, fd string, o ...Option) (*Middleware, error) {
+	if r == nil {
+		return nil, ErrNoRegistry
+	}
+	switch p {
+	case LeaveUnsigned:
+	case SignWithFallback:
+		if fd == "" {
+			return nil, ErrNoFallbackDomain
+		}
+	default:
+		return nil, fmt.Errorf("unsupported unknown domain policy: %d", p)
+	}
+	d := &Middleware{registry: r, policy: p, fallback: fd}
+	d.applyOptions(o)
+	return d, nil
+}
+
+// WithParentDomains makes a Middleware created with NewFromRegistry look up the parent
+// domains of a sender domain that is not part of the SignerRegistry, so that a mail from
+// "news.example.com" is signed with the signers of "example.com". The closest parent
+// domain with signers is used
+func WithParentDomains() Option {
+	return func(d *Middleware) {
+		d.parents = true
+	}
+}
+
+// NewDirRegistry returns a new MapRegistry from a directory of PEM encoded private keys.
+// The files must be named after the DNS name of their DKIM key record followed by the
+// ".pem" extension, e.g. "mail._domainkey.example.com.pem" for the key of the selector
+// "mail" of the domain "example.com". All other files are ignored. The SignerConfig of
+// each key is created with the given SignerOption methods
+func NewDirRegistry(dir string, o ...SignerOption) (MapRegistry, error) {
+	fl, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry directory: %w", err)
+	}
+	r := make(MapRegistry)
+	for _, f := range fl {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), domainKeySuffix) {
+			continue
+		}
+		s, d, ok := strings.Cut(strings.TrimSuffix(f.Name(), domainKeySuffix), "._domainkey.")
+		if !ok || s == "" || d == "" {
+			continue
+		}
+		k, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		pk, err := ParsePrivateKey(k, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		sc, err := NewConfig(d, s, o...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		r.Add(sc, pk)
+	}
+	return r, nil
+}
+
+// Add adds a signer with the given SignerConfig and private key for the domain of the
+// SignerConfig to the MapRegistry
+func (r MapRegistry) Add(sc *SignerConfig, k crypto.Signer) {
+	d := strings.ToLower(sc.Domain)
+	r[d] = append(r[d], RegistryEntry{Config: sc, Key: k})
+}
+
+// Signers satisfies the SignerRegistry interface for the MapRegistry type
+func (r MapRegistry) Signers(domain string) ([]RegistryEntry, error) {
+	el, ok := r[strings.ToLower(domain)]
+	if !ok || len(el) == 0 {
+		return nil, fmt.Errorf("%s: %w", domain, ErrUnknownDomain)
+	}
+	return el, nil
+}
+
+// Signers satisfies the SignerRegistry interface for the RegistryFunc type
+func (f RegistryFunc) Signers(domain string) ([]RegistryEntry, error) {
+	return f(domain)
+}
+
+// registrySignOptions returns the signerOptions for the sender domain of the given
+// mail.Msg from the SignerRegistry of the Middleware
+func (d Middleware) registrySignOptions(m *mail.Msg) ([]*signerOptions, error) {
+	el, err := d.registrySigners(senderDomains(m))
+	if errors.Is(err, ErrUnknownDomain) {
+		if d.policy != SignWithFallback {
+			return nil, nil
+		}
+		el, err = d.registry.Signers(d.fallback)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sol := make([]*signerOptions, 0, len(el))
+	for _, e := range el {
+		so, err := signOptions(e.Config, e.Key)
+		if err != nil {
+			return nil, err
+		}
+		sol = append(sol, so)
+	}
+	return sol, nil
+}
+
+// registrySigners returns the signers for the first of the given domains that is known to
+// the SignerRegistry of the Middleware. With WithParentDomains, the closest parent domain
+// of each domain is looked up before the next domain
+func (d Middleware) registrySigners(dl []string) ([]RegistryEntry, error) {
+	err := ErrUnknownDomain
+	for _, domain := range dl {
+		for {
+			var el []RegistryEntry
+			el, err = d.registry.Signers(domain)
+			if !errors.Is(err, ErrUnknownDomain) {
+				return el, err
+			}
+			_, p, ok := strings.Cut(domain, ".")
+			if !d.parents || !ok || !strings.Contains(p, ".") {
+				break
+			}
+			domain = p
+		}
+	}
+	return nil, err
+}
+
+// senderDomains returns the lower-case domains of the From address and the Sender
+// address of the given mail.Msg, in that order
+func senderDomains(m *mail.Msg) []string {
+	var al []string
+	if fl := m.GetFrom(); len(fl) > 0 {
+		al = append(al, fl[0].Address)
+	}
+	if sl := m.GetGenHeader(headerSender); len(sl) > 0 {
+		if a, err := netmail.ParseAddress(sl[0]); err == nil {
+			al = append(al, a.Address)
+		}
+	}
+	var dl []string
+	for _, a := range al {
+		if i := strings.LastIndex(a, "@"); i >= 0 && i < len(a)-1 {
+			dl = append(dl, strings.ToLower(a[i+1:]))
+		}
+	}
+	return dl
+}
@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+func TestNewFromRegistry(t *testing.T) {
+	r := make(MapRegistry)
+	tests := []struct {
+		n  string
+		r  SignerRegistry
+		p  UnknownDomainPolicy
+		fd string
+		e  error
+	}{
+		{"Leave unsigned", r, LeaveUnsigned, "", nil},
+		{"Sign with fallback", r, SignWithFallback, TestDomain, nil},
+		{"No registry", nil, LeaveUnsigned, "", ErrNoRegistry},
+		{"No fallback domain", r, SignWithFallback, "", ErrNoFallbackDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			_, err := NewFromRegistry(tt.r, tt.p, tt.fd)
+			if !errors.Is(err, tt.e) {
+				t.Errorf("NewFromRegistry failed, expected error: %v, got: %v", tt.e, err)
+			}
+		})
+	}
+	if _, err := NewFromRegistry(r, UnknownDomainPolicy(99), ""); err == nil {
+		t.Errorf("NewFromRegistry with unsupported policy was supposed to fail, but didn't")
+	}
+}
+
+func TestMiddleware_Handle_Registry(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	ek, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	r := make(MapRegistry)
+	r.Add(testRegistryConfig(t, "example.com"), rk)
+	r.Add(testRegistryConfig(t, TestDomain), ek)
+	lookup := NewMapLookup(map[string]string{
+		TestSelector + "._domainkey.example.com":   testKeyRecord(t, rk, "rsa"),
+		TestSelector + "._domainkey." + TestDomain: testKeyRecord(t, ek, "ed25519"),
+	})
+
+	tests := []struct {
+		n    string
+		p    UnknownDomainPolicy
+		o    []Option
+		from string
+		d    string
+	}{
+		{"Known domain", LeaveUnsigned, nil, "toni.sender@example.com", "example.com"},
+		{"Known domain case-insensitive", LeaveUnsigned, nil, "toni.sender@EXAMPLE.com", "example.com"},
+		{"Subdomain unsigned", LeaveUnsigned, nil, "toni.sender@news.example.com", ""},
+		{"Subdomain fallback", SignWithFallback, nil, "toni.sender@news.example.com", TestDomain},
+		{
+			"Parent domain", LeaveUnsigned, []Option{WithParentDomains()}, "toni.sender@news.example.com",
+			"example.com",
+		},
+		{
+			"Parent domain of nested subdomain", SignWithFallback, []Option{WithParentDomains()},
+			"toni.sender@a.news.example.com", "example.com",
+		},
+		{"Parent domain unknown", LeaveUnsigned, []Option{WithParentDomains()}, "toni.sender@news.unknown.tld", ""},
+		{"Other known domain", LeaveUnsigned, nil, "toni.sender@test.tld", TestDomain},
+		{"Unknown domain unsigned", LeaveUnsigned, nil, "toni.sender@unknown.tld", ""},
+		{"Unknown domain fallback", SignWithFallback, nil, "toni.sender@unknown.tld", TestDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			mw, err := NewFromRegistry(r, tt.p, TestDomain, tt.o...)
+			if err != nil {
+				t.Fatalf("failed to generate new middleware: %s", err)
+			}
+			m := mail.NewMsg(mail.WithMiddleware(mw))
+			if err = m.From(tt.from); err != nil {
+				t.Fatalf("failed to set From address: %s", err)
+			}
+			rl := testVerifyRegistryMsg(t, m, lookup)
+			if tt.d == "" {
+				if len(rl) != 0 {
+					t.Errorf("mail for unknown domain was supposed to be unsigned, got %d signatures", len(rl))
+				}
+				return
+			}
+			if len(rl) != 1 {
+				t.Fatalf("expected 1 DKIM signature, got: %d", len(rl))
+			}
+			if rl[0].Domain != tt.d || !rl[0].Pass() {
+				t.Errorf("DKIM signature for d=%s did not verify: %s", rl[0].Domain, rl[0].Err)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_RegistrySender(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	r := make(MapRegistry)
+	r.Add(testRegistryConfig(t, TestDomain), rk)
+	mw, err := NewFromRegistry(r, LeaveUnsigned, "")
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.From("toni.sender@unknown.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.SetGenHeader("Sender", "Toni Sender <toni.sender@test.tld>")
+	rl := testVerifyRegistryMsg(t, m, testLookup(t, rk, "rsa"))
+	if len(rl) != 1 || !rl[0].Pass() {
+		t.Errorf("mail with Sender header was supposed to be signed for %s", TestDomain)
+	}
+}
+
+func TestRegistryFunc(t *testing.T) {
+	ek, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	sc := testRegistryConfig(t, TestDomain)
+	var called []string
+	rf := RegistryFunc(func(d string) ([]RegistryEntry, error) {
+		called = append(called, d)
+		if d != TestDomain {
+			return nil, ErrUnknownDomain
+		}
+		return []RegistryEntry{{Config: sc, Key: ek}}, nil
+	})
+	mw, err := NewFromRegistry(rf, LeaveUnsigned, "", WithParentDomains())
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.From("toni.sender@mail.test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	rl := testVerifyRegistryMsg(t, m, testLookup(t, ek, "ed25519"))
+	if len(rl) != 1 || !rl[0].Pass() {
+		t.Errorf("mail was supposed to be signed by the RegistryFunc signer")
+	}
+	if len(called) != 2 || called[0] != "mail.test.tld" || called[1] != TestDomain {
+		t.Errorf("RegistryFunc called with unexpected domains: %v", called)
+	}
+
+	errFailed := errors.New("registry failed")
+	rf = func(string) ([]RegistryEntry, error) {
+		return nil, errFailed
+	}
+	mw, err = NewFromRegistry(rf, SignWithFallback, TestDomain, WithLogger(log.New(io.Discard, "dkim", log.LevelWarn)))
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	m = mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	if rl = testVerifyRegistryMsg(t, m, testLookup(t, ek, "ed25519")); len(rl) != 0 {
+		t.Errorf("mail was not supposed to be signed on registry failure")
+	}
+}
+
+func TestNewDirRegistry(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"mail._domainkey.example.com.pem": rsaTestKey,
+		"ed._domainkey.example.com.pem":   ed25519TestKey,
+		"mail._domainkey.test.tld.pem":    rsaTestKeyPKCS8,
+		"README.txt":                      "not a key",
+		"example.com.pem":                 "not a key either",
+	}
+	for n, c := range files {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte(c), 0o600); err != nil {
+			t.Fatalf("failed to write test file: %s", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub._domainkey.example.com.pem"), 0o700); err != nil {
+		t.Fatalf("failed to create test directory: %s", err)
+	}
+
+	r, err := NewDirRegistry(dir, WithHeaderFields("From"))
+	if err != nil {
+		t.Fatalf("NewDirRegistry failed: %s", err)
+	}
+	el, err := r.Signers("Example.COM")
+	if err != nil {
+		t.Fatalf("failed to get signers for example.com: %s", err)
+	}
+	if len(el) != 2 {
+		t.Fatalf("expected 2 signers for example.com, got: %d", len(el))
+	}
+	for _, e := range el {
+		if e.Config.Domain != "example.com" || len(e.Config.HeaderFields) != 1 {
+			t.Errorf("unexpected SignerConfig: %+v", e.Config)
+		}
+	}
+	el, err = r.Signers(TestDomain)
+	if err != nil {
+		t.Fatalf("failed to get signers for %s: %s", TestDomain, err)
+	}
+	if len(el) != 1 || el[0].Config.Selector != TestSelector {
+		t.Errorf("unexpected signers for %s: %+v", TestDomain, el)
+	}
+	if _, err = r.Signers("unknown.tld"); !errors.Is(err, ErrUnknownDomain) {
+		t.Errorf("Signers for unknown domain was supposed to fail with ErrUnknownDomain, got: %v", err)
+	}
+
+	if _, err = NewDirRegistry(filepath.Join(dir, "nonexistent")); err == nil {
+		t.Errorf("NewDirRegistry with nonexistent directory was supposed to fail, but didn't")
+	}
+	if err = os.WriteFile(filepath.Join(dir, "bad._domainkey.example.com.pem"), []byte("invalid"),
+		0o600); err != nil {
+		t.Fatalf("failed to write test file: %s", err)
+	}
+	if _, err = NewDirRegistry(dir); !errors.Is(err, ErrDecodePEMFailed) {
+		t.Errorf("NewDirRegistry with invalid key was supposed to fail with ErrDecodePEMFailed, got: %v", err)
+	}
+}
+
+// testRegistryConfig returns a new SignerConfig for the given domain and the TestSelector
+func testRegistryConfig(t *testing.T, d string) *SignerConfig {
+	t.Helper()
+	sc, err := NewConfig(d, TestSelector)
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	return sc
+}
+
+// testVerifyRegistryMsg writes the given mail.Msg and returns the verification results
+// of its DKIM signatures
+func testVerifyRegistryMsg(t *testing.T, m *mail.Msg, lookup TXTLookupFunc) []*VerifyResult {
+	t.Helper()
+	m.Subject("This is a subject")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	rl, err := Verify(&buf, lookup)
+	if err != nil {
+		t.Fatalf("failed to verify DKIM signatures: %s", err)
+	}
+	return rl
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// DefaultExpiryWarning is the default period before the end of the validity of the
+// active key of a Rotation in which a warning is logged
+const DefaultExpiryWarning = time.Hour * 24 * 14
+
+var (
+	// ErrNoActiveKey is returned if no key of a Rotation is valid at signing time
+	ErrNoActiveKey = errors.New("no DKIM key of the rotation schedule is active")
+	// ErrNoRotation should be returned if a Rotation is needed but not provided
+	ErrNoRotation = errors.New("no rotation provided")
+	// ErrEmptySchedule should be returned if a Rotation without any RotationEntry is created
+	ErrEmptySchedule = errors.New("rotation schedule must not be empty")
+)
+
+// RotationEntry is a single key of a Rotation schedule, that is active between ValidFrom
+// and ValidUntil
+type RotationEntry struct {
+	// Selector is the DKIM domain selector under which the public key is published
+	Selector string
+	// Key is the private key used for signing
+	Key crypto.Signer
+	// ValidFrom is the time from which on the key is used for signing
+	ValidFrom time.Time
+	// ValidUntil is the time until which the key is used for signing. If it is zero,
+	// the key is valid until it is superseded by a later key
+	ValidUntil time.Time
+}
+
+// Rotation is a time-based schedule of DKIM keys. At signing time, the key of the
+// RotationEntry that is valid at that time and has the latest ValidFrom is used, so
+// that during an overlap of two keys the newer one is preferred
+type Rotation struct {
+	clock   func() time.Time
+	config  *SignerConfig
+	entries []RotationEntry
+	logger  *log.Logger
+	warn    time.Duration
+	warned  map[string]bool
+	mu      sync.Mutex
+}
+
+// RotationOption returns a function that can be used for grouping Rotation options
+type RotationOption func(r *Rotation)
+
+// NewRotation returns a new Rotation for the given SignerConfig and schedule. The
+// Selector of the SignerConfig is replaced with the Selector of the active RotationEntry
+// at signing time
+func NewRotation(sc *SignerConfig, el []RotationEntry, o ...RotationOption) (*Rotation, error) {
+	if sc == nil {
+		return nil, ErrNoConfig
+	}
+	if len(el) == 0 {
+		return nil, ErrEmptySchedule
+	}
+	for _, e := range el {
+		if e.Selector == "" {
+			return nil, ErrEmptySelector
+		}
+		if err := validateSigner(e.Key); err != nil {
+			return nil, fmt.Errorf("invalid key for selector %q: %w", e.Selector, err)
+		}
+		if !e.ValidUntil.IsZero() && !e.ValidUntil.After(e.ValidFrom) {
+			return nil, fmt.Errorf("validity of selector %q ends before it starts", e.Selector)
+		}
+	}
+	r := &Rotation{
+		clock:   time.Now,
+		config:  sc,
+		entries: el,
+		warn:    DefaultExpiryWarning,
+		warned:  make(map[string]bool),
+	}
+
+	// Override defaults with optionally provided Option functions
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		co(r)
+	}
+
+	if r.logger == nil {
+		r.logger = log.New(os.Stderr, "dkim", log.LevelWarn)
+	}
+	return r, nil
+}
+
+// NewFromRotation returns a new Middleware that signs each mail with the key of the
+// given Rotation that is active at signing time. If no key is active, the mail is
+// handled according to the FailurePolicy of the Middleware
+func NewFromRotation(r *Rotation, o ...Option) (*Middleware, error) {
+	if r == nil {
+		return nil, ErrNoRotation
+	}
+	d := &Middleware{rotation: r}
+	d.applyOptions(o)
+	return d, nil
+}
+
+// WithRotationClock sets the function that returns the current time for the Rotation.
+// If the SignerConfig of the Rotation has no Clock, it also provides the signing time of
+// the signatures. This is mainly useful for tests
+func WithRotationClock(c func() time.Time) RotationOption {
+	return func(r *Rotation) {
+		r.clock = c
+	}
+}
+
+// WithRotationLogger sets a log.Logger for the Rotation
+func WithRotationLogger(l *log.Logger) RotationOption {
+	return func(r *Rotation) {
+		r.logger = l
+	}
+}
+
+// WithExpiryWarning sets the period before the end of the validity of the active key
+// in which a warning is logged. A period of 0 disables the warning
+func WithExpiryWarning(d time.Duration) RotationOption {
+	return func(r *Rotation) {
+		r.warn = d
+	}
+}
+
+// Active returns the RotationEntry that is active at the current time of the clock
+// of the Rotation. If the active key is close to the end of its validity, a warning
+// is logged once per selector
+func (r *Rotation) Active() (*RotationEntry, error) {
+	now := r.clock()
+	var ae *RotationEntry
+	for i := range r.entries {
+		e := &r.entries[i]
+		if now.Before(e.ValidFrom) || (!e.ValidUntil.IsZero() && !now.Before(e.ValidUntil)) {
+			continue
+		}
+		if ae == nil || e.ValidFrom.After(ae.ValidFrom) {
+			ae = e
+		}
+	}
+	if ae == nil {
+		return nil, ErrNoActiveKey
+	}
+
+	if r.warn > 0 && !ae.ValidUntil.IsZero() && ae.ValidUntil.Sub(now) <= r.warn {
+		r.mu.Lock()
+		if !r.warned[ae.Selector] {
+			r.warned[ae.Selector] = true
+			r.logger.Warnf("DKIM key for selector %q of domain %q expires at %s", ae.Selector,
+				r.config.Domain, ae.ValidUntil.Format(time.RFC3339))
+		}
+		r.mu.Unlock()
+	}
+	return ae, nil
+}
+
+// signOptions returns the signerOptions for the active key of the Rotation
+func (r *Rotation) signOptions() (*signerOptions, error) {
+	e, err := r.Active()
+	if err != nil {
+		return nil, err
+	}
+	sc := *r.config
+	sc.Selector = e.Selector
+	if sc.Clock == nil {
+		sc.Clock = r.clock
+	}
+	return signOptions(&sc, e.Key)
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+func TestNewRotation(t *testing.T) {
+	sc := testRegistryConfig(t, TestDomain)
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	now := time.Now()
+	tests := []struct {
+		n  string
+		sc *SignerConfig
+		el []RotationEntry
+		sf bool
+	}{
+		{"Valid schedule", sc, []RotationEntry{{Selector: "q1", Key: rk}}, false},
+		{"No config", nil, []RotationEntry{{Selector: "q1", Key: rk}}, true},
+		{"Empty schedule", sc, nil, true},
+		{"Empty selector", sc, []RotationEntry{{Key: rk}}, true},
+		{"No key", sc, []RotationEntry{{Selector: "q1"}}, true},
+		{
+			"Invalid validity", sc,
+			[]RotationEntry{{Selector: "q1", Key: rk, ValidFrom: now, ValidUntil: now.Add(-time.Hour)}}, true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			_, err := NewRotation(tt.sc, tt.el)
+			if err != nil && !tt.sf {
+				t.Errorf("NewRotation failed: %s", err)
+			}
+			if err == nil && tt.sf {
+				t.Errorf("NewRotation was supposed to fail, but didn't")
+			}
+		})
+	}
+	if _, err = NewFromRotation(nil); !errors.Is(err, ErrNoRotation) {
+		t.Errorf("NewFromRotation without Rotation was supposed to fail with ErrNoRotation, got: %v", err)
+	}
+}
+
+func TestRotation_Active(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	q1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q2 := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	q3 := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	el := []RotationEntry{
+		{Selector: "2024q1", Key: rk, ValidFrom: q1, ValidUntil: q2.Add(time.Hour * 24 * 7)},
+		{Selector: "2024q2", Key: rk, ValidFrom: q2, ValidUntil: q3},
+	}
+	tests := []struct {
+		n   string
+		now time.Time
+		s   string
+	}{
+		{"Before schedule", q1.Add(-time.Second), ""},
+		{"First key", q1, "2024q1"},
+		{"Overlap prefers newer key", q2.Add(time.Hour), "2024q2"},
+		{"Second key", q3.Add(-time.Second), "2024q2"},
+		{"After schedule", q3, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			r, err := NewRotation(testRegistryConfig(t, TestDomain), el,
+				WithRotationClock(func() time.Time { return tt.now }), WithExpiryWarning(0))
+			if err != nil {
+				t.Fatalf("failed to create rotation: %s", err)
+			}
+			e, err := r.Active()
+			if tt.s == "" {
+				if !errors.Is(err, ErrNoActiveKey) {
+					t.Errorf("Active was supposed to fail with ErrNoActiveKey, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Active failed: %s", err)
+			}
+			if e.Selector != tt.s {
+				t.Errorf("Active failed, expected selector: %s, got: %s", tt.s, e.Selector)
+			}
+		})
+	}
+}
+
+func TestRotation_ExpiryWarning(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	until := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	now := until.Add(-time.Hour * 24 * 30)
+	buf := bytes.Buffer{}
+	r, err := NewRotation(testRegistryConfig(t, TestDomain),
+		[]RotationEntry{{Selector: "2024q1", Key: rk, ValidUntil: until}},
+		WithRotationClock(func() time.Time { return now }), WithExpiryWarning(time.Hour*24*7),
+		WithRotationLogger(log.New(&buf, "dkim", log.LevelWarn)))
+	if err != nil {
+		t.Fatalf("failed to create rotation: %s", err)
+	}
+	if _, err = r.Active(); err != nil {
+		t.Fatalf("Active failed: %s", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("no expiry warning expected 30 days before expiry, got: %s", buf.String())
+	}
+
+	now = until.Add(-time.Hour * 24 * 3)
+	for i := 0; i < 2; i++ {
+		if _, err = r.Active(); err != nil {
+			t.Fatalf("Active failed: %s", err)
+		}
+	}
+	if c := strings.Count(buf.String(), "WARN"); c != 1 {
+		t.Errorf("expected 1 expiry warning, got %d: %s", c, buf.String())
+	}
+	if !strings.Contains(buf.String(), `"2024q1"`) {
+		t.Errorf("expiry warning does not mention selector: %s", buf.String())
+	}
+}
+
+func TestMiddleware_Handle_Rotation(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	ek, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	now := time.Now()
+	r, err := NewRotation(testRegistryConfig(t, TestDomain), []RotationEntry{
+		{Selector: "old", Key: rk, ValidFrom: now.Add(-time.Hour * 48), ValidUntil: now.Add(-time.Hour)},
+		{Selector: "new", Key: ek, ValidFrom: now.Add(-time.Hour * 2)},
+	}, WithRotationClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("failed to create rotation: %s", err)
+	}
+	mw, err := NewFromRotation(r)
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	rl := testVerifyRegistryMsg(t, m, NewMapLookup(map[string]string{
+		"old._domainkey." + TestDomain: testKeyRecord(t, rk, "rsa"),
+		"new._domainkey." + TestDomain: testKeyRecord(t, ek, "ed25519"),
+	}))
+	if len(rl) != 1 {
+		t.Fatalf("expected 1 DKIM signature, got: %d", len(rl))
+	}
+	if rl[0].Selector != "new" || !rl[0].Pass() {
+		t.Errorf("DKIM signature with selector %q did not verify: %s", rl[0].Selector, rl[0].Err)
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+)
+
+// headerDKIMSignature is the name of the DKIM-Signature header field
+const headerDKIMSignature = "DKIM-Signature"
+
+// ErrNoHeaderEnd is returned if the end of the mail header could not be found
+var ErrNoHeaderEnd = mailauth.ErrNoHeaderEnd
+
+// sign returns the value of the DKIM-Signature header field for a mail message with
+// the given header fields and the body hash of the given BodyHasher. The signing time
+// is given with t
+// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-5
+func (so *signerOptions) sign(hl []mailauth.HeaderField, bh *mailauth.BodyHasher, t time.Time) (string, error) {
+	hn := make([]string, 0, len(hl))
+	for _, h := range hl {
+		hn = append(hn, h.Name)
+	}
+	hk := so.headerKeys(hn)
+
+	algo := "rsa"
+	var opts crypto.SignerOpts = so.hash()
+	if _, ok := so.Signer.Public().(ed25519.PublicKey); ok {
+		// Ed25519 signs the hash itself instead of a pre-hashed message
+		algo, opts = "ed25519", crypto.Hash(0)
+	}
+	// The tags are ordered alphabetically with the signature at the end, just like the
+	// signatures of previous versions, which were created by go-msgauth
+	tags := []string{
+		"a=" + algo + "-" + hashName(so.hash()), "bh=" + base64.StdEncoding.EncodeToString(bh.Sum()),
+		"c=" + string(canonicalization(so.HeaderCanonicalization)) + "/" +
+			string(canonicalization(so.BodyCanonicalization)),
+		"d=" + so.Domain, "h=" + strings.Join(hk, ":"),
+	}
+	if so.Identifier != "" {
+		tags = append(tags, "i="+so.Identifier)
+	}
+	if so.bodyLength != 0 {
+		tags = append(tags, "l="+strconv.FormatInt(bh.Length(), 10))
+	}
+	tags = append(tags, "s="+so.Selector, "t="+strconv.FormatInt(t.Unix(), 10), "v=1")
+	if x := so.expiration(t); !x.IsZero() {
+		// The expiration time must be after the signing time, otherwise the signature
+		// is invalid on arrival
+		if x.Unix() <= t.Unix() {
+			return "", fmt.Errorf("signature expired at %s: %w", x.Format(time.RFC3339), ErrInvalidExpiration)
+		}
+		tags = append(tags, "x="+strconv.FormatInt(x.Unix(), 10))
+	}
+	tags = append(tags, "b=")
+	v := mailauth.FoldTags(len(headerDKIMSignature), tags...)
+
+	h := so.hash().New()
+	hc := canonicalization(so.HeaderCanonicalization)
+	used := make([]bool, len(hl))
+	for _, k := range hk {
+		for i := len(hl) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(hl[i].Name, k) {
+				h.Write([]byte(mailauth.CanonicalHeader(hl[i], hc)))
+				used[i] = true
+				break
+			}
+		}
+	}
+	sh := mailauth.CanonicalHeader(mailauth.NewHeaderField(headerDKIMSignature, v), hc)
+	h.Write([]byte(strings.TrimSuffix(sh, mail.SingleNewLine)))
+
+	sig, err := so.Signer.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return "", err
+	}
+	b := base64.StdEncoding.EncodeToString(sig)
+	return v + mailauth.FoldValue(b, mailauth.LastLineLength(headerDKIMSignature+": "+v)), nil
+}
+
+// hash returns the hash algorithm of the signerOptions
+func (so *signerOptions) hash() crypto.Hash {
+	if so.Hash == 0 {
+		return crypto.SHA256
+	}
+	return so.Hash
+}
+
+// canonicalization returns the given dkim.Canonicalization or the default
+// canonicalization if it is empty
+func canonicalization(c dkim.Canonicalization) dkim.Canonicalization {
+	if c == "" {
+		return dkim.CanonicalizationSimple
+	}
+	return c
+}
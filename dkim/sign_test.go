@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// testFooter is a mailing list footer that is appended to the body of a signed mail
+const testFooter = "-- \r\nYou are receiving this mail because you are subscribed to the list\r\n"
+
+func TestMiddleware_Handle_UnicodeWhitespace(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	for _, c := range []dkim.Canonicalization{dkim.CanonicalizationRelaxed, dkim.CanonicalizationSimple} {
+		t.Run(string(c), func(t *testing.T) {
+			sc, err := NewConfig(TestDomain, TestSelector, WithHeaderCanonicalization(c),
+				WithBodyCanonicalization(c))
+			if err != nil {
+				t.Fatalf("failed to generate new config: %s", err)
+			}
+			mw, err := NewFromSigner(rk, sc)
+			if err != nil {
+				t.Fatalf("failed to generate new middleware: %s", err)
+			}
+			m := mail.NewMsg(mail.WithMiddleware(mw))
+			if err = m.From("toni.sender@test.tld"); err != nil {
+				t.Fatalf("failed to set From address: %s", err)
+			}
+			m.Subject("This is a subject")
+			m.SetDate()
+			// Only SP and HTAB are whitespace for the relaxed canonicalization, so the
+			// other whitespace characters must not be collapsed
+			m.SetGenHeaderPreformatted("X-Test", "\"a\u00a0b\"  \u00a0\v c\f\td ")
+			m.SetBodyString(mail.TypeTextPlain, "a\u00a0b  \u00a0\r\nline\vx \f\r\n")
+			buf := bytes.Buffer{}
+			if _, err = m.WriteTo(&buf); err != nil {
+				t.Fatalf("failed writing message to memory: %s", err)
+			}
+			if !strings.Contains(buf.String(), "X-Test: \"a\u00a0b\"") {
+				t.Fatalf("mail message does not contain the raw X-Test header")
+			}
+			verifyEmailWithDKIM(t, &buf, rk)
+		})
+	}
+}
+
+func TestMiddleware_Handle_BodyLength(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	body := "This is the mail body\r\n"
+	tests := []struct {
+		n  string
+		l  int64
+		ex string
+		// mod modifies the signed mail
+		mod func([]byte) []byte
+		ok  bool
+	}{
+		{"Whole body, footer appended", BodyLengthAll, "l=23", testAppendFooter, true},
+		{"Whole body, unmodified", BodyLengthAll, "l=23", nil, true},
+		{"Whole body, body modified", BodyLengthAll, "l=23", func(b []byte) []byte {
+			return bytes.Replace(b, []byte("mail body"), []byte("evil body"), 1)
+		}, false},
+		{"Limit, footer appended", 12, "l=12", testAppendFooter, true},
+		{"Limit, body modified after the limit", 12, "l=12", func(b []byte) []byte {
+			return bytes.Replace(b, []byte("mail body"), []byte("evil body"), 1)
+		}, true},
+		{"Limit, body modified within the limit", 12, "l=12", func(b []byte) []byte {
+			return bytes.Replace(b, []byte("This is"), []byte("This was"), 1)
+		}, false},
+		{"Limit longer than the body", 1000, "l=23", testAppendFooter, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			co, err := NewConfig(TestDomain, TestSelector, WithBodyLength(tt.l))
+			if err != nil {
+				t.Fatalf("failed to generate new config: %s", err)
+			}
+			mw, err := NewFromSigner(rk, co, WithLogger(log.New(io.Discard, "dkim", log.LevelWarn)))
+			if err != nil {
+				t.Fatalf("failed to generate new middleware: %s", err)
+			}
+			raw := testBodyLengthMail(t, mw, body)
+			if tt.mod != nil {
+				raw = tt.mod(raw)
+			}
+			tags := testSignatureTags(t, raw)
+			if "l="+tags["l"] != tt.ex {
+				t.Errorf("signature was supposed to have the tag %s, got: l=%s", tt.ex, tags["l"])
+			}
+			err = testVerifyBodyLength(raw, &rk.PublicKey)
+			if tt.ok && err != nil {
+				t.Errorf("signature was supposed to verify: %s", err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("signature was not supposed to verify")
+			}
+		})
+	}
+
+	t.Run("Without body length limit", func(t *testing.T) {
+		mw, err := NewFromSigner(rk, testRegistryConfig(t, TestDomain))
+		if err != nil {
+			t.Fatalf("failed to generate new middleware: %s", err)
+		}
+		raw := testBodyLengthMail(t, mw, body)
+		if _, ok := testSignatureTags(t, raw)["l"]; ok {
+			t.Errorf("signature was not supposed to have an l= tag")
+		}
+		rl, err := Verify(bytes.NewReader(testAppendFooter(raw)), testLookup(t, rk, "rsa"))
+		if err != nil {
+			t.Fatalf("failed to verify DKIM signatures: %s", err)
+		}
+		if len(rl) != 1 || rl[0].Pass() {
+			t.Errorf("mail with appended footer was not supposed to verify without l= tag")
+		}
+	})
+	t.Run("Verify rejects body length limit", func(t *testing.T) {
+		co, err := NewConfig(TestDomain, TestSelector, WithBodyLength(BodyLengthAll))
+		if err != nil {
+			t.Fatalf("failed to generate new config: %s", err)
+		}
+		var lb bytes.Buffer
+		mw, err := NewFromSigner(rk, co, WithLogger(log.New(&lb, "dkim", log.LevelWarn)))
+		if err != nil {
+			t.Fatalf("failed to generate new middleware: %s", err)
+		}
+		if !strings.Contains(lb.String(), "body length limit") {
+			t.Errorf("a warning about the body length limit was supposed to be logged, got: %s", lb.String())
+		}
+		rl, err := Verify(bytes.NewReader(testBodyLengthMail(t, mw, body)), testLookup(t, rk, "rsa"))
+		if err != nil {
+			t.Fatalf("failed to verify DKIM signatures: %s", err)
+		}
+		if len(rl) != 1 || rl[0].Status != VerifyFail {
+			t.Errorf("Verify was supposed to reject the signature with l= tag")
+		}
+	})
+}
+
+// testBodyLengthMail returns a mail with the given body that is signed by the given
+// Middleware
+func testBodyLengthMail(t *testing.T, mw *Middleware, body string) []byte {
+	t.Helper()
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err := m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetBodyString(mail.TypeTextPlain, body, mail.WithPartEncoding(mail.NoEncoding))
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// testAppendFooter appends the testFooter to the given mail, just like a mailing list
+func testAppendFooter(raw []byte) []byte {
+	return append(append([]byte(nil), raw...), testFooter...)
+}
+
+// testSignatureTags returns the tags of the DKIM-Signature header field of the given mail
+func testSignatureTags(t *testing.T, raw []byte) map[string]string {
+	t.Helper()
+	hl, _, err := mailauth.SplitMessage(raw)
+	if err != nil {
+		t.Fatalf("failed to parse mail message: %s", err)
+	}
+	for _, h := range hl {
+		if h.Name == headerDKIMSignature {
+			_, v, _ := strings.Cut(h.Raw, ":")
+			return signatureTags(v)
+		}
+	}
+	t.Fatalf("mail message has no DKIM-Signature header field")
+	return nil
+}
+
+// testVerifyBodyLength verifies the DKIM-Signature of the given mail with simple
+// canonicalization and a body length limit. It is a minimal verifier for the tests
+// only, since go-msgauth rejects all signatures with an l= tag
+func testVerifyBodyLength(raw []byte, pk *rsa.PublicKey) error {
+	hl, body, err := mailauth.SplitMessage(raw)
+	if err != nil {
+		return err
+	}
+	var sh mailauth.HeaderField
+	for _, h := range hl {
+		if h.Name == headerDKIMSignature {
+			sh = h
+		}
+	}
+	_, v, _ := strings.Cut(sh.Raw, ":")
+	tags := signatureTags(v)
+
+	// Canonicalize the body from scratch instead of using the bodyHasher
+	cb := strings.ReplaceAll(string(body), "\r\n", "\n")
+	cb = strings.ReplaceAll(strings.TrimRight(cb, "\n")+"\n", "\n", "\r\n")
+	l, err := strconv.Atoi(tags["l"])
+	if err != nil || l > len(cb) {
+		return errors.New("invalid body length")
+	}
+	bh := sha256.Sum256([]byte(cb[:l]))
+	if base64.StdEncoding.EncodeToString(bh[:]) != tags["bh"] {
+		return errors.New("body hash mismatch")
+	}
+
+	h := sha256.New()
+	used := make(map[int]bool)
+	for _, k := range strings.Split(tags["h"], ":") {
+		for i := len(hl) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(hl[i].Name, k) {
+				h.Write([]byte(hl[i].Raw))
+				used[i] = true
+				break
+			}
+		}
+	}
+	h.Write([]byte(strings.TrimSuffix(regexp.MustCompile(`b=[^;]+$`).ReplaceAllString(sh.Raw, "b="), "\r\n")))
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return err
+	}
+	return rsa.VerifyPKCS1v15(pk, crypto.SHA256, h.Sum(nil), sig)
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"strings"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/internal/mailauth"
+)
+
+// SignaturePolicy is an alias type for an int
+type SignaturePolicy int
+
+const (
+	// ReplaceOwnSignatures will prepend the new DKIM signatures to the DKIM-Signature
+	// headers that the mail.Msg already carries and remove the stale signatures of the
+	// Middleware itself, i.e. the signatures with the domain and selector of one of the
+	// signers. This makes signing idempotent, e.g. if a mail.Msg is written again on a
+	// retry. This is the default
+	ReplaceOwnSignatures SignaturePolicy = iota
+	// KeepSignatures will prepend the new DKIM signatures to all DKIM-Signature headers
+	// that the mail.Msg already carries
+	KeepSignatures
+)
+
+// WithSignaturePolicy sets the SignaturePolicy for DKIM-Signature headers that the
+// mail.Msg already carries when it is handled by the Middleware. The signatures of
+// upstream systems are kept with both policies
+func WithSignaturePolicy(p SignaturePolicy) Option {
+	return func(d *Middleware) {
+		d.sigPolicy = p
+	}
+}
+
+// String satisfies the fmt.Stringer interface for the SignaturePolicy type
+func (p SignaturePolicy) String() string {
+	switch p {
+	case ReplaceOwnSignatures:
+		return "replace-own"
+	case KeepSignatures:
+		return "keep"
+	default:
+		return "unknown"
+	}
+}
+
+// existingSignatures handles the DKIM-Signature headers of the given header fields of
+// the mail.Msg according to the SignaturePolicy of the Middleware. It returns the header
+// fields without the removed signatures and the values of the signatures that have to
+// be written again along with the new signatures.
+//
+// The Middleware sets its signatures as preformatted header, which replaces all
+// signatures that have been set as preformatted header before. Signatures that have been
+// set as generic header of the mail.Msg are not affected, so they are always kept
+func (d Middleware) existingSignatures(m *mail.Msg, hl []mailauth.HeaderField, sol []*signerOptions) (
+	[]mailauth.HeaderField, []string,
+) {
+	skip := len(m.GetGenHeader(headerDKIMSignature)) > 0
+	fl := make([]mailauth.HeaderField, 0, len(hl))
+	var sl []string
+	for _, h := range hl {
+		if !strings.EqualFold(h.Name, headerDKIMSignature) {
+			fl = append(fl, h)
+			continue
+		}
+		if skip {
+			// The first DKIM-Signature header is the generic header
+			skip = false
+			fl = append(fl, h)
+			continue
+		}
+		_, v, _ := strings.Cut(h.Raw, ":")
+		v = strings.TrimSuffix(strings.TrimPrefix(v, " "), mail.SingleNewLine)
+		if d.sigPolicy == ReplaceOwnSignatures && ownSignature(v, sol) {
+			continue
+		}
+		fl = append(fl, h)
+		sl = append(sl, v)
+	}
+	return fl, sl
+}
+
+// ownSignature returns true if the given DKIM-Signature header value has the domain and
+// selector of one of the given signerOptions
+func ownSignature(v string, sol []*signerOptions) bool {
+	tm := signatureTags(v)
+	for _, so := range sol {
+		if strings.EqualFold(tm["d"], so.Domain) && strings.EqualFold(tm["s"], so.Selector) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-mail"
+)
+
+func TestSignaturePolicy_String(t *testing.T) {
+	tests := []struct {
+		p  SignaturePolicy
+		ex string
+	}{
+		{ReplaceOwnSignatures, "replace-own"},
+		{KeepSignatures, "keep"},
+		{SignaturePolicy(99), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ex, func(t *testing.T) {
+			if tt.p.String() != tt.ex {
+				t.Errorf("SignaturePolicy.String failed, expected: %s, got: %s", tt.ex, tt.p.String())
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_ExistingSignatures(t *testing.T) {
+	uc, err := NewConfig("upstream.tld", "up")
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	up, err := NewFromEd25519Key([]byte(ed25519TestKey), uc)
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	co, err := NewConfig(TestDomain, TestSelector)
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	tests := []struct {
+		n  string
+		p  SignaturePolicy
+		ex []string
+	}{
+		{"replace own signatures", ReplaceOwnSignatures, []string{TestDomain, "upstream.tld"}},
+		{"keep signatures", KeepSignatures, []string{TestDomain, TestDomain, "upstream.tld"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			mw, err := NewFromRSAKey([]byte(rsaTestKey), co, WithSignaturePolicy(tt.p))
+			if err != nil {
+				t.Fatalf("failed to generate new middleware: %s", err)
+			}
+			m := mail.NewMsg()
+			if err = m.From("toni.sender@test.tld"); err != nil {
+				t.Fatalf("failed to set From address: %s", err)
+			}
+			m.Subject("This is a subject")
+			m.SetDate()
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+
+			// The mail is signed upstream first and then twice by the Middleware, e.g. on
+			// a retry
+			m = mw.Handle(mw.Handle(up.Handle(m)))
+			buf := bytes.Buffer{}
+			if _, err = m.WriteTo(&buf); err != nil {
+				t.Fatalf("failed writing message to memory: %s", err)
+			}
+			rl, err := Verify(&buf, NewMapLookup(map[string]string{
+				TestSelector + "._domainkey." + TestDomain: testKeyRecord(t, mw.so[0].Signer, "rsa"),
+				"up._domainkey.upstream.tld":               testKeyRecord(t, up.so[0].Signer, "ed25519"),
+			}))
+			if err != nil {
+				t.Fatalf("failed to verify DKIM signatures: %s", err)
+			}
+			if len(rl) != len(tt.ex) {
+				t.Fatalf("expected %d verification results, got: %d", len(tt.ex), len(rl))
+			}
+			for i, ex := range tt.ex {
+				if rl[i].Domain != ex {
+					t.Errorf("expected DKIM signature %d of domain %q, got: %q", i, ex, rl[i].Domain)
+				}
+				if !rl[i].Pass() {
+					t.Errorf("DKIM signature %d (d=%s) did not verify: %s", i, rl[i].Domain, rl[i].Err)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_GenericSignature(t *testing.T) {
+	co, err := NewConfig(TestDomain, TestSelector)
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	mw, err := NewFromRSAKey([]byte(rsaTestKey), co)
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+
+	// A signature that is set as generic header is kept, even if it has the domain and
+	// selector of the Middleware
+	m.SetGenHeader(headerDKIMSignature, "v=1; d=test.tld; s=mail; b=")
+	for i := 0; i < 2; i++ {
+		buf := bytes.Buffer{}
+		if _, err = m.WriteTo(&buf); err != nil {
+			t.Fatalf("failed writing message to memory: %s", err)
+		}
+		if c := strings.Count(buf.String(), "DKIM-Signature: "); c != 2 {
+			t.Errorf("expected 2 DKIM-Signature headers, got: %d", c)
+		}
+		if c := strings.Count(buf.String(), "DKIM-Signature: v=1; d=test.tld; s=mail; b=\r\n"); c != 1 {
+			t.Errorf("expected generic DKIM-Signature header once, got: %d", c)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// errRemoteUnavailable is the error returned by the remoteSigner for failing calls
+var errRemoteUnavailable = errors.New("remote signer unavailable")
+
+// remoteSigner is a test double for a crypto.Signer that is backed by a remote service
+// like a KMS or an HSM. Each signing operation is delayed by the latency. The calls
+// listed in fail (counted from 1) fail with errRemoteUnavailable, the calls listed in
+// corrupt return a corrupted signature
+type remoteSigner struct {
+	crypto.Signer
+	latency time.Duration
+	fail    map[int]bool
+	corrupt map[int]bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+// Sign satisfies the crypto.Signer interface for the remoteSigner type
+func (r *remoteSigner) Sign(rd io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	r.mu.Lock()
+	r.calls++
+	c := r.calls
+	r.mu.Unlock()
+
+	time.Sleep(r.latency)
+	if r.fail[c] {
+		return nil, errRemoteUnavailable
+	}
+	sig, err := r.Signer.Sign(rd, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	if r.corrupt[c] {
+		sig[0] ^= 0xff
+	}
+	return sig, nil
+}
+
+// publicKeySigner is a crypto.Signer that only provides a public key
+type publicKeySigner struct {
+	crypto.Signer
+	pub crypto.PublicKey
+}
+
+// Public satisfies the crypto.Signer interface for the publicKeySigner type
+func (p publicKeySigner) Public() crypto.PublicKey {
+	return p.pub
+}
+
+func TestNewFromSigner(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	ek, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	ck, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %s", err)
+	}
+	short := publicKeySigner{pub: &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 511), E: 65537}}
+
+	tests := []struct {
+		n  string
+		cs crypto.Signer
+		e  error
+	}{
+		{"RSA 1024 bits", rk, nil},
+		{"Ed25519", ek, nil},
+		{"Remote signer", &remoteSigner{Signer: rk}, nil},
+		{"RSA 512 bits", short, ErrKeyTooShort},
+		{"ECDSA", ck, ErrUnsupportedKey},
+		{"Nil signer", nil, ErrNoSigner},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			_, err := NewFromSigner(tt.cs, testRegistryConfig(t, TestDomain))
+			if !errors.Is(err, tt.e) {
+				t.Errorf("NewFromSigner failed, expected error: %v, got: %v", tt.e, err)
+			}
+		})
+	}
+	if _, err = NewFromSigner(rk, nil); !errors.Is(err, ErrNoConfig) {
+		t.Errorf("NewFromSigner without config was supposed to fail with ErrNoConfig, got: %v", err)
+	}
+}
+
+func TestMiddleware_Handle_RemoteSigner(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	ek, err := ParseEd25519Key([]byte(ed25519TestKey))
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 key: %s", err)
+	}
+	lookup := testLookup(t, rk, "rsa")
+
+	t.Run("Latency", func(t *testing.T) {
+		rs := &remoteSigner{Signer: rk, latency: time.Millisecond * 50}
+		mw, err := NewFromSigner(rs, testRegistryConfig(t, TestDomain))
+		if err != nil {
+			t.Fatalf("failed to generate new middleware: %s", err)
+		}
+		start := time.Now()
+		rl := testRemoteSignerMsg(t, mw, lookup)
+		if d := time.Since(start); d < rs.latency {
+			t.Errorf("signing was supposed to take at least %s, took: %s", rs.latency, d)
+		}
+		if len(rl) != 1 || !rl[0].Pass() {
+			t.Errorf("mail signed by slow remote signer did not verify")
+		}
+	})
+	t.Run("Failure and recovery", func(t *testing.T) {
+		var herr error
+		rs := &remoteSigner{Signer: rk, fail: map[int]bool{1: true}}
+		mw, err := NewFromSigner(rs, testRegistryConfig(t, TestDomain),
+			WithLogger(log.New(io.Discard, "dkim", log.LevelWarn)),
+			WithErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+		if err != nil {
+			t.Fatalf("failed to generate new middleware: %s", err)
+		}
+		if rl := testRemoteSignerMsg(t, mw, lookup); len(rl) != 0 {
+			t.Errorf("mail was not supposed to be signed while the remote signer is unavailable")
+		}
+		if !errors.Is(herr, errRemoteUnavailable) {
+			t.Errorf("ErrorHandler was supposed to be called with the remote signer error, got: %v", herr)
+		}
+		if rl := testRemoteSignerMsg(t, mw, lookup); len(rl) != 1 || !rl[0].Pass() {
+			t.Errorf("mail was supposed to be signed after the remote signer recovered")
+		}
+	})
+	t.Run("Failure of one of multiple signers", func(t *testing.T) {
+		rs := &remoteSigner{Signer: ek, fail: map[int]bool{1: true}}
+		mw, err := NewFromSigner(rk, testRegistryConfig(t, TestDomain), WithFailurePolicy(FailMark),
+			WithLogger(log.New(io.Discard, "dkim", log.LevelWarn)))
+		if err != nil {
+			t.Fatalf("failed to generate new middleware: %s", err)
+		}
+		ec, err := NewConfig(TestDomain, "ed")
+		if err != nil {
+			t.Fatalf("failed to generate new config: %s", err)
+		}
+		if err = mw.AddSigner(ec, rs); err != nil {
+			t.Fatalf("failed to add remote signer: %s", err)
+		}
+		buf := testRemoteSignerMail(t, mw)
+		if strings.Contains(buf.String(), "DKIM-Signature: ") {
+			t.Errorf("mail was not supposed to be partially signed")
+		}
+		if !strings.Contains(buf.String(), string(HeaderError)+": ") {
+			t.Errorf("mail was supposed to be marked with %s", HeaderError)
+		}
+	})
+	t.Run("Corrupt signature", func(t *testing.T) {
+		rs := &remoteSigner{Signer: rk, corrupt: map[int]bool{1: true}}
+		mw, err := NewFromSigner(rs, testRegistryConfig(t, TestDomain))
+		if err != nil {
+			t.Fatalf("failed to generate new middleware: %s", err)
+		}
+		rl := testRemoteSignerMsg(t, mw, lookup)
+		if len(rl) != 1 || rl[0].Status != VerifyFail {
+			t.Errorf("mail with corrupt signature was supposed to fail verification")
+		}
+	})
+}
+
+// testRemoteSignerMail returns a mail that is signed by the given Middleware
+func testRemoteSignerMail(t *testing.T, mw *Middleware) *bytes.Buffer {
+	t.Helper()
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err := m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	return &buf
+}
+
+// testRemoteSignerMsg returns the verification results of a mail that is signed by the
+// given Middleware
+func testRemoteSignerMsg(t *testing.T, mw *Middleware, lookup TXTLookupFunc) []*VerifyResult {
+	t.Helper()
+	rl, err := Verify(testRemoteSignerMail(t, mw), lookup)
+	if err != nil {
+		t.Fatalf("failed to verify DKIM signatures: %s", err)
+	}
+	return rl
+}
+
+func TestNewFromSigner_invalidConfig(t *testing.T) {
+	rk, err := ParseRSAKey([]byte(rsaTestKey))
+	if err != nil {
+		t.Fatalf("failed to parse RSA key: %s", err)
+	}
+	tests := []struct {
+		n  string
+		f  func(*SignerConfig)
+		ex error
+	}{
+		{"Hash algorithm", func(sc *SignerConfig) { sc.HashAlgo = crypto.SHA1 }, ErrInvalidHashAlgo},
+		{"Header canonicalization", func(sc *SignerConfig) { sc.CanonicalizationHeader = "foo" }, ErrInvalidCanonicalization},
+		{"Body canonicalization", func(sc *SignerConfig) { sc.CanonicalizationBody = "foo" }, ErrInvalidCanonicalization},
+		{"Header fields without From", func(sc *SignerConfig) { sc.HeaderFields = []string{"To"} }, ErrFromRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			sc := testRegistryConfig(t, TestDomain)
+			tt.f(sc)
+			if _, err := NewFromSigner(rk, sc); !errors.Is(err, tt.ex) {
+				t.Errorf("NewFromSigner was supposed to fail with %q, got: %v", tt.ex, err)
+			}
+		})
+	}
+}
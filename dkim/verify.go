@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/wneessen/go-mail"
+)
+
+// VerifyStatus is an alias type for an int
+type VerifyStatus int
+
+const (
+	// VerifyPass is the VerifyStatus of a valid signature
+	VerifyPass VerifyStatus = iota
+	// VerifyFail is the VerifyStatus of a signature that did not verify, e.g. because
+	// the mail was altered after signing
+	VerifyFail
+	// VerifyTempError is the VerifyStatus of a signature that could not be verified
+	// due to a temporary error, e.g. a DNS timeout
+	VerifyTempError
+	// VerifyPermError is the VerifyStatus of a signature that can never be verified,
+	// e.g. because it is malformed or the public key does not exist
+	VerifyPermError
+)
+
+// VerifyResult is the result of the verification of a single DKIM signature
+type VerifyResult struct {
+	// Algorithm is the signing algorithm of the signature ("a=" tag), e.g. "rsa-sha256"
+	Algorithm string
+	// Domain is the Signing Domain Identifier (SDID) of the signature ("d=" tag)
+	Domain string
+	// Err is the reason why the signature did not pass the verification. Err is nil
+	// if the Status is VerifyPass
+	Err error
+	// Expiration is the expiration time of the signature ("x=" tag). It is the zero
+	// time if the signature does not expire
+	Expiration time.Time
+	// HeaderKeys is the list of signed header fields ("h=" tag)
+	HeaderKeys []string
+	// Identifier is the Agent or User Identifier (AUID) of the signature ("i=" tag)
+	Identifier string
+	// Selector is the domain selector of the signature ("s=" tag)
+	Selector string
+	// Status is the VerifyStatus of the signature
+	Status VerifyStatus
+	// Time is the signing time of the signature ("t=" tag). It is the zero time if
+	// the signature has no signing time
+	Time time.Time
+}
+
+// dkimHeader is the canonical name of the DKIM-Signature header field
+const dkimHeader = "DKIM-Signature"
+
+// Verify verifies all DKIM signatures of the raw mail message read from r and returns
+// a VerifyResult for each signature, in the order of the DKIM-Signature header fields
+// of the message. The public keys are looked up with the given TXTLookupFunc. If the
+// TXTLookupFunc is nil, the DNS is queried with net.LookupTXT.
+//
+// A message without a DKIM-Signature header field results in an empty list. An error
+// is only returned if the message could not be read or parsed
+func Verify(r io.Reader, lookup TXTLookupFunc) ([]*VerifyResult, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mail message: %w", err)
+	}
+	tr := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw)))
+	h, err := tr.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse mail message header: %w", err)
+	}
+
+	vl, err := dkim.VerifyWithOptions(bytes.NewReader(raw), &dkim.VerifyOptions{LookupTXT: lookup})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify DKIM signatures: %w", err)
+	}
+	sl := h.Values(dkimHeader)
+	rl := make([]*VerifyResult, 0, len(vl))
+	for i, v := range vl {
+		vr := &VerifyResult{
+			Domain:     v.Domain,
+			Err:        v.Err,
+			Expiration: v.Expiration,
+			HeaderKeys: v.HeaderKeys,
+			Identifier: v.Identifier,
+			Status:     verifyStatus(v.Err),
+			Time:       v.Time,
+		}
+		if i < len(sl) {
+			t := signatureTags(sl[i])
+			vr.Algorithm = t["a"]
+			vr.Selector = t["s"]
+			if vr.Domain == "" {
+				vr.Domain = t["d"]
+			}
+		}
+		rl = append(rl, vr)
+	}
+	return rl, nil
+}
+
+// VerifyMsg verifies all DKIM signatures of the given mail.Msg. The mail.Msg is written
+// including all its middlewares, so that a mail.Msg that uses the DKIM Middleware can
+// be verified before it is sent. See Verify for details
+func VerifyMsg(m *mail.Msg, lookup TXTLookupFunc) ([]*VerifyResult, error) {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write mail message: %w", err)
+	}
+	return Verify(&buf, lookup)
+}
+
+// Pass returns true if the signature of the VerifyResult is valid
+func (vr *VerifyResult) Pass() bool {
+	return vr.Status == VerifyPass
+}
+
+// String satisfies the fmt.Stringer interface for the VerifyStatus type. The returned
+// values are the result names of RFC 8601 Authentication-Results header fields
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyPass:
+		return "pass"
+	case VerifyFail:
+		return "fail"
+	case VerifyTempError:
+		return "temperror"
+	case VerifyPermError:
+		return "permerror"
+	default:
+		return "unknown"
+	}
+}
+
+// verifyStatus returns the VerifyStatus for the given verification error
+func verifyStatus(err error) VerifyStatus {
+	switch {
+	case err == nil:
+		return VerifyPass
+	case dkim.IsTempFail(err):
+		return VerifyTempError
+	case dkim.IsPermFail(err):
+		return VerifyPermError
+	default:
+		return VerifyFail
+	}
+}
+
+// signatureTags returns the tags of the given DKIM-Signature header field value as map
+// of tag names to tag values. All whitespace is removed from the tag values
+func signatureTags(s string) map[string]string {
+	tm := make(map[string]string)
+	for _, t := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(t, "=")
+		if !ok {
+			continue
+		}
+		tm[strings.TrimSpace(k)] = strings.Join(strings.Fields(v), "")
+	}
+	return tm
+}
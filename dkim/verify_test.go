@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-mail"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		n  string
+		k  string
+		f  func([]byte, *SignerConfig, ...Option) (*Middleware, error)
+		kt string
+		a  string
+	}{
+		{"RSA", rsaTestKey, NewFromRSAKey, "rsa", "rsa-sha256"},
+		{"Ed25519", ed25519TestKey, NewFromEd25519Key, "ed25519", "ed25519-sha256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			mw := testMiddleware(t, tt.k, tt.f)
+			buf := testSignedMail(t, mw)
+			rl, err := Verify(buf, testLookup(t, mw.so[0].Signer, tt.kt))
+			if err != nil {
+				t.Fatalf("Verify failed: %s", err)
+			}
+			if len(rl) != 1 {
+				t.Fatalf("Verify failed. Expected 1 result, got: %d", len(rl))
+			}
+			r := rl[0]
+			if !r.Pass() {
+				t.Errorf("Verify failed. Expected status: %s, got: %s (%s)", VerifyPass, r.Status, r.Err)
+			}
+			if r.Domain != TestDomain {
+				t.Errorf("Verify failed. Expected domain: %s, got: %s", TestDomain, r.Domain)
+			}
+			if r.Selector != TestSelector {
+				t.Errorf("Verify failed. Expected selector: %s, got: %s", TestSelector, r.Selector)
+			}
+			if r.Algorithm != tt.a {
+				t.Errorf("Verify failed. Expected algorithm: %s, got: %s", tt.a, r.Algorithm)
+			}
+			if len(r.HeaderKeys) == 0 || !strings.EqualFold(r.HeaderKeys[0], "From") {
+				t.Errorf("Verify failed. Expected header keys: [From], got: %s", r.HeaderKeys)
+			}
+		})
+	}
+}
+
+func TestVerify_fails(t *testing.T) {
+	mw := testMiddleware(t, rsaTestKey, NewFromRSAKey)
+	lookup := testLookup(t, mw.so[0].Signer, "rsa")
+	tests := []struct {
+		n  string
+		m  func(string) string
+		l  TXTLookupFunc
+		vs VerifyStatus
+	}{
+		{
+			"altered body",
+			func(s string) string { return strings.Replace(s, "This is the mail body", "This is another body", 1) },
+			lookup, VerifyFail,
+		},
+		{
+			"public key not found", func(s string) string { return s },
+			NewMapLookup(map[string]string{}), VerifyPermError,
+		},
+		{
+			"temporary DNS error", func(s string) string { return s },
+			func(domain string) ([]string, error) {
+				return nil, &net.DNSError{Err: "i/o timeout", Name: domain, IsTimeout: true}
+			}, VerifyTempError,
+		},
+		{
+			"malformed signature",
+			func(s string) string { return strings.Replace(s, "a=rsa-sha256", "a=rsa", 1) },
+			lookup, VerifyPermError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			buf := testSignedMail(t, mw)
+			rl, err := Verify(strings.NewReader(tt.m(buf.String())), tt.l)
+			if err != nil {
+				t.Fatalf("Verify failed: %s", err)
+			}
+			if len(rl) != 1 {
+				t.Fatalf("Verify failed. Expected 1 result, got: %d", len(rl))
+			}
+			if rl[0].Status != tt.vs {
+				t.Errorf("Verify failed. Expected status: %s, got: %s", tt.vs, rl[0].Status)
+			}
+			if rl[0].Err == nil {
+				t.Errorf("Verify failed. Expected an error for failed verification")
+			}
+			if rl[0].Domain != TestDomain {
+				t.Errorf("Verify failed. Expected domain: %s, got: %s", TestDomain, rl[0].Domain)
+			}
+		})
+	}
+}
+
+func TestVerify_noSignature(t *testing.T) {
+	m := mail.NewMsg()
+	m.Subject("This is a subject")
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	rl, err := VerifyMsg(m, NewMapLookup(nil))
+	if err != nil {
+		t.Fatalf("VerifyMsg failed: %s", err)
+	}
+	if len(rl) != 0 {
+		t.Errorf("VerifyMsg failed. Expected no results, got: %d", len(rl))
+	}
+}
+
+func TestVerifyMsg(t *testing.T) {
+	mw := testMiddleware(t, ed25519TestKey, NewFromEd25519Key)
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err := m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	rl, err := VerifyMsg(m, testLookup(t, mw.so[0].Signer, "ed25519"))
+	if err != nil {
+		t.Fatalf("VerifyMsg failed: %s", err)
+	}
+	if len(rl) != 1 || !rl[0].Pass() {
+		t.Errorf("VerifyMsg failed. Expected a single passing result, got: %+v", rl)
+	}
+}
+
+func TestVerifyStatus_String(t *testing.T) {
+	tests := []struct {
+		s  VerifyStatus
+		ex string
+	}{
+		{VerifyPass, "pass"},
+		{VerifyFail, "fail"},
+		{VerifyTempError, "temperror"},
+		{VerifyPermError, "permerror"},
+		{999, "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ex, func(t *testing.T) {
+			if tt.s.String() != tt.ex {
+				t.Errorf("VerifyStatus.String failed. Expected: %s, got: %s", tt.ex, tt.s.String())
+			}
+		})
+	}
+}
+
+func TestSignatureTags(t *testing.T) {
+	tm := signatureTags("v=1; a=rsa-sha256; d=test.tld;\r\n s=mail; h=From:\r\n\tTo; b=abc\r\n def")
+	ex := map[string]string{"v": "1", "a": "rsa-sha256", "d": "test.tld", "s": "mail", "h": "From:To", "b": "abcdef"}
+	for k, v := range ex {
+		if tm[k] != v {
+			t.Errorf("signatureTags failed. Expected %s=%s, got: %s", k, v, tm[k])
+		}
+	}
+}
+
+// testMiddleware returns a new Middleware for the TestDomain and TestSelector that
+// signs the From header field
+func testMiddleware(t *testing.T, k string, f func([]byte, *SignerConfig, ...Option) (*Middleware, error)) *Middleware {
+	t.Helper()
+	co, err := NewConfig(TestDomain, TestSelector, WithHeaderFields("From"))
+	if err != nil {
+		t.Fatalf("failed to generate new config: %s", err)
+	}
+	mw, err := f([]byte(k), co)
+	if err != nil {
+		t.Fatalf("failed to generate new middleware: %s", err)
+	}
+	return mw
+}
+
+// testSignedMail returns a mail that is signed by the given Middleware
+func testSignedMail(t *testing.T, mw *Middleware) *bytes.Buffer {
+	t.Helper()
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err := m.From("toni.sender@test.tld"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	return &buf
+}
+
+// testLookup returns a TXTLookupFunc that serves the DKIM key record of the given
+// crypto.Signer for the TestDomain and TestSelector
+func testLookup(t *testing.T, sk crypto.Signer, kt string) TXTLookupFunc {
+	t.Helper()
+	return NewMapLookup(map[string]string{
+		fmt.Sprintf("%s._domainkey.%s", TestSelector, TestDomain): testKeyRecord(t, sk, kt),
+	})
+}
+
+// testKeyRecord returns the DKIM key record of the given crypto.Signer
+func testKeyRecord(t *testing.T, sk crypto.Signer, kt string) string {
+	t.Helper()
+	pk, err := x509.MarshalPKIXPublicKey(sk.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %s", err)
+	}
+	if kt == "ed25519" {
+		// Ed25519 keys are published as raw public key instead of a SubjectPublicKeyInfo
+		pk = pk[len(pk)-ed25519.PublicKeySize:]
+	}
+	return fmt.Sprintf("v=DKIM1; k=%s; p=%s", kt, base64.StdEncoding.EncodeToString(pk))
+}
@@ -7,6 +7,7 @@ module github.com/wneessen/go-mail-middleware
 go 1.25.0
 
 require (
+	github.com/ProtonMail/go-crypto v1.4.1
 	github.com/ProtonMail/gopenpgp/v2 v2.10.0
 	github.com/emersion/go-msgauth v0.7.0
 	github.com/wneessen/go-mail v0.7.3
@@ -14,7 +15,6 @@ require (
 )
 
 require (
-	github.com/ProtonMail/go-crypto v1.4.1 // indirect
 	github.com/ProtonMail/go-mime v0.0.0-20230322103455-7d82a3887f2f // indirect
 	github.com/cloudflare/circl v1.6.3 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
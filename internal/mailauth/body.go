@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package mailauth
+
+import (
+	"bytes"
+	"crypto"
+	"hash"
+	"io"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+)
+
+var (
+	// crlfBytes is the line ending of a canonicalized body line. It is allocated once, so
+	// that hashing a line does not allocate
+	crlfBytes = []byte(crlf)
+	// cr is the carriage return that is removed from the end of a body line
+	cr = []byte("\r")
+)
+
+// BodyHasher is an io.WriteCloser that canonicalizes a mail body and computes its body
+// hash. If a limit is set, only the first limit bytes of the canonicalized body are
+// hashed
+// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-3.4.3
+type BodyHasher struct {
+	h       hash.Hash
+	relaxed bool
+	limit   int64
+	// n is the length of the canonicalized body
+	n int64
+	// line is the incomplete line of the last write
+	line []byte
+	// empty is the number of empty lines that have not been written yet, since empty
+	// lines at the end of the body are ignored
+	empty int
+}
+
+// NewBodyHasher returns a new BodyHasher for the given hash algorithm, canonicalization
+// and limit. A limit of 0 or less hashes the complete body
+func NewBodyHasher(ha crypto.Hash, c msgauth.Canonicalization, limit int64) *BodyHasher {
+	return &BodyHasher{h: ha.New(), relaxed: c == msgauth.CanonicalizationRelaxed, limit: limit}
+}
+
+// Write satisfies the io.Writer interface for the BodyHasher type
+func (b *BodyHasher) Write(p []byte) (int, error) {
+	l := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			b.line = append(b.line, p...)
+			break
+		}
+		b.line = append(b.line, p[:i]...)
+		b.writeLine()
+		p = p[i+1:]
+	}
+	return l, nil
+}
+
+// Close satisfies the io.Closer interface for the BodyHasher type. It flushes the last
+// line of the body. The body hash is only complete after Close has been called
+func (b *BodyHasher) Close() error {
+	if len(b.line) > 0 {
+		b.writeLine()
+	}
+	// An empty body is canonicalized to a single CRLF with the "simple" algorithm
+	if b.n == 0 && !b.relaxed {
+		b.write(crlfBytes)
+	}
+	return nil
+}
+
+// Sum returns the body hash
+func (b *BodyHasher) Sum() []byte {
+	return b.h.Sum(nil)
+}
+
+// Length returns the number of bytes of the canonicalized body that have been hashed
+func (b *BodyHasher) Length() int64 {
+	if b.limit > 0 && b.n > b.limit {
+		return b.limit
+	}
+	return b.n
+}
+
+// writeLine canonicalizes the current line and writes it to the hash. Empty lines are
+// held back until a non-empty line follows
+func (b *BodyHasher) writeLine() {
+	l := bytes.TrimSuffix(b.line, cr)
+	if b.relaxed {
+		l = RelaxLine(l)
+	}
+	b.line = b.line[:0]
+	if len(l) == 0 {
+		b.empty++
+		return
+	}
+	for ; b.empty > 0; b.empty-- {
+		b.write(crlfBytes)
+	}
+	b.write(l)
+	b.write(crlfBytes)
+}
+
+// write writes the given canonicalized data to the hash, as long as the limit of the
+// BodyHasher has not been reached
+func (b *BodyHasher) write(p []byte) {
+	if b.limit > 0 && b.n+int64(len(p)) > b.limit {
+		if b.n < b.limit {
+			b.h.Write(p[:b.limit-b.n])
+		}
+	} else {
+		b.h.Write(p)
+	}
+	b.n += int64(len(p))
+}
+
+// MessageHasher is an io.Writer that splits a mail message into its header fields and
+// its body in a single pass. Only the header is buffered, the body is streamed to the
+// BodyHashers, so that the mail message is never held in memory as a whole
+type MessageHasher struct {
+	bhl    []*BodyHasher
+	body   io.Writer
+	header []byte
+	hl     []HeaderField
+	inBody bool
+}
+
+// NewMessageHasher returns a new MessageHasher that writes the body of the mail message
+// to the given BodyHashers
+func NewMessageHasher(bhl ...*BodyHasher) *MessageHasher {
+	wl := make([]io.Writer, 0, len(bhl))
+	for _, bh := range bhl {
+		wl = append(wl, bh)
+	}
+	return &MessageHasher{bhl: bhl, body: io.MultiWriter(wl...)}
+}
+
+// Write satisfies the io.Writer interface for the MessageHasher type
+func (mh *MessageHasher) Write(p []byte) (int, error) {
+	if mh.inBody {
+		return mh.body.Write(p)
+	}
+	mh.header = append(mh.header, p...)
+	if !bytes.Contains(mh.header, []byte("\n\r\n")) && !bytes.Contains(mh.header, []byte("\n\n")) {
+		return len(p), nil
+	}
+	hl, body, err := SplitMessage(mh.header)
+	if err != nil {
+		return 0, err
+	}
+	mh.hl, mh.header, mh.inBody = hl, nil, true
+	if _, err = mh.body.Write(body); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close completes the body hashes of the BodyHashers and returns the header fields of
+// the mail message
+func (mh *MessageHasher) Close() ([]HeaderField, error) {
+	if !mh.inBody {
+		return nil, ErrNoHeaderEnd
+	}
+	for _, bh := range mh.bhl {
+		if err := bh.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return mh.hl, nil
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package mailauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+)
+
+func TestBodyHasher(t *testing.T) {
+	tests := []struct {
+		n     string
+		c     msgauth.Canonicalization
+		limit int64
+		body  string
+		ex    string
+	}{
+		{"simple: empty body", msgauth.CanonicalizationSimple, 0, "", "\r\n"},
+		{"simple: empty lines only", msgauth.CanonicalizationSimple, 0, "\r\n\r\n", "\r\n"},
+		{"simple: trailing empty lines", msgauth.CanonicalizationSimple, 0, "a \r\n\r\nb\r\n\r\n\r\n", "a \r\n\r\nb\r\n"},
+		{"simple: missing CRLF", msgauth.CanonicalizationSimple, 0, "a\r\nb", "a\r\nb\r\n"},
+		{"simple: bare LF", msgauth.CanonicalizationSimple, 0, "a\nb\n", "a\r\nb\r\n"},
+		{"relaxed: empty body", msgauth.CanonicalizationRelaxed, 0, "", ""},
+		{"relaxed: empty lines only", msgauth.CanonicalizationRelaxed, 0, " \r\n\t\r\n", ""},
+		{"relaxed: whitespace", msgauth.CanonicalizationRelaxed, 0, " a \t b\t\r\n\r\nc  \r\n \r\n", " a b\r\n\r\nc\r\n"},
+		{
+			"relaxed: non-ASCII whitespace", msgauth.CanonicalizationRelaxed, 0, "a\u00a0b \r\nline\vx\f\r\n",
+			"a\u00a0b\r\nline\vx\f\r\n",
+		},
+		{"limit: shorter body", msgauth.CanonicalizationSimple, 100, "a\r\nb\r\n", "a\r\nb\r\n"},
+		{"limit: longer body", msgauth.CanonicalizationSimple, 4, "a\r\nb\r\nc\r\n", "a\r\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			ex := sha256.Sum256([]byte(tt.ex))
+
+			// The result must not depend on how the body is split into writes
+			for _, size := range []int{1, 2, 3, len(tt.body) + 1} {
+				bh := NewBodyHasher(crypto.SHA256, tt.c, tt.limit)
+				for b := []byte(tt.body); len(b) > 0; {
+					n := min(size, len(b))
+					if _, err := bh.Write(b[:n]); err != nil {
+						t.Fatalf("failed to write body: %s", err)
+					}
+					b = b[n:]
+				}
+				if err := bh.Close(); err != nil {
+					t.Fatalf("failed to close body hasher: %s", err)
+				}
+				if !bytes.Equal(bh.Sum(), ex[:]) {
+					t.Errorf("body hash mismatch with writes of %d bytes", size)
+				}
+				if bh.Length() != int64(len(tt.ex)) {
+					t.Errorf("body length mismatch, expected: %d, got: %d", len(tt.ex), bh.Length())
+				}
+			}
+		})
+	}
+}
+
+func TestMessageHasher(t *testing.T) {
+	raw := "From: a\r\nSubject: b\r\n c\r\n\r\nThis is the\r\nmail body\r\n\r\n"
+	ex := sha256.Sum256([]byte("This is the\r\nmail body\r\n"))
+	for size := 1; size <= len(raw); size++ {
+		bh := NewBodyHasher(crypto.SHA256, msgauth.CanonicalizationSimple, 0)
+		mh := NewMessageHasher(bh)
+		for b := []byte(raw); len(b) > 0; {
+			n := min(size, len(b))
+			if _, err := mh.Write(b[:n]); err != nil {
+				t.Fatalf("failed to write mail message: %s", err)
+			}
+			b = b[n:]
+		}
+		hl, err := mh.Close()
+		if err != nil {
+			t.Fatalf("failed to close message hasher: %s", err)
+		}
+		if len(hl) != 2 || hl[1].Raw != "Subject: b\r\n c\r\n" {
+			t.Errorf("unexpected header fields with writes of %d bytes: %+v", size, hl)
+		}
+		if !bytes.Equal(bh.Sum(), ex[:]) {
+			t.Errorf("body hash mismatch with writes of %d bytes", size)
+		}
+	}
+
+	mh := NewMessageHasher(NewBodyHasher(crypto.SHA256, msgauth.CanonicalizationSimple, 0))
+	if _, err := mh.Write([]byte("From: a\r\n")); err != nil {
+		t.Fatalf("failed to write mail message: %s", err)
+	}
+	if _, err := mh.Close(); !errors.Is(err, ErrNoHeaderEnd) {
+		t.Errorf("message hasher without end of header was supposed to fail with ErrNoHeaderEnd, got: %v", err)
+	}
+}
+
+func BenchmarkBodyHasher(b *testing.B) {
+	body := bytes.Repeat([]byte(strings.Repeat("0123456789abcdef", 4)+"  \t\r\n"), 1<<14)
+	for _, c := range []msgauth.Canonicalization{msgauth.CanonicalizationSimple, msgauth.CanonicalizationRelaxed} {
+		b.Run(string(c), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bh := NewBodyHasher(crypto.SHA256, c, 0)
+				if _, err := bh.Write(body); err != nil {
+					b.Fatalf("failed to write body: %s", err)
+				}
+				if err := bh.Close(); err != nil {
+					b.Fatalf("failed to close body hasher: %s", err)
+				}
+			}
+		})
+	}
+}
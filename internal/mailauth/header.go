@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package mailauth implements the mail header handling that is shared by the DKIM and
+// the ARC middleware, like the splitting of a mail message into its header fields, the
+// canonicalization of header fields and the folding of generated tag lists
+package mailauth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+)
+
+const (
+	// FoldLength is the maximum line length of generated header fields
+	FoldLength = 76
+	// crlf is the line ending of a mail message
+	crlf = "\r\n"
+)
+
+// ErrNoHeaderEnd is returned if the end of the mail header could not be found
+var ErrNoHeaderEnd = errors.New("failed to find end of mail header")
+
+// HeaderField is a single header field of a mail message
+type HeaderField struct {
+	// Name is the header field name as it appears in the mail
+	Name string
+	// Raw is the complete header field including its name, all folding and the
+	// trailing CRLF
+	Raw string
+}
+
+// NewHeaderField returns a new HeaderField for the given name and (folded) value
+func NewHeaderField(n, v string) HeaderField {
+	return HeaderField{Name: n, Raw: n + ": " + v + crlf}
+}
+
+// Value returns the unfolded value of the HeaderField without surrounding whitespace
+func (h HeaderField) Value() string {
+	_, v, _ := strings.Cut(h.Raw, ":")
+	return strings.TrimSpace(Unfold(v))
+}
+
+// SplitMessage splits the given raw mail message into its header fields and its body
+func SplitMessage(raw []byte) ([]HeaderField, []byte, error) {
+	var hl []HeaderField
+	for len(raw) > 0 {
+		i := bytes.IndexByte(raw, '\n')
+		if i < 0 {
+			return nil, nil, ErrNoHeaderEnd
+		}
+		l := string(raw[:i+1])
+		raw = raw[i+1:]
+		if l == crlf || l == "\n" {
+			return hl, raw, nil
+		}
+		if l[0] == ' ' || l[0] == '\t' {
+			if len(hl) == 0 {
+				return nil, nil, fmt.Errorf("unexpected continuation line: %w", ErrNoHeaderEnd)
+			}
+			hl[len(hl)-1].Raw += l
+			continue
+		}
+		n, _, ok := strings.Cut(l, ":")
+		if !ok {
+			return nil, nil, fmt.Errorf("malformed header field %q: %w", strings.TrimSpace(l), ErrNoHeaderEnd)
+		}
+		hl = append(hl, HeaderField{Name: strings.TrimSpace(n), Raw: l})
+	}
+	return nil, nil, ErrNoHeaderEnd
+}
+
+// CanonicalHeader returns the canonicalized form of the given HeaderField. Any
+// canonicalization other than the relaxed canonicalization is treated as the simple
+// canonicalization.
+//
+// The relaxed canonicalization only treats SP and HTAB as whitespace, so that other
+// (Unicode) whitespace characters are kept as they are
+// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-3.4.2
+func CanonicalHeader(h HeaderField, c msgauth.Canonicalization) string {
+	if c != msgauth.CanonicalizationRelaxed {
+		return h.Raw
+	}
+	n, v, _ := strings.Cut(h.Raw, ":")
+	v = string(RelaxLine([]byte(Unfold(v))))
+	return strings.ToLower(strings.TrimRight(n, " \t")) + ":" + strings.TrimPrefix(v, " ") + crlf
+}
+
+// RelaxLine reduces all sequences of SP and HTAB of the given line to a single SP and
+// removes them at the end of the line. The line is modified in place
+// See: https://www.rfc-editor.org/rfc/rfc6376.html#section-3.4.4
+func RelaxLine(l []byte) []byte {
+	out := l[:0]
+	wsp := false
+	for _, c := range l {
+		if c == ' ' || c == '\t' {
+			wsp = true
+			continue
+		}
+		if wsp {
+			out = append(out, ' ')
+			wsp = false
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Unfold removes all CR and LF characters of a folded header field value
+func Unfold(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+// FoldTags joins the given tags to a header field value and folds it, so that no line
+// of the header field exceeds the FoldLength unless a single tag is longer. The header
+// field name length n is taken into account for the first line
+func FoldTags(n int, tags ...string) string {
+	var sb strings.Builder
+	ll := n + 2
+	for i, t := range tags {
+		if i > 0 {
+			sb.WriteString(";")
+			ll++
+			if ll+len(t)+1 > FoldLength {
+				sb.WriteString(crlf)
+				ll = 0
+			}
+			sb.WriteString(" ")
+			ll++
+		}
+		sb.WriteString(t)
+		ll += len(t)
+	}
+	return sb.String()
+}
+
+// FoldValue folds the given tag value (e.g. a base64 encoded signature) into lines of
+// the FoldLength. The length o of the line the value is appended to is taken into
+// account for the first line
+func FoldValue(v string, o int) string {
+	var sb strings.Builder
+	for ll := FoldLength - o; len(v) > ll; ll = FoldLength - 1 {
+		if ll > 0 {
+			sb.WriteString(v[:ll])
+			v = v[ll:]
+		}
+		sb.WriteString(crlf + " ")
+	}
+	sb.WriteString(v)
+	return sb.String()
+}
+
+// LastLineLength returns the length of the last line of the given folded header field
+func LastLineLength(h string) int {
+	if i := strings.LastIndex(h, crlf); i >= 0 {
+		return len(h) - i - len(crlf)
+	}
+	return len(h)
+}
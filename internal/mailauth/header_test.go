@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package mailauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+)
+
+func TestCanonicalHeader(t *testing.T) {
+	tests := []struct {
+		n  string
+		h  HeaderField
+		ex string
+	}{
+		// RFC 6376, section 3.4.5 canonicalization examples
+		{"RFC example A", HeaderField{Name: "A", Raw: "A: X\r\n"}, "a:X\r\n"},
+		{"RFC example B", HeaderField{Name: "B", Raw: "B : Y\t\r\n\tZ  \r\n"}, "b:Y Z\r\n"},
+		{
+			"no-break space", HeaderField{Name: "X-Test", Raw: "X-Test: \"a\u00a0b\"  \u00a0\r\n"},
+			"x-test:\"a\u00a0b\" \u00a0\r\n",
+		},
+		{
+			"vertical tab and form feed", HeaderField{Name: "X-Test", Raw: "X-Test: \va  \f b\t\r\n"},
+			"x-test:\va \f b\r\n",
+		},
+		{"empty value", HeaderField{Name: "X-Test", Raw: "X-Test: \t\r\n"}, "x-test:\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			if c := CanonicalHeader(tt.h, msgauth.CanonicalizationRelaxed); c != tt.ex {
+				t.Errorf("relaxed header canonicalization failed. Expected: %q, got: %q", tt.ex, c)
+			}
+			if c := CanonicalHeader(tt.h, msgauth.CanonicalizationSimple); c != tt.h.Raw {
+				t.Errorf("simple header canonicalization failed. Got: %q", c)
+			}
+		})
+	}
+}
+
+func TestRelaxLine(t *testing.T) {
+	tests := []struct {
+		l  string
+		ex string
+	}{
+		{" C \t", " C"},
+		{"D \t E", "D E"},
+		{"a\u00a0\u00a0b\v\vc", "a\u00a0\u00a0b\v\vc"},
+		{" \t ", ""},
+	}
+	for _, tt := range tests {
+		if l := string(RelaxLine([]byte(tt.l))); l != tt.ex {
+			t.Errorf("RelaxLine failed. Expected: %q, got: %q", tt.ex, l)
+		}
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	hl, body, err := SplitMessage([]byte("From: a@test.tld\r\nSubject: A\r\n folded\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatalf("SplitMessage failed: %s", err)
+	}
+	if len(hl) != 2 || hl[0].Name != "From" || hl[1].Raw != "Subject: A\r\n folded\r\n" ||
+		hl[1].Value() != "A folded" {
+		t.Errorf("SplitMessage failed. Unexpected header fields: %+v", hl)
+	}
+	if string(body) != "body\r\n" {
+		t.Errorf("SplitMessage failed. Unexpected body: %q", body)
+	}
+	for _, m := range []string{"From: a@test.tld\r\n", " folded\r\n\r\n", "invalid\r\n\r\n"} {
+		if _, _, err = SplitMessage([]byte(m)); !errors.Is(err, ErrNoHeaderEnd) {
+			t.Errorf("SplitMessage of %q was supposed to fail with ErrNoHeaderEnd, got: %v", m, err)
+		}
+	}
+}
+
+func TestFoldTags(t *testing.T) {
+	tags := []string{"a=rsa-sha256", "d=test.tld", "h=" + strings.Repeat("From:", 20) + "To", "s=mail", "b="}
+	f := FoldTags(len("DKIM-Signature"), tags...)
+	for i, l := range strings.Split("DKIM-Signature: "+f, crlf) {
+		if len(l) > FoldLength && !strings.HasPrefix(strings.TrimSpace(l), "h=") {
+			t.Errorf("FoldTags failed. Line %d exceeds %d characters: %s", i, FoldLength, l)
+		}
+	}
+	if strings.Join(strings.Fields(Unfold(f)), " ") != strings.Join(tags, "; ") {
+		t.Errorf("FoldTags failed. Unfolded value does not match: %q", f)
+	}
+}
+
+func TestFoldValue(t *testing.T) {
+	v := strings.Repeat("a", 200)
+	f := FoldValue(v, 60)
+	for _, l := range strings.Split(f, crlf) {
+		if len(l) > FoldLength {
+			t.Errorf("FoldValue failed. Line exceeds %d characters: %s", FoldLength, l)
+		}
+	}
+	if strings.Join(strings.Fields(Unfold(f)), "") != v {
+		t.Errorf("FoldValue failed. Unfolded value does not match")
+	}
+	if LastLineLength("a: b\r\n cde") != 4 || LastLineLength("abc") != 3 {
+		t.Errorf("LastLineLength failed")
+	}
+}
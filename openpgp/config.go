@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/wneessen/go-mail"
 	"github.com/wneessen/go-mail-middleware/log"
 )
 
@@ -18,6 +19,20 @@ type PGPScheme int
 // Action is an alias type for an int
 type Action int
 
+// MissingKeyPolicy is an alias type for an int
+type MissingKeyPolicy int
+
+// FailurePolicy is an alias type for an int
+type FailurePolicy int
+
+// ErrorHandler is a function that is called with the mail.Msg and the error whenever
+// the Middleware fails to process a mail
+type ErrorHandler func(msg *mail.Msg, err error)
+
+// QuarantineFunc is a function that receives the raw, unprocessed mail message and the
+// processing error if the FailQuarantine FailurePolicy is used
+type QuarantineFunc func(msg []byte, err error)
+
 const (
 	// SchemePGPInline represents the PGP/Inline scheme
 	//
@@ -25,7 +40,7 @@ const (
 	// HTML (or alternative body parts of the same type) will be ignored
 	SchemePGPInline PGPScheme = iota
 	// SchemePGPMIME represents the OpenPGP/MIME (RFC 4880 and 3156) scheme
-	SchemePGPMIME // Not supported yet
+	SchemePGPMIME
 )
 
 const (
@@ -34,9 +49,42 @@ const (
 	// ActionEncryptAndSign will encrypt the mail body and sign the the outcome accordingly
 	ActionEncryptAndSign
 	// ActionSign will only sign the mail body but not encrypt any data
+	//
+	// With SchemePGPMIME a detached signature of the unmodified MIME entity is
+	// created (multipart/signed)
 	ActionSign
 )
 
+const (
+	// MissingKeyFail will treat a recipient without a public key in the KeyRing as
+	// an encryption failure. The mail will not be sent
+	MissingKeyFail MissingKeyPolicy = iota
+	// MissingKeySkip will encrypt the mail only for the recipients with a public key
+	// in the KeyRing. Recipients without a public key still receive the mail, but are
+	// not able to decrypt it. Use Middleware.FilterRecipients before sending the mail
+	// to remove them
+	MissingKeySkip
+	// MissingKeyPlaintext will send the mail unencrypted if any of the recipients has
+	// no public key in the KeyRing
+	MissingKeyPlaintext
+)
+
+const (
+	// FailClosed will make a mail that could not be processed undeliverable. The recipients
+	// are removed, the error is noted in the HeaderError header and writing the mail fails
+	// with an error wrapping ErrNotProcessed. This is the default
+	FailClosed FailurePolicy = iota
+	// FailOpen will send a mail that could not be processed without any modification, i.e.
+	// unencrypted and unsigned
+	FailOpen
+	// FailQuarantine will hand a mail that could not be processed to the QuarantineFunc of
+	// the Config and then make it undeliverable like FailClosed
+	FailQuarantine
+)
+
+// DefaultSubjectPlaceholder is the default outer Subject of a mail with protected headers
+const DefaultSubjectPlaceholder = "..."
+
 var (
 	// ErrNoPrivKey should be returned if a private key is needed but not provided
 	ErrNoPrivKey = errors.New("no private key provided")
@@ -44,20 +92,47 @@ var (
 	ErrNoPubKey = errors.New("no public key provided")
 	// ErrUnsupportedAction should be returned if a not supported action is set
 	ErrUnsupportedAction = errors.New("unsupported action")
+	// ErrUnsupportedScheme should be returned if a not supported scheme is set
+	ErrUnsupportedScheme = errors.New("unsupported scheme")
+	// ErrNoQuarantine should be returned if FailQuarantine is set without a QuarantineFunc
+	ErrNoQuarantine = errors.New("quarantine failure policy requires a quarantine function")
 )
 
 // Config is the confiuration to use in Middleware creation
 type Config struct {
 	// Action represents the encryption/signing action that the Middlware should perform
 	Action Action
+	// ErrorHandler is an optional function that is called for every mail that the
+	// Middleware fails to process, independent of the FailurePolicy
+	ErrorHandler ErrorHandler
+	// FailurePolicy defines how to handle a mail that the Middleware fails to process. If
+	// not set, we default to FailClosed
+	FailurePolicy FailurePolicy
+	// KeyRing is an optional KeyRing used to look up the public key of each recipient
+	// of the mail. If set, the mail is encrypted for all To, Cc and Bcc recipients
+	// (and additionally to PublicKey, if provided)
+	KeyRing KeyRing
 	// Logger represents a log that satisfies the log.Logger interface
 	Logger *log.Logger
+	// MissingKeyPolicy defines how to handle recipients for which the KeyRing holds
+	// no public key
+	MissingKeyPolicy MissingKeyPolicy
 	// PrivKey represents the OpenPGP/GPG private key part used for signing the mail
 	PrivKey string
 	// PublicKey represents the OpenPGP/GPG public key used for encrypting the mail
 	PublicKey string
+	// Quarantine receives the unprocessed mail message if the FailQuarantine FailurePolicy
+	// is used
+	Quarantine QuarantineFunc
+	// ProtectedHeaders enables protected headers for encrypted PGP/MIME mails. The Subject,
+	// From, To and Date header fields are copied into the encrypted MIME entity and the
+	// outer Subject is replaced with the SubjectPlaceholder
+	ProtectedHeaders bool
 	// Schema represents one of the supported PGP encryption schemes
 	Scheme PGPScheme
+	// SubjectPlaceholder is the outer Subject of a mail with ProtectedHeaders. If empty,
+	// DefaultSubjectPlaceholder is used
+	SubjectPlaceholder string
 
 	// passphrase is the passphrase for the private key
 	passphrase string
@@ -134,9 +209,12 @@ func NewConfig(pr, pu string, o ...Option) (*Config, error) {
 	if c.PrivKey == "" && (c.Action == ActionSign || c.Action == ActionEncryptAndSign) {
 		return c, fmt.Errorf("message signing requires a private key: %w", ErrNoPrivKey)
 	}
-	if c.PublicKey == "" && (c.Action == ActionEncrypt || c.Action == ActionEncryptAndSign) {
+	if c.PublicKey == "" && c.KeyRing == nil && (c.Action == ActionEncrypt || c.Action == ActionEncryptAndSign) {
 		return c, fmt.Errorf("message encryption requires a public key: %w", ErrNoPubKey)
 	}
+	if c.FailurePolicy == FailQuarantine && c.Quarantine == nil {
+		return c, ErrNoQuarantine
+	}
 
 	// Create a slog.TextHandler logger if none was provided
 	if c.Logger == nil {
@@ -167,6 +245,55 @@ func WithAction(a Action) Option {
 	}
 }
 
+// WithKeyRing sets a KeyRing for the recipient public key lookup for the Config
+func WithKeyRing(kr KeyRing) Option {
+	return func(c *Config) {
+		c.KeyRing = kr
+	}
+}
+
+// WithMissingKeyPolicy sets a MissingKeyPolicy for the Config
+func WithMissingKeyPolicy(p MissingKeyPolicy) Option {
+	return func(c *Config) {
+		c.MissingKeyPolicy = p
+	}
+}
+
+// WithFailurePolicy sets a FailurePolicy for the Config
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(c *Config) {
+		c.FailurePolicy = p
+	}
+}
+
+// WithErrorHandler sets an ErrorHandler for the Config
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(c *Config) {
+		c.ErrorHandler = h
+	}
+}
+
+// WithQuarantine sets the FailQuarantine FailurePolicy and the corresponding
+// QuarantineFunc for the Config
+func WithQuarantine(q QuarantineFunc) Option {
+	return func(c *Config) {
+		c.FailurePolicy = FailQuarantine
+		c.Quarantine = q
+	}
+}
+
+// WithProtectedHeaders enables protected headers for encrypted PGP/MIME mails in the
+// Config. The outer Subject of the mail is replaced with the given placeholder. If the
+// placeholder is empty, DefaultSubjectPlaceholder is used
+//
+// Note: Protected headers are not supported with SchemePGPInline
+func WithProtectedHeaders(p string) Option {
+	return func(c *Config) {
+		c.ProtectedHeaders = true
+		c.SubjectPlaceholder = p
+	}
+}
+
 // WithPrivKeyPass sets a passphrase for the PrivKey in the Config
 func WithPrivKeyPass(p string) Option {
 	return func(c *Config) {
@@ -174,6 +301,75 @@ func WithPrivKeyPass(p string) Option {
 	}
 }
 
+// DecrypterConfig is the configuration to use in Decrypter creation
+type DecrypterConfig struct {
+	// KeyRing is an optional KeyRing used to look up the public key of the sender of an
+	// inbound mail for signature verification
+	KeyRing KeyRing
+	// Logger represents a log that satisfies the log.Logger interface
+	Logger *log.Logger
+	// PrivKey represents the OpenPGP/GPG private key used for decrypting inbound mails
+	//
+	// PrivKey MUST not be empty
+	PrivKey string
+	// PublicKey represents the optional OpenPGP/GPG public key used for verifying the
+	// signatures of inbound mails
+	PublicKey string
+
+	// passphrase is the passphrase for the private key
+	passphrase string
+}
+
+// DecrypterOption returns a function that can be used for grouping DecrypterConfig options
+type DecrypterOption func(cfg *DecrypterConfig)
+
+// NewDecrypterConfig returns a new DecrypterConfig struct. It requires the private key pr
+// for decryption. The public key pu is optional and used for signature verification. All
+// other values can be prefilled using the With*() DecrypterOption methods
+func NewDecrypterConfig(pr, pu string, o ...DecrypterOption) (*DecrypterConfig, error) {
+	c := &DecrypterConfig{PrivKey: pr, PublicKey: pu}
+
+	// Override defaults with optionally provided Option functions
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		co(c)
+	}
+
+	if c.PrivKey == "" {
+		return c, fmt.Errorf("message decryption requires a private key: %w", ErrNoPrivKey)
+	}
+
+	// Create a log.Logger if none was provided
+	if c.Logger == nil {
+		c.Logger = log.New(os.Stderr, "openpgp", log.LevelWarn)
+	}
+
+	return c, nil
+}
+
+// WithDecrypterKeyRing sets a KeyRing for the sender public key lookup for the DecrypterConfig
+func WithDecrypterKeyRing(kr KeyRing) DecrypterOption {
+	return func(c *DecrypterConfig) {
+		c.KeyRing = kr
+	}
+}
+
+// WithDecrypterLogger sets a log.Logger for the DecrypterConfig
+func WithDecrypterLogger(l *log.Logger) DecrypterOption {
+	return func(c *DecrypterConfig) {
+		c.Logger = l
+	}
+}
+
+// WithDecrypterPrivKeyPass sets a passphrase for the PrivKey in the DecrypterConfig
+func WithDecrypterPrivKeyPass(p string) DecrypterOption {
+	return func(c *DecrypterConfig) {
+		c.passphrase = p
+	}
+}
+
 // String satisfies the fmt.Stringer interface for the PGPScheme type
 func (s PGPScheme) String() string {
 	switch s {
@@ -199,3 +395,31 @@ func (a Action) String() string {
 		return "unknown"
 	}
 }
+
+// String satisfies the fmt.Stringer interface for the MissingKeyPolicy type
+func (p MissingKeyPolicy) String() string {
+	switch p {
+	case MissingKeyFail:
+		return "fail"
+	case MissingKeySkip:
+		return "skip"
+	case MissingKeyPlaintext:
+		return "plaintext"
+	default:
+		return "unknown"
+	}
+}
+
+// String satisfies the fmt.Stringer interface for the FailurePolicy type
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailClosed:
+		return "fail-closed"
+	case FailOpen:
+		return "fail-open"
+	case FailQuarantine:
+		return "quarantine"
+	default:
+		return "unknown"
+	}
+}
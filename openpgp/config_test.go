@@ -5,10 +5,12 @@
 package openpgp
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 
+	"github.com/wneessen/go-mail"
 	"github.com/wneessen/go-mail-middleware/log"
 )
 
@@ -247,6 +249,69 @@ func TestNewConfig_WithLogger(t *testing.T) {
 	}
 }
 
+func TestNewConfig_WithFailurePolicy(t *testing.T) {
+	mc, err := NewConfig(privKey, pubKey)
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	if mc.FailurePolicy != FailClosed {
+		t.Errorf("NewConfig failed. Expected default FailurePolicy %s, got: %s", FailClosed, mc.FailurePolicy)
+	}
+	mc, err = NewConfig(privKey, pubKey, WithFailurePolicy(FailOpen))
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	if mc.FailurePolicy != FailOpen {
+		t.Errorf("NewConfig_WithFailurePolicy failed. Expected: %s, got: %s", FailOpen, mc.FailurePolicy)
+	}
+	if _, err = NewConfig(privKey, pubKey, WithFailurePolicy(FailQuarantine)); !errors.Is(err, ErrNoQuarantine) {
+		t.Errorf("NewConfig with FailQuarantine without QuarantineFunc was supposed to fail, got: %s", err)
+	}
+	mc, err = NewConfig(privKey, pubKey, WithQuarantine(func([]byte, error) {}),
+		WithErrorHandler(func(*mail.Msg, error) {}))
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	if mc.FailurePolicy != FailQuarantine || mc.Quarantine == nil || mc.ErrorHandler == nil {
+		t.Errorf("NewConfig_WithQuarantine failed. Expected quarantine policy, function and error handler")
+	}
+}
+
+func TestNewConfig_WithProtectedHeaders(t *testing.T) {
+	mc, err := NewConfig(privKey, pubKey)
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	if mc.ProtectedHeaders {
+		t.Errorf("NewConfig failed. Protected headers are not supposed to be enabled by default")
+	}
+	mc, err = NewConfig(privKey, pubKey, WithProtectedHeaders("Encrypted message"))
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	if !mc.ProtectedHeaders || mc.SubjectPlaceholder != "Encrypted message" {
+		t.Errorf("NewConfig_WithProtectedHeaders failed. Expected protected headers with placeholder %q, got: %t/%q",
+			"Encrypted message", mc.ProtectedHeaders, mc.SubjectPlaceholder)
+	}
+}
+
+func TestFailurePolicy_String(t *testing.T) {
+	tests := []struct {
+		p FailurePolicy
+		s string
+	}{
+		{FailClosed, "fail-closed"},
+		{FailOpen, "fail-open"},
+		{FailQuarantine, "quarantine"},
+		{999, "unknown"},
+	}
+	for _, tt := range tests {
+		if tt.p.String() != tt.s {
+			t.Errorf("String() failed. Expected: %q, got: %q", tt.s, tt.p.String())
+		}
+	}
+}
+
 func TestNewConfig_WithPrivKeyPass(t *testing.T) {
 	p := "sup3rS3cret!"
 	mc, err := NewConfig(privKey, pubKey, WithPrivKeyPass(p))
@@ -372,7 +437,7 @@ func TestActionString(t *testing.T) {
 		{"encrypt", ActionEncrypt, "Encrypt-only"},
 		{"encrypt-sign", ActionEncryptAndSign, "Encrypt/Sign"},
 		{"sign", ActionSign, "Sign-only"},
-		{"unknown", Action(3), "unknown"},
+		{"unknown", Action(999), "unknown"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -382,3 +447,26 @@ func TestActionString(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDecrypterConfig(t *testing.T) {
+	kr, err := NewMapKeyRing(pubKey)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	l := log.New(os.Stderr, "openpgp", log.LevelError)
+	c, err := NewDecrypterConfig(privKey, pubKey, WithDecrypterKeyRing(kr), WithDecrypterLogger(l),
+		WithDecrypterPrivKeyPass("secret"), nil)
+	if err != nil {
+		t.Fatalf("NewDecrypterConfig failed: %s", err)
+	}
+	if c.PrivKey != privKey || c.PublicKey != pubKey || c.KeyRing == nil || c.Logger != l ||
+		c.passphrase != "secret" {
+		t.Errorf("NewDecrypterConfig failed. Options were not applied")
+	}
+	if c, err = NewDecrypterConfig(privKey, ""); err != nil || c.Logger == nil {
+		t.Errorf("NewDecrypterConfig without public key failed. Expected default logger, got: %v", err)
+	}
+	if _, err = NewDecrypterConfig("", pubKey); !errors.Is(err, ErrNoPrivKey) {
+		t.Errorf("NewDecrypterConfig without private key was supposed to fail with ErrNoPrivKey, got: %v", err)
+	}
+}
@@ -0,0 +1,457 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+
+	pgp "github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/ProtonMail/gopenpgp/v2/armor"
+	"github.com/wneessen/go-mail"
+)
+
+// SignatureStatus is an alias type for an int
+type SignatureStatus int
+
+const (
+	// SignatureNone represents a message part that is not signed
+	SignatureNone SignatureStatus = iota
+	// SignatureValid represents a message part with a valid signature of a known key
+	SignatureValid
+	// SignatureInvalid represents a message part with a signature that failed verification
+	SignatureInvalid
+	// SignatureUnknownKey represents a message part that is signed with a key that is not
+	// available for verification
+	SignatureUnknownKey
+)
+
+var (
+	// ErrInvalidPGPMIME should be returned if a PGP/MIME message does not follow RFC 3156
+	ErrInvalidPGPMIME = errors.New("invalid PGP/MIME message structure")
+	// ErrNoClosingBoundary should be returned if a multipart body is not terminated by a
+	// closing boundary delimiter
+	ErrNoClosingBoundary = errors.New("multipart body has no closing boundary")
+)
+
+// Decrypter decrypts and verifies inbound PGP/Inline and PGP/MIME mails
+type Decrypter struct {
+	config *DecrypterConfig
+}
+
+// Message represents a decrypted and verified inbound mail
+type Message struct {
+	// Header holds the (outer) header fields of the mail
+	Header netmail.Header
+	// Scheme is the PGPScheme that was used for the mail
+	Scheme PGPScheme
+	// Parts holds the decrypted leaf parts of the MIME tree of the mail
+	Parts []*Part
+	// ProtectedHeader holds the protected header fields of an encrypted PGP/MIME mail. It
+	// is nil if the mail has no protected headers
+	ProtectedHeader netmail.Header
+}
+
+// Part represents a single, decrypted leaf part of the MIME tree of an inbound mail
+type Part struct {
+	// Header holds the MIME header fields of the part
+	Header textproto.MIMEHeader
+	// Body holds the decrypted and transfer-decoded content of the part
+	Body []byte
+	// Encrypted is true if the part was encrypted
+	Encrypted bool
+	// Signature is the verification status of the part
+	Signature SignatureStatus
+	// SignatureError holds the reason of a failed verification with SignatureInvalid
+	SignatureError error
+	// SignerKeyIDs holds the hex encoded key IDs of the signers of the part
+	SignerKeyIDs []string
+	// Error holds the reason why the part could not be decrypted or parsed. The Body of
+	// such a part holds its unprocessed content. The other parts of the mail are still
+	// processed
+	Error error
+}
+
+// partState holds the encryption and signature state that a PGP/MIME envelope passes
+// on to the parts of its MIME entity
+type partState struct {
+	encrypted bool
+	sig       SignatureStatus
+	sigErr    error
+	keyIDs    []string
+}
+
+// NewDecrypter returns a new Decrypter from a given DecrypterConfig. The private key of the
+// DecrypterConfig is used for decryption. The PublicKey of the DecrypterConfig and, if
+// available, the key of the sender in its KeyRing are used for signature verification
+func NewDecrypter(c *DecrypterConfig) *Decrypter {
+	return &Decrypter{config: c}
+}
+
+// DecryptBytes decrypts and verifies the given raw RFC 5322 mail message
+func (d *Decrypter) DecryptBytes(b []byte) (*Message, error) {
+	return d.Decrypt(bytes.NewReader(b))
+}
+
+// Decrypt reads a RFC 5322 mail message from the given io.Reader, decrypts it and
+// verifies its signatures. An error is only returned if the mail message as a whole
+// can't be processed. Parts that fail to decrypt are returned with their Error set
+func (d *Decrypter) Decrypt(r io.Reader) (*Message, error) {
+	pm, err := netmail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mail message: %w", err)
+	}
+	body, err := io.ReadAll(pm.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mail body: %w", err)
+	}
+
+	sk, err := privKeyRing(d.config.PrivKey, d.config.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer sk.ClearPrivateParams()
+	var kr pgp.EntityList
+	for _, k := range sk.GetKeys() {
+		kr = append(kr, k.GetEntity())
+	}
+	for _, a := range d.verificationKeys(pm.Header) {
+		el, err := pgp.ReadArmoredKeyRing(strings.NewReader(a))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		kr = append(kr, el...)
+	}
+
+	msg := &Message{Header: pm.Header, Scheme: SchemePGPInline}
+	if err = d.walk(msg, textproto.MIMEHeader(pm.Header), body, kr, partState{}); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// SignerKeyIDs returns the hex encoded key IDs of all signers of the Message
+func (m *Message) SignerKeyIDs() []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, p := range m.Parts {
+		for _, id := range p.SignerKeyIDs {
+			if !seen[id] {
+				ids = append(ids, id)
+				seen[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+// verificationKeys returns the armored public keys used to verify the signatures of a
+// mail with the given header
+func (d *Decrypter) verificationKeys(h netmail.Header) []string {
+	var pk []string
+	if d.config.PublicKey != "" {
+		pk = append(pk, d.config.PublicKey)
+	}
+	if d.config.KeyRing == nil {
+		return pk
+	}
+	al, err := h.AddressList("From")
+	if err != nil {
+		return pk
+	}
+	for _, a := range al {
+		k, err := d.config.KeyRing.PublicKey(a.Address)
+		if err != nil {
+			d.config.Logger.Warnf("%s. unable to verify signatures of sender", err)
+			continue
+		}
+		pk = append(pk, k)
+	}
+	return pk
+}
+
+// walk processes the MIME entity with the given header and body recursively and adds
+// all leaf parts to the given Message
+func (d *Decrypter) walk(msg *Message, h textproto.MIMEHeader, body []byte, kr pgp.EntityList,
+	st partState,
+) error {
+	mt, mp, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mt = string(mail.TypeTextPlain)
+	}
+	switch {
+	case mt == "multipart/encrypted" && mp["protocol"] == string(mail.TypePGPEncrypted):
+		msg.Scheme = SchemePGPMIME
+		pp, err := splitMultipart(body, mp["boundary"])
+		if err != nil {
+			return err
+		}
+		if len(pp) != 2 {
+			return fmt.Errorf("multipart/encrypted requires 2 parts, got %d: %w", len(pp), ErrInvalidPGPMIME)
+		}
+		_, data, err := readEntity(pp[1])
+		if err != nil {
+			return err
+		}
+		pt, est, err := decrypt(data, kr)
+		if err != nil {
+			msg.Parts = append(msg.Parts, &Part{Header: h, Body: data, Encrypted: true, Error: err})
+			return nil
+		}
+		eh, eb, err := readEntity(pt)
+		if err != nil {
+			return err
+		}
+		if _, ep, err := mime.ParseMediaType(eh.Get("Content-Type")); err == nil &&
+			ep["protected-headers"] == "v1" && msg.ProtectedHeader == nil {
+			msg.ProtectedHeader = netmail.Header{}
+			for _, n := range protectedHeaders {
+				if v, ok := eh[n]; ok {
+					msg.ProtectedHeader[n] = v
+				}
+			}
+		}
+		return d.walk(msg, eh, eb, kr, est)
+	case mt == "multipart/signed" && mp["protocol"] == string(mail.TypePGPSignature):
+		msg.Scheme = SchemePGPMIME
+		pp, err := splitMultipart(body, mp["boundary"])
+		if err != nil {
+			return err
+		}
+		if len(pp) != 2 {
+			return fmt.Errorf("multipart/signed requires 2 parts, got %d: %w", len(pp), ErrInvalidPGPMIME)
+		}
+		_, as, err := readEntity(pp[1])
+		if err != nil {
+			return err
+		}
+		sst := partState{sig: SignatureInvalid}
+		sig, err := armor.Unarmor(string(as))
+		if err != nil {
+			sst.sigErr = fmt.Errorf("failed to unarmor signature: %w", err)
+		} else {
+			sst = verifyDetached([]byte(toCRLF(string(pp[0]))), sig, kr)
+		}
+		sst.encrypted = st.encrypted
+		sh, sb, err := readEntity(pp[0])
+		if err != nil {
+			return err
+		}
+		return d.walk(msg, sh, sb, kr, sst)
+	case strings.HasPrefix(mt, "multipart/"):
+		pp, err := splitMultipart(body, mp["boundary"])
+		if err != nil {
+			return err
+		}
+		for _, p := range pp {
+			ph, pb, err := readEntity(p)
+			if err != nil {
+				msg.Parts = append(msg.Parts, &Part{Body: p, Encrypted: st.encrypted, Error: err})
+				continue
+			}
+			if err = d.walk(msg, ph, pb, kr, st); err != nil {
+				msg.Parts = append(msg.Parts, &Part{Header: ph, Body: pb, Encrypted: st.encrypted, Error: err})
+			}
+		}
+		return nil
+	}
+
+	c, err := decodeBody(h, body)
+	if err != nil {
+		return err
+	}
+	if !st.encrypted && st.sig == SignatureNone {
+		switch {
+		case hasArmorHeader(c, pgpMessageBegin):
+			pt, est, err := decrypt(c, kr)
+			if err != nil {
+				msg.Parts = append(msg.Parts, &Part{Header: h, Body: c, Encrypted: true, Error: err})
+				return nil
+			}
+			c, st = pt, est
+		case hasArmorHeader(c, pgpSignedMessageBegin):
+			c, st = verifyCleartext(c, kr)
+		}
+	}
+	msg.Parts = append(msg.Parts, &Part{
+		Header:         h,
+		Body:           c,
+		Encrypted:      st.encrypted,
+		Signature:      st.sig,
+		SignatureError: st.sigErr,
+		SignerKeyIDs:   st.keyIDs,
+	})
+	return nil
+}
+
+// hasArmorHeader returns true if the first non-empty line of the given content is the
+// given armor header line. Content that merely mentions the armor header line, e.g. in
+// a quoted mail or a documentation text, is not treated as OpenPGP message
+func hasArmorHeader(c []byte, ah string) bool {
+	l, _, _ := bytes.Cut(bytes.TrimLeft(c, " \t\r\n"), []byte("\n"))
+	return string(bytes.TrimRight(l, " \t\r")) == ah
+}
+
+const (
+	// pgpMessageBegin is the armor header line of an OpenPGP message
+	pgpMessageBegin = "-----BEGIN PGP MESSAGE-----"
+	// pgpSignedMessageBegin is the armor header line of a cleartext signed OpenPGP message
+	pgpSignedMessageBegin = "-----BEGIN PGP SIGNED MESSAGE-----"
+)
+
+// decrypt decrypts the given armored OpenPGP message with the given keys and returns the
+// plaintext and the signature state of the message
+func decrypt(d []byte, kr pgp.EntityList) ([]byte, partState, error) {
+	st := partState{encrypted: true}
+	ua, err := armor.Unarmor(string(bytes.TrimLeft(d, " \t\r\n")))
+	if err != nil {
+		return nil, st, fmt.Errorf("failed to unarmor OpenPGP message: %w", err)
+	}
+	md, err := pgp.ReadMessage(bytes.NewReader(ua), kr, nil, nil)
+	if err != nil {
+		return nil, st, fmt.Errorf("failed to decrypt OpenPGP message: %w", err)
+	}
+	pt, err := io.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, st, fmt.Errorf("failed to read decrypted OpenPGP message: %w", err)
+	}
+	if !md.IsSigned {
+		return pt, st, nil
+	}
+	st.keyIDs = []string{keyID(md.SignedByKeyId)}
+	switch {
+	case md.SignedBy == nil:
+		st.sig = SignatureUnknownKey
+	case md.SignatureError != nil:
+		st.sig, st.sigErr = SignatureInvalid, md.SignatureError
+	default:
+		st.sig = SignatureValid
+	}
+	return pt, st, nil
+}
+
+// verifyCleartext verifies the given cleartext signed OpenPGP message and returns the
+// plaintext and the signature state of the message
+func verifyCleartext(d []byte, kr pgp.EntityList) ([]byte, partState) {
+	st := partState{}
+	b, _ := clearsign.Decode(d)
+	if b == nil {
+		return d, st
+	}
+	sig, err := io.ReadAll(b.ArmoredSignature.Body)
+	if err != nil {
+		st.sig, st.sigErr = SignatureInvalid, fmt.Errorf("failed to read signature: %w", err)
+		return b.Plaintext, st
+	}
+	return b.Plaintext, verifyDetached(b.Bytes, sig, kr)
+}
+
+// verifyDetached verifies the given binary detached signature of the given data and
+// returns the signature state of the data
+func verifyDetached(d, sig []byte, kr pgp.EntityList) partState {
+	st := partState{}
+	if p, err := packet.Read(bytes.NewReader(sig)); err == nil {
+		if sp, ok := p.(*packet.Signature); ok && sp.IssuerKeyId != nil {
+			st.keyIDs = []string{keyID(*sp.IssuerKeyId)}
+		}
+	}
+	_, err := pgp.CheckDetachedSignature(kr, bytes.NewReader(d), bytes.NewReader(sig), nil)
+	switch {
+	case errors.Is(err, pgperrors.ErrUnknownIssuer):
+		st.sig = SignatureUnknownKey
+	case err != nil:
+		st.sig, st.sigErr = SignatureInvalid, err
+	default:
+		st.sig = SignatureValid
+	}
+	return st
+}
+
+// keyID returns the hex encoded representation of the given OpenPGP key ID
+func keyID(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+// readEntity splits the given raw MIME entity into its MIME header and body
+func readEntity(d []byte) (textproto.MIMEHeader, []byte, error) {
+	br := bufio.NewReader(bytes.NewReader(d))
+	h, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("failed to parse MIME header: %w", err)
+	}
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read MIME body: %w", err)
+	}
+	return h, body, nil
+}
+
+// decodeBody decodes the given body based on the Content-Transfer-Encoding of the
+// given MIME header
+func decodeBody(h textproto.MIMEHeader, body []byte) ([]byte, error) {
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 body: %w", err)
+		}
+		return b, nil
+	case "quoted-printable":
+		b, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode quoted-printable body: %w", err)
+		}
+		return b, nil
+	default:
+		return body, nil
+	}
+}
+
+// splitMultipart splits the given multipart body into its raw body parts. Other than
+// the mime/multipart.Reader, the parts are returned byte-for-byte, which is required
+// to verify the signature of a multipart/signed body
+func splitMultipart(d []byte, bd string) ([][]byte, error) {
+	if bd == "" {
+		return nil, fmt.Errorf("multipart body has no boundary: %w", ErrInvalidPGPMIME)
+	}
+	dl := []byte("--" + bd)
+	cl := []byte("--" + bd + "--")
+	var pp [][]byte
+	start := -1
+	for n := 0; n < len(d); {
+		e := bytes.IndexByte(d[n:], '\n') + 1
+		if e == 0 {
+			e = len(d) - n
+		}
+		l := bytes.TrimRight(d[n:n+e], " \t\r\n")
+		isDelim, isClose := bytes.Equal(l, dl), bytes.Equal(l, cl)
+		if (isDelim || isClose) && start >= 0 {
+			p := d[start:n]
+			p = bytes.TrimSuffix(p, []byte("\n"))
+			p = bytes.TrimSuffix(p, []byte("\r"))
+			pp = append(pp, p)
+		}
+		if isClose {
+			return pp, nil
+		}
+		if isDelim {
+			start = n + e
+		}
+		n += e
+	}
+	return nil, ErrNoClosingBoundary
+}
@@ -0,0 +1,314 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package openpgp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/wneessen/go-mail"
+)
+
+// testOutgoingMail creates a new mail.Msg, processes it with a Middleware of the given
+// Config and returns the raw mail message
+func testOutgoingMail(t *testing.T, mc *Config) []byte {
+	t.Helper()
+	m := mail.NewMsg(mail.WithMiddleware(NewMiddleware(mc)))
+	if err := m.From("toni@example.com"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	if err := m.To("tina@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	if mc.Scheme == SchemePGPMIME {
+		m.AddAlternativeString(mail.TypeTextHTML, "<p>This is the HTML body</p>")
+	}
+	if err := m.AttachReader("attachment.txt", strings.NewReader("This is the attachment")); err != nil {
+		t.Fatalf("failed to attach file: %s", err)
+	}
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// testKeyID returns the hex encoded key ID of the given armored key
+func testKeyID(t *testing.T, a string) string {
+	t.Helper()
+	k, err := crypto.NewKeyFromArmored(a)
+	if err != nil {
+		t.Fatalf("failed to parse key: %s", err)
+	}
+	return k.GetHexKeyID()
+}
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	toniPr, toniPu := testKeyPairFor(t, "toni@example.com")
+	tinaPr, tinaPu := testKeyPairFor(t, "tina@example.com")
+	tests := []struct {
+		n   string
+		s   PGPScheme
+		a   Action
+		p   int
+		enc bool
+		sig SignatureStatus
+	}{
+		{"PGP/MIME Encrypt-only", SchemePGPMIME, ActionEncrypt, 3, true, SignatureNone},
+		{"PGP/MIME Encrypt/Sign", SchemePGPMIME, ActionEncryptAndSign, 3, true, SignatureValid},
+		{"PGP/MIME Sign-only", SchemePGPMIME, ActionSign, 3, false, SignatureValid},
+		{"PGP/Inline Encrypt-only", SchemePGPInline, ActionEncrypt, 2, true, SignatureNone},
+		{"PGP/Inline Encrypt/Sign", SchemePGPInline, ActionEncryptAndSign, 2, true, SignatureValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			mc, err := NewConfig(toniPr, tinaPu, WithScheme(tt.s), WithAction(tt.a),
+				WithPrivKeyPass(testKeyPass))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			raw := testOutgoingMail(t, mc)
+
+			dc, err := NewDecrypterConfig(tinaPr, toniPu, WithDecrypterPrivKeyPass(testKeyPass))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			msg, err := NewDecrypter(dc).DecryptBytes(raw)
+			if err != nil {
+				t.Fatalf("Decrypt failed: %s", err)
+			}
+			if msg.Scheme != tt.s {
+				t.Errorf("Decrypt failed. Expected scheme %s, got: %s", tt.s, msg.Scheme)
+			}
+			if msg.Header.Get("Subject") != "This is a subject" {
+				t.Errorf("Decrypt failed. Outer header not available")
+			}
+			if len(msg.Parts) != tt.p {
+				t.Fatalf("Decrypt failed. Expected %d parts, got: %d", tt.p, len(msg.Parts))
+			}
+			for _, p := range msg.Parts {
+				if p.Encrypted != tt.enc {
+					t.Errorf("Decrypt failed. Expected encrypted %t, got: %t", tt.enc, p.Encrypted)
+				}
+				if p.Signature != tt.sig {
+					t.Errorf("Decrypt failed. Expected signature status %d, got: %d (%v)", tt.sig, p.Signature,
+						p.SignatureError)
+				}
+			}
+			if !bytes.Contains(msg.Parts[0].Body, []byte("This is the mail body")) {
+				t.Errorf("Decrypt failed. Mail body not found, got: %q", msg.Parts[0].Body)
+			}
+			if !bytes.Contains(msg.Parts[len(msg.Parts)-1].Body, []byte("This is the attachment")) {
+				t.Errorf("Decrypt failed. Attachment not found, got: %q", msg.Parts[len(msg.Parts)-1].Body)
+			}
+			ids := msg.SignerKeyIDs()
+			if tt.sig == SignatureValid && (len(ids) != 1 || ids[0] != testKeyID(t, toniPu)) {
+				t.Errorf("Decrypt failed. Expected signer key ID %s, got: %v", testKeyID(t, toniPu), ids)
+			}
+			if tt.sig == SignatureNone && len(ids) != 0 {
+				t.Errorf("Decrypt failed. Expected no signer key IDs, got: %v", ids)
+			}
+		})
+	}
+}
+
+func TestDecrypter_Decrypt_signatureStatus(t *testing.T) {
+	toniPr, toniPu := testKeyPairFor(t, "toni@example.com")
+	tinaPr, _ := testKeyPairFor(t, "tina@example.com")
+	mc, err := NewConfig(toniPr, "", WithScheme(SchemePGPMIME), WithAction(ActionSign),
+		WithPrivKeyPass(testKeyPass))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	raw := testOutgoingMail(t, mc)
+
+	t.Run("unknown key", func(t *testing.T) {
+		dc, err := NewDecrypterConfig(tinaPr, "", WithDecrypterPrivKeyPass(testKeyPass))
+		if err != nil {
+			t.Fatalf("failed to create new config: %s", err)
+		}
+		msg, err := NewDecrypter(dc).DecryptBytes(raw)
+		if err != nil {
+			t.Fatalf("Decrypt failed: %s", err)
+		}
+		for _, p := range msg.Parts {
+			if p.Signature != SignatureUnknownKey {
+				t.Errorf("Decrypt failed. Expected SignatureUnknownKey, got: %d", p.Signature)
+			}
+		}
+		if ids := msg.SignerKeyIDs(); len(ids) != 1 || ids[0] != testKeyID(t, toniPu) {
+			t.Errorf("Decrypt failed. Expected signer key ID %s, got: %v", testKeyID(t, toniPu), ids)
+		}
+	})
+	t.Run("keyring lookup", func(t *testing.T) {
+		kr, err := NewMapKeyRing(toniPu)
+		if err != nil {
+			t.Fatalf("failed to create keyring: %s", err)
+		}
+		dc, err := NewDecrypterConfig(tinaPr, "", WithDecrypterPrivKeyPass(testKeyPass),
+			WithDecrypterKeyRing(kr))
+		if err != nil {
+			t.Fatalf("failed to create new config: %s", err)
+		}
+		msg, err := NewDecrypter(dc).Decrypt(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Decrypt failed: %s", err)
+		}
+		for _, p := range msg.Parts {
+			if p.Signature != SignatureValid {
+				t.Errorf("Decrypt failed. Expected SignatureValid, got: %d", p.Signature)
+			}
+		}
+	})
+	t.Run("tampered", func(t *testing.T) {
+		dc, err := NewDecrypterConfig(tinaPr, toniPu, WithDecrypterPrivKeyPass(testKeyPass))
+		if err != nil {
+			t.Fatalf("failed to create new config: %s", err)
+		}
+		tr := bytes.Replace(raw, []byte("This is the mail body"), []byte("This is the evil body"), 1)
+		msg, err := NewDecrypter(dc).DecryptBytes(tr)
+		if err != nil {
+			t.Fatalf("Decrypt failed: %s", err)
+		}
+		for _, p := range msg.Parts {
+			if p.Signature != SignatureInvalid || p.SignatureError == nil {
+				t.Errorf("Decrypt failed. Expected SignatureInvalid, got: %d", p.Signature)
+			}
+		}
+	})
+}
+
+func TestDecrypter_Decrypt_fails(t *testing.T) {
+	toniPr, _ := testKeyPairFor(t, "toni@example.com")
+	_, tinaPu := testKeyPairFor(t, "tina@example.com")
+	mc, err := NewConfig("", tinaPu, WithScheme(SchemePGPMIME))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	raw := testOutgoingMail(t, mc)
+
+	dc, err := NewDecrypterConfig(toniPr, "", WithDecrypterPrivKeyPass(testKeyPass))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	msg, err := NewDecrypter(dc).DecryptBytes(raw)
+	if err != nil {
+		t.Fatalf("Decrypt with wrong private key was not supposed to fail as a whole: %s", err)
+	}
+	if len(msg.Parts) != 1 || msg.Parts[0].Error == nil || !msg.Parts[0].Encrypted {
+		t.Errorf("Decrypt with wrong private key failed. Expected a single encrypted part with error")
+	}
+	if _, err = NewDecrypter(dc).DecryptBytes([]byte("invalid")); err == nil {
+		t.Errorf("Decrypt of invalid message was supposed to fail, but didn't")
+	}
+	dc.PrivKey = ""
+	if _, err = NewDecrypter(dc).DecryptBytes(raw); !errors.Is(err, ErrNoPrivKey) {
+		t.Errorf("Decrypt without private key was supposed to fail with ErrNoPrivKey, got: %s", err)
+	}
+}
+
+func TestDecrypter_Decrypt_partErrors(t *testing.T) {
+	toniPr, _ := testKeyPairFor(t, "toni@example.com")
+	tinaPr, tinaPu := testKeyPairFor(t, "tina@example.com")
+	kr, err := publicKeyRing([]string{tinaPu})
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	pm, err := kr.Encrypt(crypto.NewPlainMessageFromString("This is the encrypted part"), nil)
+	if err != nil {
+		t.Fatalf("failed to encrypt message: %s", err)
+	}
+	ct, err := pm.GetArmored()
+	if err != nil {
+		t.Fatalf("failed to armor message: %s", err)
+	}
+	raw := "From: toni@example.com\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"abc\"\r\n\r\n" +
+		"--abc\r\nContent-Type: text/plain\r\n\r\n" +
+		"To encrypt a mail, send a message starting with\r\n" + pgpMessageBegin + "\r\n" +
+		"--abc\r\nContent-Type: text/plain\r\n\r\n" + pgpMessageBegin + "\r\n\r\nbroken\r\n" +
+		"--abc\r\nContent-Type: text/plain\r\n\r\n" + ct + "\r\n" +
+		"--abc--\r\n"
+
+	dc, err := NewDecrypterConfig(tinaPr, "", WithDecrypterPrivKeyPass(testKeyPass))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	msg, err := NewDecrypter(dc).DecryptBytes([]byte(raw))
+	if err != nil {
+		t.Fatalf("Decrypt failed: %s", err)
+	}
+	if len(msg.Parts) != 3 {
+		t.Fatalf("Decrypt failed. Expected 3 parts, got: %d", len(msg.Parts))
+	}
+	if p := msg.Parts[0]; p.Encrypted || p.Error != nil || !bytes.Contains(p.Body, []byte(pgpMessageBegin)) {
+		t.Errorf("Decrypt failed. Part mentioning the armor header was not supposed to be decrypted")
+	}
+	if p := msg.Parts[1]; !p.Encrypted || p.Error == nil {
+		t.Errorf("Decrypt failed. Broken encrypted part was supposed to have an error")
+	}
+	if p := msg.Parts[2]; !p.Encrypted || p.Error != nil || string(p.Body) != "This is the encrypted part" {
+		t.Errorf("Decrypt failed. Expected decrypted part after broken part, got: %q (%v)", p.Body, p.Error)
+	}
+
+	dc, err = NewDecrypterConfig(toniPr, "", WithDecrypterPrivKeyPass(testKeyPass))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	if msg, err = NewDecrypter(dc).DecryptBytes([]byte(raw)); err != nil {
+		t.Fatalf("Decrypt with wrong private key failed: %s", err)
+	}
+	if len(msg.Parts) != 3 || msg.Parts[2].Error == nil || msg.Parts[0].Error != nil {
+		t.Errorf("Decrypt with wrong private key failed. Expected error on the encrypted part only")
+	}
+}
+
+func TestHasArmorHeader(t *testing.T) {
+	tests := []struct {
+		c  string
+		ex bool
+	}{
+		{pgpMessageBegin + "\r\n\r\nwcBMA", true},
+		{"\r\n  " + pgpMessageBegin + " \r\n", true},
+		{pgpMessageBegin, true},
+		{"Quoted:\r\n" + pgpMessageBegin + "\r\n", false},
+		{"> " + pgpMessageBegin + "\r\n", false},
+		{pgpMessageBegin + "-----\r\n", false},
+	}
+	for _, tt := range tests {
+		if hasArmorHeader([]byte(tt.c), pgpMessageBegin) != tt.ex {
+			t.Errorf("hasArmorHeader of %q failed. Expected: %t", tt.c, tt.ex)
+		}
+	}
+}
+
+func TestSplitMultipart(t *testing.T) {
+	d := "preamble\r\n--abc\r\nContent-Type: text/plain\r\n\r\nFirst\r\n--abc\r\n\r\nSecond\n\r\n--abc--\r\nepilogue"
+	pp, err := splitMultipart([]byte(d), "abc")
+	if err != nil {
+		t.Fatalf("splitMultipart failed: %s", err)
+	}
+	if len(pp) != 2 {
+		t.Fatalf("splitMultipart failed. Expected 2 parts, got: %d", len(pp))
+	}
+	if string(pp[0]) != "Content-Type: text/plain\r\n\r\nFirst" {
+		t.Errorf("splitMultipart failed. Unexpected first part: %q", pp[0])
+	}
+	if string(pp[1]) != "\r\nSecond\n" {
+		t.Errorf("splitMultipart failed. Unexpected second part: %q", pp[1])
+	}
+	if _, err = splitMultipart([]byte("--abc\r\nFirst\r\n"), "abc"); !errors.Is(err, ErrNoClosingBoundary) {
+		t.Errorf("splitMultipart without closing boundary was supposed to fail, got: %s", err)
+	}
+	if _, err = splitMultipart([]byte(d), ""); !errors.Is(err, ErrInvalidPGPMIME) {
+		t.Errorf("splitMultipart without boundary was supposed to fail, got: %s", err)
+	}
+}
@@ -6,9 +6,12 @@ package openpgp
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 
 	"github.com/ProtonMail/gopenpgp/v2/armor"
 	"github.com/ProtonMail/gopenpgp/v2/constants"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
 	"github.com/ProtonMail/gopenpgp/v2/helper"
 	"github.com/wneessen/go-mail"
 )
@@ -22,117 +25,195 @@ const (
 
 // pgpInline takes the given mail.Msg and encrypts/signs the body parts
 // and attachments and replaces them with an PGP encrypted data blob embedded
-// into the mail body following the PGP/Inline scheme
+// into the mail body following the PGP/Inline scheme.
+//
+// All parts, embeds and attachments are processed before the mail.Msg is modified,
+// so that a failure never results in a partly encrypted mail
 func (m *Middleware) pgpInline(msg *mail.Msg) *mail.Msg {
-	pp := msg.GetParts()
-	for _, part := range pp {
-		c, err := part.GetContent()
-		if err != nil {
-			m.config.Logger.Errorf("failed to get part content: %s", err)
-			continue
-		}
-		switch part.GetContentType() {
-		case mail.TypeTextPlain:
-			s, err := m.processPlain(string(c))
-			if err != nil {
-				m.config.Logger.Errorf("failed to encrypt message part: %s", err)
-				continue
-			}
-			part.SetEncoding(mail.EncodingB64)
-			part.SetContent(s)
-		default:
-			m.config.Logger.Warnf("unsupported type %q. removing message part", string(part.GetContentType()))
-			part.Delete()
+	pk, err := m.lookupKeys(msg)
+	if err != nil {
+		if errors.Is(err, errSendPlaintext) {
+			m.config.Logger.Warnf("%s", err)
+			return msg
 		}
+		return m.fail(msg, err)
 	}
 
-	buf := bytes.Buffer{}
-	ef := msg.GetEmbeds()
-	msg.SetEmbeds(nil)
-	for _, f := range ef {
-		_, err := f.Writer(&buf)
-		if err != nil {
-			m.config.Logger.Errorf("failed to write attachment to memory: %s", err)
+	pp := msg.GetParts()
+	pc := make([]string, len(pp))
+	for i, part := range pp {
+		if part.GetContentType() != mail.TypeTextPlain {
 			continue
 		}
-		b, err := m.processBinary(buf.Bytes())
+		c, err := part.GetContent()
 		if err != nil {
-			m.config.Logger.Errorf("failed to encrypt attachment: %s", err)
-			continue
+			return m.fail(msg, fmt.Errorf("failed to get part content: %w", err))
 		}
-		if err := msg.EmbedReader(f.Name, bytes.NewReader([]byte(b))); err != nil {
-			m.config.Logger.Errorf("failed to embed reader: %s", err)
-			continue
+		pc[i], err = m.processPlain(string(c), pk)
+		if err != nil {
+			return m.fail(msg, fmt.Errorf("failed to encrypt message part: %w", err))
 		}
-		buf.Reset()
+	}
+	ef := msg.GetEmbeds()
+	ec, err := m.processFiles(ef, pk)
+	if err != nil {
+		return m.fail(msg, err)
 	}
 	af := msg.GetAttachments()
-	msg.SetAttachments(nil)
-	for _, f := range af {
-		_, err := f.Writer(&buf)
-		if err != nil {
-			m.config.Logger.Errorf("failed to write attachment to memory: %s", err)
+	ac, err := m.processFiles(af, pk)
+	if err != nil {
+		return m.fail(msg, err)
+	}
+
+	for i, part := range pp {
+		if part.GetContentType() != mail.TypeTextPlain {
+			m.config.Logger.Warnf("unsupported type %q. removing message part", string(part.GetContentType()))
+			part.Delete()
 			continue
 		}
-		b, err := m.processBinary(buf.Bytes())
-		if err != nil {
-			m.config.Logger.Errorf("failed to encrypt attachment: %s", err)
-			continue
+		part.SetEncoding(mail.EncodingB64)
+		part.SetContent(pc[i])
+	}
+	// At this point the mail.Msg is already partly modified, therefore any further
+	// error has to block the mail, independent of the FailurePolicy
+	msg.SetEmbeds(nil)
+	for i, f := range ef {
+		if err = msg.EmbedReader(f.Name, bytes.NewReader([]byte(ec[i]))); err != nil {
+			return m.block(msg, fmt.Errorf("failed to embed reader: %w", err))
 		}
-		if err := msg.AttachReader(f.Name, bytes.NewReader([]byte(b))); err != nil {
-			m.config.Logger.Errorf("failed to attach reader: %s", err)
-			continue
+	}
+	msg.SetAttachments(nil)
+	for i, f := range af {
+		if err = msg.AttachReader(f.Name, bytes.NewReader([]byte(ac[i]))); err != nil {
+			return m.block(msg, fmt.Errorf("failed to attach reader: %w", err))
 		}
-		buf.Reset()
 	}
 
 	return msg
 }
 
+// processFiles is a helper function that processes the given embeds or attachments
+// with processBinary and returns the processed data in the same order
+func (m *Middleware) processFiles(fl []*mail.File, pk []string) ([]string, error) {
+	pd := make([]string, len(fl))
+	buf := bytes.Buffer{}
+	for i, f := range fl {
+		buf.Reset()
+		if _, err := f.Writer(&buf); err != nil {
+			return nil, fmt.Errorf("failed to write attachment to memory: %w", err)
+		}
+		b, err := m.processBinary(buf.Bytes(), pk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt attachment: %w", err)
+		}
+		pd[i] = b
+	}
+	return pd, nil
+}
+
 // processBinary is a helper function that processes the given data based on the
-// configured Action
-func (m *Middleware) processBinary(d []byte) (string, error) {
-	var ct string
-	var err error
+// configured Action. The data is encrypted for the given armored public keys
+func (m *Middleware) processBinary(d []byte, pk []string) (string, error) {
 	switch m.config.Action {
-	case ActionEncrypt:
-		ct, err = helper.EncryptBinaryMessageArmored(m.config.PublicKey, d)
-	case ActionEncryptAndSign:
-		// TODO: Waiting for reply to https://github.com/ProtonMail/gopenpgp/issues/213
-		ct, err = helper.EncryptSignMessageArmored(m.config.PublicKey, m.config.PrivKey,
-			[]byte(m.config.passphrase), string(d))
+	case ActionEncrypt, ActionEncryptAndSign:
+		return m.encrypt(crypto.NewPlainMessage(d), pk)
 	case ActionSign:
 		// TODO: Does this work with binary?
 		return helper.SignCleartextMessageArmored(m.config.PrivKey, []byte(m.config.passphrase), string(d))
 	default:
 		return "", ErrUnsupportedAction
 	}
-	if err != nil {
-		return ct, err
-	}
-	return m.reArmorMessage(ct)
 }
 
 // processPlain is a helper function that processes the given data based on the
-// configured Action
-func (m *Middleware) processPlain(d string) (string, error) {
-	var ct string
-	var err error
+// configured Action. The data is encrypted for the given armored public keys
+func (m *Middleware) processPlain(d string, pk []string) (string, error) {
 	switch m.config.Action {
-	case ActionEncrypt:
-		ct, err = helper.EncryptMessageArmored(m.config.PublicKey, d)
-	case ActionEncryptAndSign:
-		ct, err = helper.EncryptSignMessageArmored(m.config.PublicKey, m.config.PrivKey,
-			[]byte(m.config.passphrase), d)
+	case ActionEncrypt, ActionEncryptAndSign:
+		return m.encrypt(crypto.NewPlainMessageFromString(d), pk)
 	case ActionSign:
 		return helper.SignCleartextMessageArmored(m.config.PrivKey, []byte(m.config.passphrase), d)
 	default:
 		return "", ErrUnsupportedAction
 	}
+}
+
+// encrypt encrypts the given crypto.PlainMessage for all of the given armored public
+// keys. If the configured Action requires it, the message is signed as well
+func (m *Middleware) encrypt(pm *crypto.PlainMessage, pk []string) (string, error) {
+	kr, err := publicKeyRing(pk)
+	if err != nil {
+		return "", err
+	}
+	var sk *crypto.KeyRing
+	if m.config.Action == ActionEncryptAndSign {
+		sk, err = m.config.privKeyRing()
+		if err != nil {
+			return "", err
+		}
+		defer sk.ClearPrivateParams()
+	}
+	ct, err := kr.Encrypt(pm, sk)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	a, err := ct.GetArmored()
+	if err != nil {
+		return "", fmt.Errorf("failed to armor message: %w", err)
+	}
+	return m.reArmorMessage(a)
+}
+
+// privKeyRing returns an unlocked crypto.KeyRing for the private key of the Config.
+// The caller is responsible to clear the private parameters of the KeyRing after use
+func (c *Config) privKeyRing() (*crypto.KeyRing, error) {
+	return privKeyRing(c.PrivKey, c.passphrase)
+}
+
+// privKeyRing returns a crypto.KeyRing holding the given armored private key, unlocked
+// with the given passphrase
+func privKeyRing(pr, pass string) (*crypto.KeyRing, error) {
+	if pr == "" {
+		return nil, ErrNoPrivKey
+	}
+	k, err := crypto.NewKeyFromArmored(pr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	var pp []byte
+	if pass != "" {
+		pp = []byte(pass)
+	}
+	uk, err := k.Unlock(pp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock private key: %w", err)
+	}
+	kr, err := crypto.NewKeyRing(uk)
 	if err != nil {
-		return ct, err
+		return nil, fmt.Errorf("failed to create keyring: %w", err)
+	}
+	return kr, nil
+}
+
+// publicKeyRing returns a crypto.KeyRing holding all of the given armored public keys
+func publicKeyRing(pk []string) (*crypto.KeyRing, error) {
+	if len(pk) == 0 {
+		return nil, ErrNoPubKey
+	}
+	kr, err := crypto.NewKeyRing(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keyring: %w", err)
+	}
+	for _, a := range pk {
+		k, err := crypto.NewKeyFromArmored(a)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		if err = kr.AddKey(k); err != nil {
+			return nil, fmt.Errorf("failed to add public key to keyring: %w", err)
+		}
 	}
-	return m.reArmorMessage(ct)
+	return kr, nil
 }
 
 // reArmorMessage unarmors the PGP message and re-armors it with the package specific
@@ -73,7 +73,7 @@ func TestMiddleware_processPlain(t *testing.T) {
 				t.Errorf("failed to create new config: %s", err)
 			}
 			mw := NewMiddleware(mc)
-			ct, err := mw.processPlain(ts)
+			ct, err := mw.processPlain(ts, []string{mw.config.PublicKey})
 			if err != nil {
 				t.Errorf("processPlain failed: %s", err)
 			}
@@ -119,7 +119,7 @@ func TestMiddleware_processPlain_fail(t *testing.T) {
 		t.Errorf("failed to create new config: %s", err)
 	}
 	mw := NewMiddleware(mc)
-	_, err = mw.processPlain(ts)
+	_, err = mw.processPlain(ts, []string{mw.config.PublicKey})
 	if err == nil {
 		t.Errorf("processPlain with unknown action was supposed to fail, but didn't")
 	}
@@ -132,7 +132,7 @@ func TestMiddleware_processPlain_fail(t *testing.T) {
 	}
 	mw = NewMiddleware(mc)
 	mw.config.PublicKey = ""
-	_, err = mw.processPlain(ts)
+	_, err = mw.processPlain(ts, []string{mw.config.PublicKey})
 	if err == nil {
 		t.Errorf("processPlain with empty pubkey was supposed to fail, but didn't")
 	}
@@ -159,7 +159,7 @@ func TestMiddleware_processBinary(t *testing.T) {
 				t.Errorf("failed to create new config: %s", err)
 			}
 			mw := NewMiddleware(mc)
-			ct, err := mw.processBinary(ts)
+			ct, err := mw.processBinary(ts, []string{mw.config.PublicKey})
 			if err != nil {
 				t.Errorf("processBinary failed: %s", err)
 			}
@@ -205,7 +205,7 @@ func TestMiddleware_processBinary_fail(t *testing.T) {
 		t.Errorf("failed to create new config: %s", err)
 	}
 	mw := NewMiddleware(mc)
-	_, err = mw.processBinary(ts)
+	_, err = mw.processBinary(ts, []string{mw.config.PublicKey})
 	if err == nil {
 		t.Errorf("processBinary with unknown action was supposed to fail, but didn't")
 	}
@@ -218,7 +218,7 @@ func TestMiddleware_processBinary_fail(t *testing.T) {
 	}
 	mw = NewMiddleware(mc)
 	mw.config.PublicKey = ""
-	_, err = mw.processBinary(ts)
+	_, err = mw.processBinary(ts, []string{mw.config.PublicKey})
 	if err == nil {
 		t.Errorf("processBinary with empty pubkey was supposed to fail, but didn't")
 	}
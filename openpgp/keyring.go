@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package openpgp
+
+import (
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/wneessen/go-mail"
+)
+
+var (
+	// ErrKeyNotFound should be returned by a KeyRing if no public key for the requested
+	// mail address is available
+	ErrKeyNotFound = errors.New("no public key found for recipient")
+	// ErrNoKeyIdentity should be returned if a public key does not carry any identity
+	// with a mail address
+	ErrNoKeyIdentity = errors.New("public key has no identity with a mail address")
+
+	// errSendPlaintext is returned by lookupKeys if the mail should be sent unencrypted
+	errSendPlaintext = errors.New("sending mail unencrypted")
+)
+
+// recipientHeaders are the address headers that hold the recipients of a mail.Msg
+var recipientHeaders = []mail.AddrHeader{mail.HeaderTo, mail.HeaderCc, mail.HeaderBcc}
+
+// KeyRing is the interface that wraps the PublicKey method. A KeyRing is used by the
+// Middleware to select the OpenPGP public key for each recipient of a mail.Msg
+type KeyRing interface {
+	// PublicKey returns the armored OpenPGP public key for the given mail address. If no
+	// key is available for the address, an error wrapping ErrKeyNotFound is returned
+	PublicKey(addr string) (string, error)
+}
+
+// MapKeyRing is a simple, in-memory KeyRing that maps (lower-case) mail addresses to
+// armored OpenPGP public keys
+type MapKeyRing map[string]string
+
+// NewMapKeyRing returns a new MapKeyRing from the given armored OpenPGP public keys.
+// Each key is added for all the mail addresses found in its identities
+func NewMapKeyRing(keys ...string) (MapKeyRing, error) {
+	kr := make(MapKeyRing)
+	for _, k := range keys {
+		if err := kr.Add(k); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+// Add adds the given armored OpenPGP public key to the MapKeyRing for all the mail
+// addresses found in its identities
+func (kr MapKeyRing) Add(k string) error {
+	ck, err := crypto.NewKeyFromArmored(k)
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+	ckr, err := crypto.NewKeyRing(ck)
+	if err != nil {
+		return fmt.Errorf("failed to create keyring: %w", err)
+	}
+	found := false
+	for _, id := range ckr.GetIdentities() {
+		if id.Email == "" {
+			continue
+		}
+		kr[strings.ToLower(id.Email)] = k
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("%s: %w", ck.GetFingerprint(), ErrNoKeyIdentity)
+	}
+	return nil
+}
+
+// PublicKey satisfies the KeyRing interface for the MapKeyRing type
+func (kr MapKeyRing) PublicKey(addr string) (string, error) {
+	k, ok := kr[strings.ToLower(addr)]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", addr, ErrKeyNotFound)
+	}
+	return k, nil
+}
+
+// FilterRecipients removes all To, Cc and Bcc recipients without a public key in the
+// KeyRing of the Middleware from the given mail.Msg. If none of the recipients has a public
+// key, the mail.Msg is left unchanged and an error wrapping ErrNoPubKey is returned.
+//
+// The mail.Client determines the recipients of a mail before the Middleware is applied,
+// therefore FilterRecipients has to be called before the mail is sent in case recipients
+// without a public key should not receive the mail at all (see MissingKeySkip)
+func (m *Middleware) FilterRecipients(msg *mail.Msg) error {
+	if m.config.KeyRing == nil {
+		return nil
+	}
+	keep := make(map[mail.AddrHeader][]*netmail.Address)
+	n := 0
+	for _, h := range recipientHeaders {
+		for _, a := range msg.GetAddrHeader(h) {
+			if _, err := m.config.KeyRing.PublicKey(a.Address); err != nil {
+				if errors.Is(err, ErrKeyNotFound) {
+					continue
+				}
+				return err
+			}
+			keep[h] = append(keep[h], a)
+			n++
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("none of the recipients has a public key: %w", ErrNoPubKey)
+	}
+	for _, h := range recipientHeaders {
+		if len(keep[h]) != len(msg.GetAddrHeader(h)) {
+			msg.SetAddrHeaderFromMailAddress(h, keep[h]...)
+		}
+	}
+	return nil
+}
+
+// lookupKeys returns the armored public keys the given mail.Msg should be encrypted
+// for. If the mail.Msg should be sent unencrypted due to the MissingKeyPolicy, an error
+// wrapping errSendPlaintext is returned
+func (m *Middleware) lookupKeys(msg *mail.Msg) ([]string, error) {
+	if m.config.Action == ActionSign {
+		return nil, nil
+	}
+	pk, err := m.recipientKeys(msg)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) && m.config.MissingKeyPolicy == MissingKeyPlaintext {
+			return nil, fmt.Errorf("%w: %w", errSendPlaintext, err)
+		}
+		return nil, fmt.Errorf("failed to look up recipient public keys: %w", err)
+	}
+	return pk, nil
+}
+
+// recipientKeys returns the armored public keys for all recipients of the given
+// mail.Msg. If no KeyRing is configured, only the PublicKey of the Config is returned.
+//
+// With MissingKeySkip, recipients without a public key are ignored. The mail.Msg itself
+// is not modified, since the recipients have already been handed to the mail server at
+// this point. Use FilterRecipients to remove them before sending the mail
+func (m *Middleware) recipientKeys(msg *mail.Msg) ([]string, error) {
+	var pk []string
+	if m.config.PublicKey != "" {
+		pk = append(pk, m.config.PublicKey)
+	}
+	if m.config.KeyRing == nil {
+		if len(pk) == 0 {
+			return nil, ErrNoPubKey
+		}
+		return pk, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, h := range recipientHeaders {
+		for _, a := range msg.GetAddrHeader(h) {
+			k, err := m.config.KeyRing.PublicKey(a.Address)
+			if err != nil {
+				if errors.Is(err, ErrKeyNotFound) && m.config.MissingKeyPolicy == MissingKeySkip {
+					m.config.Logger.Warnf("%s. recipient will not be able to decrypt the mail", err)
+					continue
+				}
+				return nil, err
+			}
+			if !seen[k] {
+				pk = append(pk, k)
+				seen[k] = true
+			}
+		}
+	}
+	if len(pk) == 0 {
+		return nil, ErrNoPubKey
+	}
+	return pk, nil
+}
@@ -0,0 +1,300 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package openpgp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+	"github.com/wneessen/go-mail"
+)
+
+func TestNewMapKeyRing(t *testing.T) {
+	_, pu := testKeyPairFor(t, "toni.tester@example.com")
+	kr, err := NewMapKeyRing(pu)
+	if err != nil {
+		t.Fatalf("NewMapKeyRing failed: %s", err)
+	}
+	k, err := kr.PublicKey("Toni.Tester@Example.com")
+	if err != nil {
+		t.Errorf("PublicKey lookup failed: %s", err)
+	}
+	if k != pu {
+		t.Errorf("PublicKey lookup failed. Returned key does not match")
+	}
+	_, err = kr.PublicKey("tina.tester@example.com")
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("PublicKey lookup for unknown address was supposed to fail with ErrKeyNotFound, got: %s", err)
+	}
+	if _, err = NewMapKeyRing("invalid"); err == nil {
+		t.Errorf("NewMapKeyRing with invalid key was supposed to fail, but didn't")
+	}
+}
+
+func TestMiddleware_recipientKeys(t *testing.T) {
+	_, toni := testKeyPairFor(t, "toni@example.com")
+	_, tina := testKeyPairFor(t, "tina@example.com")
+	kr, err := NewMapKeyRing(toni, tina)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	tests := []struct {
+		n  string
+		p  MissingKeyPolicy
+		k  int
+		to int
+		f  bool
+	}{
+		{"fail", MissingKeyFail, 0, 0, true},
+		{"skip", MissingKeySkip, 2, 2, false},
+		{"plaintext", MissingKeyPlaintext, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			mc, err := NewConfig("", "", WithKeyRing(kr), WithMissingKeyPolicy(tt.p))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			mw := NewMiddleware(mc)
+			m := mail.NewMsg()
+			if err = m.To("toni@example.com", "nokey@example.com"); err != nil {
+				t.Fatalf("failed to set To address: %s", err)
+			}
+			if err = m.Bcc("tina@example.com"); err != nil {
+				t.Fatalf("failed to set Bcc address: %s", err)
+			}
+			pk, err := mw.recipientKeys(m)
+			if err != nil && !tt.f {
+				t.Errorf("recipientKeys failed: %s", err)
+			}
+			if err == nil && tt.f {
+				t.Errorf("recipientKeys was supposed to fail, but didn't")
+			}
+			if err != nil && !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("recipientKeys was supposed to fail with ErrKeyNotFound, got: %s", err)
+			}
+			if len(pk) != tt.k {
+				t.Errorf("recipientKeys failed. Expected %d keys, got: %d", tt.k, len(pk))
+			}
+			if !tt.f && len(m.GetTo()) != tt.to {
+				t.Errorf("recipientKeys failed. Expected %d To recipients, got: %d", tt.to, len(m.GetTo()))
+			}
+		})
+	}
+}
+
+func TestMiddleware_recipientKeys_noKeyRing(t *testing.T) {
+	mc, err := NewConfig("", pubKey)
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	mw := NewMiddleware(mc)
+	pk, err := mw.recipientKeys(mail.NewMsg())
+	if err != nil {
+		t.Errorf("recipientKeys failed: %s", err)
+	}
+	if len(pk) != 1 || pk[0] != pubKey {
+		t.Errorf("recipientKeys failed. Expected only the configured public key")
+	}
+	mw.config.PublicKey = ""
+	if _, err = mw.recipientKeys(mail.NewMsg()); !errors.Is(err, ErrNoPubKey) {
+		t.Errorf("recipientKeys without public key was supposed to fail with ErrNoPubKey, got: %s", err)
+	}
+}
+
+func TestMiddleware_Handle_multipleRecipients(t *testing.T) {
+	toniPr, toniPu := testKeyPairFor(t, "toni@example.com")
+	tinaPr, tinaPu := testKeyPairFor(t, "tina@example.com")
+	tomPr, tomPu := testKeyPairFor(t, "tom@example.com")
+	kr, err := NewMapKeyRing(toniPu, tinaPu, tomPu)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	for _, s := range []PGPScheme{SchemePGPInline, SchemePGPMIME} {
+		t.Run(s.String(), func(t *testing.T) {
+			mc, err := NewConfig("", "", WithScheme(s), WithKeyRing(kr))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			m := mail.NewMsg()
+			if err = m.To("toni@example.com"); err != nil {
+				t.Fatalf("failed to set To address: %s", err)
+			}
+			if err = m.Cc("tina@example.com"); err != nil {
+				t.Fatalf("failed to set Cc address: %s", err)
+			}
+			if err = m.Bcc("tom@example.com"); err != nil {
+				t.Fatalf("failed to set Bcc address: %s", err)
+			}
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+			m = NewMiddleware(mc).Handle(m)
+			c, err := m.GetParts()[0].GetContent()
+			if err != nil {
+				t.Fatalf("failed to get part content: %s", err)
+			}
+			ct := string(c)
+			if s == SchemePGPMIME {
+				_, a, _ := strings.Cut(ct, "-----BEGIN PGP MESSAGE-----")
+				a, _, _ = strings.Cut(a, "-----END PGP MESSAGE-----")
+				ct = "-----BEGIN PGP MESSAGE-----" + a + "-----END PGP MESSAGE-----"
+			}
+			for _, pr := range []string{toniPr, tinaPr, tomPr} {
+				pt, err := helper.DecryptBinaryMessageArmored(pr, []byte(testKeyPass), ct)
+				if err != nil {
+					t.Errorf("decryption with recipient key failed: %s", err)
+				}
+				if !strings.Contains(string(pt), "This is the mail body") {
+					t.Errorf("decryption with recipient key failed. Mail body not found")
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_missingKeyPlaintext(t *testing.T) {
+	_, toni := testKeyPairFor(t, "toni@example.com")
+	kr, err := NewMapKeyRing(toni)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	mc, err := NewConfig("", "", WithKeyRing(kr), WithMissingKeyPolicy(MissingKeyPlaintext))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	m := mail.NewMsg()
+	if err = m.To("toni@example.com", "nokey@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	m = NewMiddleware(mc).Handle(m)
+	c, err := m.GetParts()[0].GetContent()
+	if err != nil {
+		t.Fatalf("failed to get part content: %s", err)
+	}
+	if string(c) != "This is the mail body" {
+		t.Errorf("Handle with MissingKeyPlaintext failed. Mail parts seem modified")
+	}
+	if len(m.GetTo()) != 2 {
+		t.Errorf("Handle with MissingKeyPlaintext failed. Recipients seem modified")
+	}
+}
+
+func TestMiddleware_recipientKeys_skipAllMissing(t *testing.T) {
+	_, toni := testKeyPairFor(t, "toni@example.com")
+	kr, err := NewMapKeyRing(toni)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	mc, err := NewConfig("", "", WithKeyRing(kr), WithMissingKeyPolicy(MissingKeySkip))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	m := mail.NewMsg(mail.WithMiddleware(NewMiddleware(mc)))
+	if err = m.To("nokey@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); !errors.Is(err, ErrNoPubKey) {
+		t.Errorf("Handle with MissingKeySkip and no keys was supposed to fail with ErrNoPubKey, got: %s", err)
+	}
+	if strings.Contains(buf.String(), "This is the mail body") {
+		t.Errorf("Handle with MissingKeySkip and no keys failed. Mail body was written unencrypted")
+	}
+}
+
+func TestMiddleware_FilterRecipients(t *testing.T) {
+	_, toni := testKeyPairFor(t, "toni@example.com")
+	_, tina := testKeyPairFor(t, "tina@example.com")
+	kr, err := NewMapKeyRing(toni, tina)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	mc, err := NewConfig("", "", WithKeyRing(kr), WithMissingKeyPolicy(MissingKeySkip))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	mw := NewMiddleware(mc)
+	m := mail.NewMsg()
+	if err = m.To("toni@example.com", "nokey@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	if err = m.Bcc("tina@example.com", "nokey2@example.com"); err != nil {
+		t.Fatalf("failed to set Bcc address: %s", err)
+	}
+	if err = mw.FilterRecipients(m); err != nil {
+		t.Errorf("FilterRecipients failed: %s", err)
+	}
+	rl, err := m.GetRecipients()
+	if err != nil {
+		t.Fatalf("failed to get recipients: %s", err)
+	}
+	if len(rl) != 2 || rl[0] != "<toni@example.com>" || rl[1] != "<tina@example.com>" {
+		t.Errorf("FilterRecipients failed. Unexpected recipients: %v", rl)
+	}
+
+	m = mail.NewMsg()
+	if err = m.To("nokey@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	if err = mw.FilterRecipients(m); !errors.Is(err, ErrNoPubKey) {
+		t.Errorf("FilterRecipients without keys was supposed to fail with ErrNoPubKey, got: %s", err)
+	}
+	if len(m.GetTo()) != 1 {
+		t.Errorf("FilterRecipients without keys failed. Recipients were modified")
+	}
+}
+
+func TestMiddleware_Handle_missingKeyFail(t *testing.T) {
+	_, toni := testKeyPairFor(t, "toni@example.com")
+	kr, err := NewMapKeyRing(toni)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	for _, s := range []PGPScheme{SchemePGPInline, SchemePGPMIME} {
+		t.Run(s.String(), func(t *testing.T) {
+			mc, err := NewConfig("", "", WithScheme(s), WithKeyRing(kr))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			m := mail.NewMsg(mail.WithMiddleware(NewMiddleware(mc)))
+			if err = m.To("toni@example.com", "nokey@example.com"); err != nil {
+				t.Fatalf("failed to set To address: %s", err)
+			}
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+			buf := bytes.Buffer{}
+			_, err = m.WriteTo(&buf)
+			if !errors.Is(err, ErrNotProcessed) || !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("Handle with MissingKeyFail was supposed to fail with ErrKeyNotFound, got: %s", err)
+			}
+			if strings.Contains(buf.String(), "This is the mail body") {
+				t.Errorf("Handle with MissingKeyFail failed. Mail body was written unencrypted")
+			}
+			if _, err = m.GetRecipients(); err == nil {
+				t.Errorf("Handle with MissingKeyFail failed. Recipients were not removed")
+			}
+		})
+	}
+}
+
+func TestMissingKeyPolicy_String(t *testing.T) {
+	tests := []struct {
+		p MissingKeyPolicy
+		s string
+	}{
+		{MissingKeyFail, "fail"},
+		{MissingKeySkip, "skip"},
+		{MissingKeyPlaintext, "plaintext"},
+		{999, "unknown"},
+	}
+	for _, tt := range tests {
+		if tt.p.String() != tt.s {
+			t.Errorf("String() failed. Expected: %q, got: %q", tt.s, tt.p.String())
+		}
+	}
+}
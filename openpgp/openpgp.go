@@ -7,6 +7,11 @@
 package openpgp
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
 	"github.com/wneessen/go-mail"
 )
 
@@ -14,9 +19,16 @@ const (
 	// Type is the type of Middleware
 	Type mail.MiddlewareType = "openpgp"
 	// Version is the version number of the Middleware
-	Version = "0.0.1"
+	Version = "0.1.0"
+	// HeaderError is the mail header field that is set on a mail.Msg that the Middleware
+	// failed to process
+	HeaderError mail.Header = "X-OpenPGP-Error"
 )
 
+// ErrNotProcessed is returned when writing a mail.Msg that the Middleware failed to
+// process. It prevents the mail from being sent unencrypted
+var ErrNotProcessed = errors.New("openpgp: mail message could not be processed")
+
 // Middleware is the middleware struct for the openpgp middleware
 type Middleware struct {
 	config *Config
@@ -36,9 +48,51 @@ func (m *Middleware) Handle(msg *mail.Msg) *mail.Msg {
 	switch m.config.Scheme {
 	case SchemePGPInline:
 		return m.pgpInline(msg)
+	case SchemePGPMIME:
+		return m.pgpMIME(msg)
 	default:
-		m.config.Logger.Errorf("unsupported scheme %q. sending mail unencrypted", m.config.Scheme)
+		return m.fail(msg, fmt.Errorf("%q: %w", m.config.Scheme, ErrUnsupportedScheme))
+	}
+}
+
+// fail handles a processing error for the given mail.Msg according to the configured
+// FailurePolicy. The ErrorHandler of the Config is called first, independent of the policy.
+//
+// fail must only be called as long as the mail.Msg has not been modified, so that with
+// FailOpen the mail is never sent partly processed
+func (m *Middleware) fail(msg *mail.Msg, err error) *mail.Msg {
+	if m.config.ErrorHandler != nil {
+		m.config.ErrorHandler(msg, err)
+	}
+	switch m.config.FailurePolicy {
+	case FailOpen:
+		m.config.Logger.Errorf("%s. sending mail unprocessed", err)
+		return msg
+	case FailQuarantine:
+		buf := bytes.Buffer{}
+		if _, werr := msg.WriteToSkipMiddleware(&buf, Type); werr != nil {
+			m.config.Logger.Errorf("failed to write mail message for quarantine: %s", werr)
+			break
+		}
+		m.config.Quarantine(buf.Bytes(), err)
+	}
+	return m.block(msg, err)
+}
+
+// block makes the given mail.Msg undeliverable after a processing error, so that it is
+// never sent without the requested protection. The recipients are removed, the error is
+// noted in the HeaderError header and the message body is replaced with a body that
+// fails to be written, which aborts the SMTP transaction of the mail.Client
+func (m *Middleware) block(msg *mail.Msg, err error) *mail.Msg {
+	m.config.Logger.Errorf("%s. mail will not be sent", err)
+	for _, h := range recipientHeaders {
+		msg.SetAddrHeaderFromMailAddress(h)
 	}
+	msg.SetGenHeader(HeaderError, err.Error())
+	msg.UnsetAllParts()
+	msg.SetBodyWriter(mail.TypeTextPlain, func(io.Writer) (int64, error) {
+		return 0, fmt.Errorf("%w: %w", ErrNotProcessed, err)
+	}, mail.WithPartEncoding(mail.NoEncoding))
 	return msg
 }
 
@@ -8,9 +8,15 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
 	"strings"
 	"testing"
 
+	"github.com/ProtonMail/gopenpgp/v2/helper"
 	"github.com/wneessen/go-mail"
 )
 
@@ -231,8 +237,8 @@ func TestMiddleware_HandlePGPInline(t *testing.T) {
 }
 
 func TestMiddleware_HandlePGPMIME(t *testing.T) {
-	t.Skip("PGP/MIME not supported yet")
-	mc, err := NewConfig(privKey, pubKey, WithScheme(SchemePGPMIME))
+	pr, pu := testKeyPair(t)
+	mc, err := NewConfig(pr, pu, WithScheme(SchemePGPMIME), WithPrivKeyPass(testKeyPass))
 	if err != nil {
 		t.Errorf("failed to create new config: %s", err)
 	}
@@ -242,30 +248,71 @@ func TestMiddleware_HandlePGPMIME(t *testing.T) {
 	m.Subject("This is a subject")
 	m.SetDate()
 	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	m.AddAlternativeString(mail.TypeTextHTML, "<p>This is the HTML body</p>")
+	if err = m.AttachReader("attachment.txt", strings.NewReader("This is the attachment")); err != nil {
+		t.Errorf("failed to attach file: %s", err)
+	}
 	buf := bytes.Buffer{}
 	_, err = m.WriteTo(&buf)
 	if err != nil {
 		t.Errorf("failed writing message to memory: %s", err)
 	}
-	br := bufio.NewScanner(&buf)
-	fb := false
-	body := ""
-	for br.Scan() {
-		l := br.Text()
-		if l == "" {
-			fb = true
-		}
-		if fb {
-			body += l + "\n"
-		}
+
+	pm, err := netmail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse mail message: %s", err)
 	}
-	bb, err := base64.StdEncoding.DecodeString(body)
+	mt, mp, err := mime.ParseMediaType(pm.Header.Get("Content-Type"))
 	if err != nil {
-		t.Errorf("failed to base64 decode message body: %s", err)
+		t.Fatalf("failed to parse content type: %s", err)
 	}
-	if !strings.Contains(string(bb), `-----BEGIN PGP MESSAGE-----`) ||
-		!strings.Contains(string(bb), `-----END PGP MESSAGE-----`) {
-		t.Errorf("mail encryption failed. Unable to find PGP notation in mail body")
+	if mt != "multipart/encrypted" {
+		t.Errorf("PGP/MIME encryption failed. Expected media type %q, got: %q", "multipart/encrypted", mt)
+	}
+	if mp["protocol"] != string(mail.TypePGPEncrypted) {
+		t.Errorf("PGP/MIME encryption failed. Expected protocol %q, got: %q", mail.TypePGPEncrypted,
+			mp["protocol"])
+	}
+	mr := multipart.NewReader(pm.Body, mp["boundary"])
+	vp, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read PGP/MIME version part: %s", err)
+	}
+	if vp.Header.Get("Content-Type") != string(mail.TypePGPEncrypted) {
+		t.Errorf("PGP/MIME encryption failed. Expected version part of type %q, got: %q",
+			mail.TypePGPEncrypted, vp.Header.Get("Content-Type"))
+	}
+	vb, err := io.ReadAll(vp)
+	if err != nil {
+		t.Errorf("failed to read PGP/MIME version part: %s", err)
+	}
+	if strings.TrimSpace(string(vb)) != "Version: 1" {
+		t.Errorf("PGP/MIME encryption failed. Expected version identification, got: %q", vb)
+	}
+	dp, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read PGP/MIME data part: %s", err)
+	}
+	db, err := io.ReadAll(dp)
+	if err != nil {
+		t.Errorf("failed to read PGP/MIME data part: %s", err)
+	}
+	if _, err = mr.NextPart(); !errors.Is(err, io.EOF) {
+		t.Errorf("PGP/MIME encryption failed. Expected exactly two parts")
+	}
+
+	pt, err := helper.DecryptBinaryMessageArmored(pr, []byte(testKeyPass), string(db))
+	if err != nil {
+		t.Fatalf("PGP/MIME encryption failed. Decryption of message failed: %s", err)
+	}
+	for _, c := range []string{"Content-Type: multipart/mixed", "This is the mail body",
+		"<p>This is the HTML body</p>", `filename="attachment.txt"`} {
+		if !strings.Contains(string(pt), c) {
+			t.Errorf("PGP/MIME encryption failed. Expected %q in decrypted MIME entity", c)
+		}
+	}
+	if strings.Contains(string(pt), "Subject: This is a subject") {
+		t.Errorf("PGP/MIME encryption failed. Outer headers should not be part of the MIME entity")
 	}
 }
 
@@ -282,19 +329,71 @@ func TestMiddleware_HandleUnknown(t *testing.T) {
 	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
 	buf := bytes.Buffer{}
 	_, err = m.WriteTo(&buf)
-	if err != nil {
-		t.Errorf("failed writing message to memory: %s", err)
+	if !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("Handle with unknown scheme was supposed to fail with ErrUnsupportedScheme, got: %s", err)
 	}
-	if len(m.GetParts()) != 1 {
-		t.Errorf("Handle with unknown scheme failed. Mails parts seems modified")
-		return
+	if strings.Contains(buf.String(), "This is the mail body") {
+		t.Errorf("Handle with unknown scheme failed. Mail body was written unencrypted")
 	}
-	pc, err := m.GetParts()[0].GetContent()
-	if err != nil {
-		t.Errorf("failed to get message body part content")
+}
+
+func TestMiddleware_HandleFailurePolicy(t *testing.T) {
+	tests := []struct {
+		n string
+		p FailurePolicy
+	}{
+		{"fail-closed", FailClosed},
+		{"fail-open", FailOpen},
+		{"quarantine", FailQuarantine},
 	}
-	if string(pc) != "This is the mail body" {
-		t.Errorf("Handle with unknown scheme failed. Mails parts seems modified")
+	for _, tt := range tests {
+		for _, s := range []PGPScheme{SchemePGPInline, SchemePGPMIME} {
+			t.Run(tt.n+"/"+s.String(), func(t *testing.T) {
+				var herr error
+				var qmsg []byte
+				mc, err := NewConfig(privKey, pubKey, WithScheme(s), WithAction(999),
+					WithQuarantine(func(msg []byte, _ error) { qmsg = msg }), WithFailurePolicy(tt.p),
+					WithErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+				if err != nil {
+					t.Fatalf("failed to create new config: %s", err)
+				}
+				m := mail.NewMsg(mail.WithMiddleware(NewMiddleware(mc)))
+				if err = m.To("toni.tester@example.com"); err != nil {
+					t.Fatalf("failed to set To address: %s", err)
+				}
+				m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+				if err = m.AttachReader("attachment.txt", strings.NewReader("This is the attachment")); err != nil {
+					t.Fatalf("failed to attach file: %s", err)
+				}
+				buf := bytes.Buffer{}
+				_, err = m.WriteTo(&buf)
+				if !errors.Is(herr, ErrUnsupportedAction) {
+					t.Errorf("ErrorHandler was supposed to be called with ErrUnsupportedAction, got: %s", herr)
+				}
+				if tt.p == FailOpen {
+					if err != nil {
+						t.Errorf("failed writing message to memory: %s", err)
+					}
+					if !strings.Contains(buf.String(), "This is the mail body") ||
+						!strings.Contains(buf.String(), "VGhpcyBpcyB0aGUgYXR0YWNobWVudA==") {
+						t.Errorf("Handle with FailOpen failed. Mail seems modified")
+					}
+					return
+				}
+				if !errors.Is(err, ErrNotProcessed) {
+					t.Errorf("Handle was supposed to fail with ErrNotProcessed, got: %s", err)
+				}
+				if strings.Contains(buf.String(), "This is the mail body") {
+					t.Errorf("Handle failed. Mail body was written unprocessed")
+				}
+				if tt.p == FailQuarantine && !bytes.Contains(qmsg, []byte("This is the mail body")) {
+					t.Errorf("Handle with FailQuarantine failed. Unprocessed mail was not quarantined")
+				}
+				if tt.p == FailClosed && qmsg != nil {
+					t.Errorf("Handle with FailClosed failed. Mail was not supposed to be quarantined")
+				}
+			})
+		}
 	}
 }
 
@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	gocrypto "crypto"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"slices"
+	"strings"
+
+	pgp "github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/ProtonMail/gopenpgp/v2/armor"
+	"github.com/ProtonMail/gopenpgp/v2/constants"
+	"github.com/wneessen/go-mail"
+)
+
+const (
+	// pgpMIMEVersion is the body of the PGP/MIME version identification part
+	pgpMIMEVersion = "Version: 1\r\n"
+	// pgpMIMEFileName is the file name used for the encrypted data part
+	pgpMIMEFileName = "encrypted.asc"
+	// pgpMIMESigFileName is the file name used for the detached signature part
+	pgpMIMESigFileName = "signature.asc"
+)
+
+// protectedHeaders are the header fields that are copied into the encrypted MIME entity
+// of a mail with protected headers
+var protectedHeaders = []string{"Subject", "From", "To", "Date"}
+
+var (
+	// ErrNoHeaderEnd should be returned if the end of the mail header could not be found
+	ErrNoHeaderEnd = errors.New("unable to find end of mail header")
+	// ErrUnsupportedHash should be returned if a signature uses a hash algorithm that
+	// can not be expressed as PGP/MIME micalg parameter
+	ErrUnsupportedHash = errors.New("unsupported signature hash algorithm")
+)
+
+// pgpMIME takes the given mail.Msg and processes the whole MIME entity of the message,
+// including all body parts, alternative parts, embeds and attachments, following the
+// OpenPGP/MIME scheme as described in RFC 3156
+func (m *Middleware) pgpMIME(msg *mail.Msg) *mail.Msg {
+	if m.config.Action == ActionSign {
+		return m.pgpMIMESign(msg)
+	}
+	return m.pgpMIMEEncrypt(msg)
+}
+
+// pgpMIMEEncrypt encrypts the MIME entity of the given mail.Msg and replaces the message
+// body with a multipart/encrypted body
+func (m *Middleware) pgpMIMEEncrypt(msg *mail.Msg) *mail.Msg {
+	pk, err := m.lookupKeys(msg)
+	if err != nil {
+		if errors.Is(err, errSendPlaintext) {
+			m.config.Logger.Warnf("%s", err)
+			return msg
+		}
+		return m.fail(msg, err)
+	}
+	var ph []string
+	if m.config.ProtectedHeaders {
+		ph = protectedHeaders
+	}
+	e, err := mimeEntity(msg, ph...)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to render MIME entity: %w", err))
+	}
+	ct, err := m.processBinary(e, pk)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to encrypt MIME entity: %w", err))
+	}
+
+	buf := bytes.Buffer{}
+	mpw := multipart.NewWriter(&buf)
+	vh := textproto.MIMEHeader{}
+	vh.Set("Content-Type", string(mail.TypePGPEncrypted))
+	vh.Set("Content-Description", "PGP/MIME version identification")
+	pw, err := mpw.CreatePart(vh)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to create PGP/MIME version part: %w", err))
+	}
+	if _, err = io.WriteString(pw, pgpMIMEVersion); err != nil {
+		return m.fail(msg, fmt.Errorf("failed to write PGP/MIME version part: %w", err))
+	}
+	dh := textproto.MIMEHeader{}
+	dh.Set("Content-Type", fmt.Sprintf(`application/octet-stream; name=%q`, pgpMIMEFileName))
+	dh.Set("Content-Description", "OpenPGP encrypted message")
+	dh.Set("Content-Disposition", fmt.Sprintf(`inline; filename=%q`, pgpMIMEFileName))
+	pw, err = mpw.CreatePart(dh)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to create PGP/MIME data part: %w", err))
+	}
+	if _, err = io.WriteString(pw, toCRLF(ct)); err != nil {
+		return m.fail(msg, fmt.Errorf("failed to write PGP/MIME data part: %w", err))
+	}
+	if err = mpw.Close(); err != nil {
+		return m.fail(msg, fmt.Errorf("failed to close PGP/MIME multipart body: %w", err))
+	}
+
+	if m.config.ProtectedHeaders {
+		sp := m.config.SubjectPlaceholder
+		if sp == "" {
+			sp = DefaultSubjectPlaceholder
+		}
+		msg.Subject(sp)
+	}
+	setMIMEBody(msg, fmt.Sprintf(`multipart/encrypted; protocol="%s"; boundary=%q`,
+		mail.TypePGPEncrypted, mpw.Boundary()), buf.Bytes())
+	return msg
+}
+
+// pgpMIMESign creates a detached signature of the MIME entity of the given mail.Msg and
+// replaces the message body with a multipart/signed body. The MIME entity itself is left
+// untouched, so that recipients without OpenPGP support are still able to read the mail
+func (m *Middleware) pgpMIMESign(msg *mail.Msg) *mail.Msg {
+	e, err := mimeEntity(msg)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to render MIME entity: %w", err))
+	}
+	sig, err := m.signDetached(e)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to sign MIME entity: %w", err))
+	}
+	ma, err := micAlg(sig)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to determine message integrity check algorithm: %w", err))
+	}
+	as, err := armor.ArmorWithTypeAndCustomHeaders(sig, constants.PGPSignatureHeader, armorVersion, armorComment)
+	if err != nil {
+		return m.fail(msg, fmt.Errorf("failed to armor signature: %w", err))
+	}
+
+	// The signed MIME entity has to be written as-is, therefore we can't make use of the
+	// multipart.Writer, which would re-format the MIME headers of the part
+	bd := multipart.NewWriter(io.Discard).Boundary()
+	buf := bytes.Buffer{}
+	buf.WriteString("--" + bd + mail.SingleNewLine)
+	buf.Write(e)
+	buf.WriteString(mail.SingleNewLine + "--" + bd + mail.SingleNewLine)
+	buf.WriteString(fmt.Sprintf(`Content-Type: %s; name=%q`, mail.TypePGPSignature, pgpMIMESigFileName) +
+		mail.SingleNewLine)
+	buf.WriteString("Content-Description: OpenPGP digital signature" + mail.SingleNewLine)
+	buf.WriteString(fmt.Sprintf(`Content-Disposition: attachment; filename=%q`, pgpMIMESigFileName) +
+		mail.SingleNewLine)
+	buf.WriteString(mail.SingleNewLine)
+	buf.WriteString(toCRLF(as))
+	buf.WriteString(mail.SingleNewLine + "--" + bd + "--" + mail.SingleNewLine)
+
+	setMIMEBody(msg, fmt.Sprintf(`multipart/signed; micalg=%s; protocol="%s"; boundary=%q`,
+		ma, mail.TypePGPSignature, bd), buf.Bytes())
+	return msg
+}
+
+// signDetached creates a binary detached OpenPGP signature of the given data using
+// the private key of the Config. The signature is always created with SHA-256, which
+// results in the pgp-sha256 micalg of the multipart/signed body
+func (m *Middleware) signDetached(d []byte) ([]byte, error) {
+	kr, err := m.config.privKeyRing()
+	if err != nil {
+		return nil, err
+	}
+	defer kr.ClearPrivateParams()
+	buf := bytes.Buffer{}
+	sc := &packet.Config{DefaultHash: gocrypto.SHA256}
+	if err = pgp.DetachSign(&buf, kr.GetKeys()[0].GetEntity(), bytes.NewReader(d), sc); err != nil {
+		return nil, fmt.Errorf("failed to create detached signature: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// micAlg returns the PGP/MIME micalg parameter value for the hash algorithm used in
+// the given binary OpenPGP signature
+//
+// See: https://datatracker.ietf.org/doc/html/rfc3156#section-5
+func micAlg(sig []byte) (string, error) {
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return "", fmt.Errorf("failed to read signature packet: %w", err)
+	}
+	sp, ok := p.(*packet.Signature)
+	if !ok {
+		return "", fmt.Errorf("unexpected packet type %T: %w", p, ErrUnsupportedHash)
+	}
+	return micAlgFromHash(sp.Hash)
+}
+
+// micAlgFromHash returns the PGP/MIME micalg parameter value for the given hash algorithm
+func micAlgFromHash(h gocrypto.Hash) (string, error) {
+	switch h {
+	case gocrypto.SHA1:
+		return "pgp-sha1", nil
+	case gocrypto.SHA224:
+		return "pgp-sha224", nil
+	case gocrypto.SHA256:
+		return "pgp-sha256", nil
+	case gocrypto.SHA384:
+		return "pgp-sha384", nil
+	case gocrypto.SHA512:
+		return "pgp-sha512", nil
+	default:
+		return "", fmt.Errorf("%s: %w", h, ErrUnsupportedHash)
+	}
+}
+
+// mimeEntity renders the given mail.Msg, skipping this Middleware, and returns the
+// MIME entity of the message. The MIME entity consists of the Content-* header fields
+// and the complete message body. If protected header fields are given, they are copied
+// into the MIME entity and its Content-Type is marked with the protected-headers parameter
+//
+// See: https://datatracker.ietf.org/doc/html/draft-autocrypt-lamps-protected-headers
+func mimeEntity(msg *mail.Msg, ph ...string) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if _, err := msg.WriteToSkipMiddleware(&buf, Type); err != nil {
+		return nil, fmt.Errorf("failed to write mail message to memory: %w", err)
+	}
+	hf, body, err := splitMessage(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	e := bytes.Buffer{}
+	for _, f := range hf {
+		n := headerName(f)
+		switch {
+		case len(ph) > 0 && strings.EqualFold(n, "Content-Type"):
+			e.WriteString(strings.TrimRight(f, "\r\n") + ";" + mail.SingleNewLine +
+				` protected-headers="v1"` + mail.SingleNewLine)
+		case strings.HasPrefix(strings.ToLower(n), "content-"):
+			e.WriteString(f)
+		case slices.ContainsFunc(ph, func(p string) bool { return strings.EqualFold(p, n) }):
+			e.WriteString(f)
+		}
+	}
+	e.WriteString(mail.SingleNewLine)
+	e.Write(body)
+	return e.Bytes(), nil
+}
+
+// splitMessage splits a rendered mail message into its raw header fields
+// and the message body
+func splitMessage(d []byte) ([]string, []byte, error) {
+	var hf []string
+	br := bufio.NewReader(bytes.NewReader(d))
+	n := 0
+	for {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			return nil, nil, ErrNoHeaderEnd
+		}
+		n += len(l)
+		if l == mail.SingleNewLine || l == "\n" {
+			break
+		}
+		if len(hf) > 0 && (l[0] == ' ' || l[0] == '\t') {
+			hf[len(hf)-1] += l
+			continue
+		}
+		hf = append(hf, l)
+	}
+	return hf, d[n:], nil
+}
+
+// headerName returns the name of a raw header field
+func headerName(f string) string {
+	n, _, _ := strings.Cut(f, ":")
+	return strings.TrimSpace(n)
+}
+
+// setMIMEBody replaces the body parts, embeds and attachments of the given mail.Msg
+// with a single, preformatted MIME body of the given content type
+func setMIMEBody(msg *mail.Msg, ct string, body []byte) {
+	msg.UnsetAllParts()
+	msg.SetBodyWriter(mail.ContentType(ct), func(w io.Writer) (int64, error) {
+		n, err := w.Write(body)
+		return int64(n), err
+	}, mail.WithPartEncoding(mail.NoEncoding))
+}
+
+// toCRLF converts the line endings of the given string to CRLF
+func toCRLF(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
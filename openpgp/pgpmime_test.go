@@ -0,0 +1,400 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package openpgp
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"errors"
+	"io"
+	"mime"
+	netmail "net/mail"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+	"github.com/wneessen/go-mail"
+)
+
+// testKeyPass is the passphrase used for the OpenPGP keys generated by testKeyPair
+const testKeyPass = "go-mail-middleware"
+
+// testKeyPair generates a new, passphrase protected OpenPGP key pair for testing. Other
+// than the static test keys, the generated keys do not require the PRIV_KEY_PASS
+// environment variable to be set
+func testKeyPair(t *testing.T) (string, string) {
+	t.Helper()
+	return testKeyPairFor(t, "nobody@go-mail.dev")
+}
+
+// testKeyPairFor generates a new, passphrase protected OpenPGP key pair for the given
+// mail address
+func testKeyPairFor(t *testing.T, a string) (string, string) {
+	t.Helper()
+	pr, err := helper.GenerateKey("go-mail-middleware", a, []byte(testKeyPass), "x25519", 0)
+	if err != nil {
+		t.Fatalf("failed to generate private key: %s", err)
+	}
+	k, err := crypto.NewKeyFromArmored(pr)
+	if err != nil {
+		t.Fatalf("failed to parse private key: %s", err)
+	}
+	pu, err := k.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatalf("failed to get public key: %s", err)
+	}
+	return pr, pu
+}
+
+func TestMiddleware_pgpMIME(t *testing.T) {
+	tests := []struct {
+		n string
+		a Action
+	}{
+		{"Encrypt-only", ActionEncrypt},
+		{"Encrypt/Sign", ActionEncryptAndSign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			pr, pu := testKeyPair(t)
+			mc, err := NewConfig(pr, pu, WithScheme(SchemePGPMIME), WithAction(tt.a),
+				WithPrivKeyPass(testKeyPass))
+			if err != nil {
+				t.Errorf("failed to create new config: %s", err)
+			}
+			mw := NewMiddleware(mc)
+			m := mail.NewMsg()
+			m.Subject("This is a subject")
+			m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+			m = mw.pgpMIME(m)
+			if len(m.GetParts()) != 1 {
+				t.Fatalf("pgpMIME failed. Expected 1 part, got: %d", len(m.GetParts()))
+			}
+			ct := string(m.GetParts()[0].GetContentType())
+			if !strings.HasPrefix(ct, "multipart/encrypted;") {
+				t.Errorf("pgpMIME failed. Expected multipart/encrypted content type, got: %q", ct)
+			}
+			c, err := m.GetParts()[0].GetContent()
+			if err != nil {
+				t.Errorf("failed to get part content: %s", err)
+			}
+			if !bytes.Contains(c, []byte("-----BEGIN PGP MESSAGE-----\r\n")) {
+				t.Errorf("pgpMIME failed. Unable to find CRLF terminated PGP notation in mail body")
+			}
+		})
+	}
+}
+
+func TestMiddleware_pgpMIME_unsupportedAction(t *testing.T) {
+	pr, pu := testKeyPair(t)
+	mc, err := NewConfig(pr, pu, WithScheme(SchemePGPMIME), WithAction(999))
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	mw := NewMiddleware(mc)
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err = m.To("toni.tester@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	_, err = m.WriteTo(&buf)
+	if !errors.Is(err, ErrNotProcessed) {
+		t.Errorf("pgpMIME with unsupported action was supposed to fail with ErrNotProcessed, got: %s", err)
+	}
+	if !errors.Is(err, ErrUnsupportedAction) {
+		t.Errorf("pgpMIME with unsupported action was supposed to fail with ErrUnsupportedAction, got: %s", err)
+	}
+	if strings.Contains(buf.String(), "This is the mail body") {
+		t.Errorf("pgpMIME with unsupported action failed. Mail body was written unencrypted")
+	}
+	if _, err = m.GetRecipients(); err == nil {
+		t.Errorf("pgpMIME with unsupported action failed. Recipients were not removed")
+	}
+	if len(m.GetGenHeader(HeaderError)) != 1 {
+		t.Errorf("pgpMIME with unsupported action failed. Expected %s header", HeaderError)
+	}
+}
+
+func TestMimeEntity(t *testing.T) {
+	m := mail.NewMsg()
+	m.Subject("This is a subject")
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	e, err := mimeEntity(m)
+	if err != nil {
+		t.Fatalf("mimeEntity failed: %s", err)
+	}
+	hf, body, err := splitMessage(e)
+	if err != nil {
+		t.Fatalf("failed to split MIME entity: %s", err)
+	}
+	for _, f := range hf {
+		if !strings.HasPrefix(headerName(f), "Content-") {
+			t.Errorf("mimeEntity failed. Unexpected header field: %q", f)
+		}
+	}
+	if len(hf) != 2 {
+		t.Errorf("mimeEntity failed. Expected 2 header fields, got: %d", len(hf))
+	}
+	if !strings.Contains(string(body), "This is the mail body") {
+		t.Errorf("mimeEntity failed. Mail body not found in MIME entity")
+	}
+}
+
+func TestMimeEntity_protectedHeaders(t *testing.T) {
+	m := mail.NewMsg()
+	if err := m.From("toni@example.com"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	if err := m.Cc("tina@example.com"); err != nil {
+		t.Fatalf("failed to set Cc address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	e, err := mimeEntity(m, protectedHeaders...)
+	if err != nil {
+		t.Fatalf("mimeEntity failed: %s", err)
+	}
+	pm, err := netmail.ReadMessage(bytes.NewReader(e))
+	if err != nil {
+		t.Fatalf("failed to parse MIME entity: %s", err)
+	}
+	if pm.Header.Get("Subject") != "This is a subject" {
+		t.Errorf("mimeEntity failed. Expected protected Subject, got: %q", pm.Header.Get("Subject"))
+	}
+	if pm.Header.Get("From") != "<toni@example.com>" {
+		t.Errorf("mimeEntity failed. Expected protected From, got: %q", pm.Header.Get("From"))
+	}
+	if pm.Header.Get("Cc") != "" {
+		t.Errorf("mimeEntity failed. Cc is not supposed to be a protected header field")
+	}
+	_, mp, err := mime.ParseMediaType(pm.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %s", err)
+	}
+	if mp["protected-headers"] != "v1" {
+		t.Errorf("mimeEntity failed. Expected protected-headers parameter, got: %q",
+			pm.Header.Get("Content-Type"))
+	}
+}
+
+func TestMiddleware_pgpMIME_protectedHeaders(t *testing.T) {
+	tests := []struct {
+		n string
+		p string
+		e string
+	}{
+		{"default placeholder", "", DefaultSubjectPlaceholder},
+		{"custom placeholder", "Encrypted message", "Encrypted message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			pr, pu := testKeyPair(t)
+			mc, err := NewConfig(pr, pu, WithScheme(SchemePGPMIME), WithProtectedHeaders(tt.p))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			raw := testOutgoingMail(t, mc)
+			if bytes.Contains(raw, []byte("This is a subject")) {
+				t.Errorf("pgpMIME with protected headers failed. Subject found in cleartext")
+			}
+
+			dc, err := NewDecrypterConfig(pr, "", WithDecrypterPrivKeyPass(testKeyPass))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			msg, err := NewDecrypter(dc).DecryptBytes(raw)
+			if err != nil {
+				t.Fatalf("failed to decrypt mail: %s", err)
+			}
+			if msg.Header.Get("Subject") != tt.e {
+				t.Errorf("pgpMIME with protected headers failed. Expected outer Subject %q, got: %q", tt.e,
+					msg.Header.Get("Subject"))
+			}
+			if msg.ProtectedHeader == nil {
+				t.Fatalf("pgpMIME with protected headers failed. No protected headers found")
+			}
+			for _, h := range protectedHeaders {
+				if msg.ProtectedHeader.Get(h) == "" {
+					t.Errorf("pgpMIME with protected headers failed. Protected %s header missing", h)
+				}
+			}
+			if msg.ProtectedHeader.Get("Subject") != "This is a subject" {
+				t.Errorf("pgpMIME with protected headers failed. Expected protected Subject %q, got: %q",
+					"This is a subject", msg.ProtectedHeader.Get("Subject"))
+			}
+			if msg.ProtectedHeader.Get("To") != msg.Header.Get("To") {
+				t.Errorf("pgpMIME with protected headers failed. Protected To does not match outer To")
+			}
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	d := "Subject: Test\r\nContent-Type: multipart/mixed;\r\n boundary=abc\r\n\r\nBody\r\n"
+	hf, body, err := splitMessage([]byte(d))
+	if err != nil {
+		t.Fatalf("splitMessage failed: %s", err)
+	}
+	if len(hf) != 2 {
+		t.Fatalf("splitMessage failed. Expected 2 header fields, got: %d", len(hf))
+	}
+	if hf[1] != "Content-Type: multipart/mixed;\r\n boundary=abc\r\n" {
+		t.Errorf("splitMessage failed. Folded header field not preserved, got: %q", hf[1])
+	}
+	if headerName(hf[1]) != "Content-Type" {
+		t.Errorf("headerName failed. Expected: %q, got: %q", "Content-Type", headerName(hf[1]))
+	}
+	if string(body) != "Body\r\n" {
+		t.Errorf("splitMessage failed. Expected body: %q, got: %q", "Body\r\n", body)
+	}
+	_, _, err = splitMessage([]byte("Subject: Test\r\n"))
+	if !errors.Is(err, ErrNoHeaderEnd) {
+		t.Errorf("splitMessage without header end was supposed to fail, but didn't")
+	}
+}
+
+func TestMiddleware_pgpMIMESign(t *testing.T) {
+	pr, pu := testKeyPair(t)
+	mc, err := NewConfig(pr, pu, WithScheme(SchemePGPMIME), WithAction(ActionSign),
+		WithPrivKeyPass(testKeyPass))
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	mw := NewMiddleware(mc)
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	m.Subject("This is a subject")
+	m.SetDate()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	m.AddAlternativeString(mail.TypeTextHTML, "<p>This is the HTML body</p>")
+	if err = m.AttachReader("attachment.bin", bytes.NewReader([]byte{0x00, 0xff, 0x0d, 0x0a, 0x80})); err != nil {
+		t.Errorf("failed to attach file: %s", err)
+	}
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); err != nil {
+		t.Errorf("failed writing message to memory: %s", err)
+	}
+
+	pm, err := netmail.ReadMessage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to parse mail message: %s", err)
+	}
+	mt, mp, err := mime.ParseMediaType(pm.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %s", err)
+	}
+	if mt != "multipart/signed" {
+		t.Errorf("pgpMIMESign failed. Expected media type %q, got: %q", "multipart/signed", mt)
+	}
+	if mp["protocol"] != string(mail.TypePGPSignature) {
+		t.Errorf("pgpMIMESign failed. Expected protocol %q, got: %q", mail.TypePGPSignature, mp["protocol"])
+	}
+	if mp["micalg"] != "pgp-sha256" {
+		t.Errorf("pgpMIMESign failed. Expected micalg %q, got: %q", "pgp-sha256", mp["micalg"])
+	}
+
+	// We need the raw bytes of the signed part, so we can't use a multipart.Reader here
+	body, err := io.ReadAll(pm.Body)
+	if err != nil {
+		t.Fatalf("failed to read mail body: %s", err)
+	}
+	bd := "--" + mp["boundary"]
+	sp := strings.Split(string(body), "\r\n"+bd)
+	if len(sp) != 3 || !strings.HasPrefix(sp[0], bd+"\r\n") {
+		t.Fatalf("pgpMIMESign failed. Unexpected multipart/signed structure")
+	}
+	se := strings.TrimPrefix(sp[0], bd+"\r\n")
+	if !strings.HasPrefix(se, "Content-") || !strings.Contains(se, "This is the mail body") ||
+		!strings.Contains(se, "<p>This is the HTML body</p>") {
+		t.Errorf("pgpMIMESign failed. Signed MIME entity is incomplete")
+	}
+	if strings.Contains(se, "Subject:") {
+		t.Errorf("pgpMIMESign failed. Outer headers should not be part of the signed MIME entity")
+	}
+
+	sigPart := sp[1]
+	if !strings.Contains(sigPart, "Content-Type: "+string(mail.TypePGPSignature)) {
+		t.Errorf("pgpMIMESign failed. Signature part has wrong content type")
+	}
+	_, as, ok := strings.Cut(sigPart, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("pgpMIMESign failed. Unable to find signature part body")
+	}
+	sig, err := crypto.NewPGPSignatureFromArmored(as)
+	if err != nil {
+		t.Fatalf("failed to parse armored signature: %s", err)
+	}
+	pk, err := crypto.NewKeyFromArmored(pu)
+	if err != nil {
+		t.Fatalf("failed to parse public key: %s", err)
+	}
+	kr, err := crypto.NewKeyRing(pk)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %s", err)
+	}
+	if err = kr.VerifyDetached(crypto.NewPlainMessage([]byte(se)), sig, crypto.GetUnixTime()); err != nil {
+		t.Errorf("pgpMIMESign failed. Signature verification failed: %s", err)
+	}
+	if err = kr.VerifyDetached(crypto.NewPlainMessage([]byte(se+" ")), sig, crypto.GetUnixTime()); err == nil {
+		t.Errorf("pgpMIMESign failed. Signature verification of modified entity was supposed to fail")
+	}
+}
+
+func TestMiddleware_pgpMIMESign_noPrivKey(t *testing.T) {
+	_, pu := testKeyPair(t)
+	mc, err := NewConfig("", pu, WithScheme(SchemePGPMIME))
+	if err != nil {
+		t.Errorf("failed to create new config: %s", err)
+	}
+	mc.Action = ActionSign
+	mw := NewMiddleware(mc)
+	m := mail.NewMsg()
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	m = mw.pgpMIME(m)
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); !errors.Is(err, ErrNoPrivKey) {
+		t.Errorf("pgpMIMESign without private key was supposed to fail with ErrNoPrivKey, got: %s", err)
+	}
+	if strings.Contains(buf.String(), "This is the mail body") {
+		t.Errorf("pgpMIMESign without private key failed. Mail body was written unsigned")
+	}
+}
+
+func TestMicAlg(t *testing.T) {
+	if _, err := micAlg([]byte("invalid")); err == nil {
+		t.Errorf("micAlg with invalid signature was supposed to fail, but didn't")
+	}
+}
+
+func TestMicAlgFromHash(t *testing.T) {
+	tests := []struct {
+		h gocrypto.Hash
+		s string
+		f bool
+	}{
+		{gocrypto.SHA1, "pgp-sha1", false},
+		{gocrypto.SHA224, "pgp-sha224", false},
+		{gocrypto.SHA256, "pgp-sha256", false},
+		{gocrypto.SHA384, "pgp-sha384", false},
+		{gocrypto.SHA512, "pgp-sha512", false},
+		{gocrypto.MD5, "", true},
+		{gocrypto.SHA3_256, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.h.String(), func(t *testing.T) {
+			s, err := micAlgFromHash(tt.h)
+			if tt.f && !errors.Is(err, ErrUnsupportedHash) {
+				t.Errorf("micAlgFromHash was supposed to fail with ErrUnsupportedHash, got: %s", err)
+			}
+			if !tt.f && err != nil {
+				t.Errorf("micAlgFromHash failed: %s", err)
+			}
+			if s != tt.s {
+				t.Errorf("micAlgFromHash failed. Expected: %q, got: %q", tt.s, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrCertNotFound should be returned by a CertStore if no certificate is available
+	// for a mail address
+	ErrCertNotFound = errors.New("no certificate found for mail address")
+	// ErrNoCertEmail should be returned if a certificate does not hold any mail address
+	ErrNoCertEmail = errors.New("certificate holds no mail address")
+)
+
+// CertStore is an interface for looking up the X.509 certificate of a mail recipient
+type CertStore interface {
+	// Certificate returns the X.509 certificate for the given mail address. If no
+	// certificate is available for the address, an error wrapping ErrCertNotFound is
+	// returned
+	Certificate(addr string) (*x509.Certificate, error)
+}
+
+// MapCertStore is a simple, in-memory CertStore that maps (lower-case) mail addresses
+// to X.509 certificates
+type MapCertStore map[string]*x509.Certificate
+
+// NewMapCertStore returns a new MapCertStore from the given PEM encoded X.509
+// certificates. Each certificate is added for all the mail addresses found in its
+// subject alternative names
+func NewMapCertStore(certs ...[]byte) (MapCertStore, error) {
+	cs := make(MapCertStore)
+	for _, c := range certs {
+		if err := cs.Add(c); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// Add adds all the given PEM encoded X.509 certificates to the MapCertStore for all the
+// mail addresses found in their subject alternative names
+func (cs MapCertStore) Add(c []byte) error {
+	cl, err := parseCertificates(c)
+	if err != nil {
+		return err
+	}
+	for _, cert := range cl {
+		if len(cert.EmailAddresses) == 0 {
+			return fmt.Errorf("%s: %w", cert.Subject, ErrNoCertEmail)
+		}
+		for _, a := range cert.EmailAddresses {
+			cs[strings.ToLower(a)] = cert
+		}
+	}
+	return nil
+}
+
+// Certificate satisfies the CertStore interface for the MapCertStore type
+func (cs MapCertStore) Certificate(addr string) (*x509.Certificate, error) {
+	c, ok := cs[strings.ToLower(addr)]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", addr, ErrCertNotFound)
+	}
+	return c, nil
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewMapCertStore(t *testing.T) {
+	ca := newTestCA(t)
+	toni := newTestRecipient(t, ca, "Toni.Recipient@example.com")
+	tina := newTestRecipient(t, ca, "tina.recipient@example.com")
+	cs, err := NewMapCertStore(testPEM(toni.cert, tina.cert))
+	if err != nil {
+		t.Fatalf("NewMapCertStore failed: %s", err)
+	}
+	c, err := cs.Certificate("toni.recipient@EXAMPLE.com")
+	if err != nil {
+		t.Fatalf("Certificate lookup failed: %s", err)
+	}
+	if !c.Equal(toni.cert) {
+		t.Errorf("Certificate lookup failed. Unexpected certificate")
+	}
+	if _, err = cs.Certificate("tina.recipient@example.com"); err != nil {
+		t.Errorf("Certificate lookup failed: %s", err)
+	}
+	if _, err = cs.Certificate("unknown@example.com"); !errors.Is(err, ErrCertNotFound) {
+		t.Errorf("Certificate lookup of unknown address was supposed to fail with ErrCertNotFound, got: %s", err)
+	}
+}
+
+func TestNewMapCertStore_fails(t *testing.T) {
+	ca := newTestCA(t)
+	if _, err := NewMapCertStore(testPEM(ca.inter)); !errors.Is(err, ErrNoCertEmail) {
+		t.Errorf("NewMapCertStore with CA certificate was supposed to fail with ErrNoCertEmail, got: %s", err)
+	}
+	if _, err := NewMapCertStore([]byte("invalid")); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("NewMapCertStore with invalid certificate was supposed to fail with ErrNoCertificate, got: %s", err)
+	}
+}
@@ -0,0 +1,354 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// ContentEncryption is an alias type for an int
+type ContentEncryption int
+
+// FailurePolicy is an alias type for an int
+type FailurePolicy int
+
+// ErrorHandler is a function that is called with the mail.Msg and the error whenever
+// the Middleware fails to sign or the EncryptMiddleware fails to encrypt a mail
+type ErrorHandler func(msg *mail.Msg, err error)
+
+const (
+	// AES256CBC encrypts the content with AES-256 in CBC mode as enveloped-data. This is
+	// the default, since it is supported by all S/MIME capable mail clients
+	AES256CBC ContentEncryption = iota
+	// AES128CBC encrypts the content with AES-128 in CBC mode as enveloped-data
+	AES128CBC
+	// AES256GCM encrypts the content with AES-256 in GCM mode as authEnveloped-data
+	AES256GCM
+	// AES128GCM encrypts the content with AES-128 in GCM mode as authEnveloped-data
+	AES128GCM
+)
+
+const (
+	// FailClosed will make a mail that could not be signed or encrypted undeliverable. The
+	// recipients are removed, the error is noted in the HeaderError header and writing the
+	// mail fails with an error wrapping ErrNotSigned or ErrNotProcessed
+	FailClosed FailurePolicy = iota
+	// FailOpen will send a mail that could not be signed or encrypted without any modification
+	FailOpen
+)
+
+// SignerConfig is the configuration to use in Middleware creation
+type SignerConfig struct {
+	// Certificate represents the X.509 certificate of the signer. The certificate must
+	// match the private key the Middleware is created with
+	//
+	// Certificate MUST not be nil
+	Certificate *x509.Certificate
+
+	// Chain is an optional list of intermediate certificates that is included in the
+	// signature, so that the recipient is able to build the path from the Certificate
+	// to a trusted root certificate
+	Chain []*x509.Certificate
+
+	// HashAlgo represents the message digest algorithm used for the signature
+	//
+	// S/MIME signatures support the following hashing algorithms
+	//   - SHA256: This is the default and prefered algorithm
+	//   - SHA384
+	//   - SHA512
+	HashAlgo crypto.Hash
+
+	// ErrorHandler is an optional function that is called for every mail that the
+	// Middleware fails to sign, independent of the FailurePolicy
+	ErrorHandler ErrorHandler
+
+	// FailurePolicy defines how to handle a mail that the Middleware fails to sign. If
+	// not set, we default to FailClosed
+	FailurePolicy FailurePolicy
+
+	// Logger represents a log that satisfies the log.Logger interface
+	Logger *log.Logger
+}
+
+// SignerOption returns a function that can be used for grouping SignerConfig options
+type SignerOption func(config *SignerConfig) error
+
+// NewConfig returns a new SignerConfig struct. It requires the PEM encoded X.509
+// certificate c of the signer. Any additional certificate in c is added to the
+// certificate chain. All other values can be prefilled using the With*() SignerOption
+// methods
+func NewConfig(c []byte, o ...SignerOption) (*SignerConfig, error) {
+	cl, err := parseCertificates(c)
+	if err != nil {
+		return nil, err
+	}
+	sc := &SignerConfig{
+		Certificate: cl[0],
+		Chain:       cl[1:],
+		HashAlgo:    crypto.SHA256,
+	}
+
+	// Override defaults with optionally provided Option functions
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		if err := co(sc); err != nil {
+			return sc, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	// Create a log.Logger if none was provided
+	if sc.Logger == nil {
+		sc.Logger = log.New(os.Stderr, "smime", log.LevelWarn)
+	}
+
+	return sc, nil
+}
+
+// WithChain provides the PEM encoded intermediate certificates for the SignerConfig
+func WithChain(c []byte) SignerOption {
+	return func(sc *SignerConfig) error {
+		return sc.SetChain(c)
+	}
+}
+
+// WithHashAlgo provides the Hashing algorithm to the SignerConfig
+func WithHashAlgo(ha crypto.Hash) SignerOption {
+	return func(sc *SignerConfig) error {
+		return sc.SetHashAlgo(ha)
+	}
+}
+
+// WithSignerErrorHandler provides an ErrorHandler to the SignerConfig
+func WithSignerErrorHandler(h ErrorHandler) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.ErrorHandler = h
+		return nil
+	}
+}
+
+// WithSignerFailurePolicy provides the FailurePolicy to the SignerConfig
+func WithSignerFailurePolicy(p FailurePolicy) SignerOption {
+	return func(sc *SignerConfig) error {
+		if p != FailClosed && p != FailOpen {
+			return fmt.Errorf("%s: %w", p, ErrInvalidFailurePolicy)
+		}
+		sc.FailurePolicy = p
+		return nil
+	}
+}
+
+// WithSignerLogger provides a log.Logger to the SignerConfig
+func WithSignerLogger(l *log.Logger) SignerOption {
+	return func(sc *SignerConfig) error {
+		sc.Logger = l
+		return nil
+	}
+}
+
+// SetChain sets/overrides the certificate chain of the SignerConfig with the given PEM
+// encoded intermediate certificates
+func (sc *SignerConfig) SetChain(c []byte) error {
+	cl, err := parseCertificates(c)
+	if err != nil {
+		return err
+	}
+	sc.Chain = cl
+	return nil
+}
+
+// SetHashAlgo sets/override the hashing algorithm of the SignerConfig
+func (sc *SignerConfig) SetHashAlgo(ha crypto.Hash) error {
+	if !sc.HashAlgoIsValid(ha) {
+		return fmt.Errorf("%s: %w", ha.String(), ErrInvalidHashAlgo)
+	}
+	sc.HashAlgo = ha
+	return nil
+}
+
+// HashAlgoIsValid returns true if a the provided crypto.Hash is a valid algorithm for the SignerConfig
+func (sc *SignerConfig) HashAlgoIsValid(ha crypto.Hash) bool {
+	switch ha {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return false
+	}
+	return true
+}
+
+// EncrypterConfig is the configuration to use in EncryptMiddleware creation
+type EncrypterConfig struct {
+	// CertStore is used to look up the certificate of each To, Cc and Bcc recipient
+	// of the mail
+	//
+	// CertStore MUST not be nil
+	CertStore CertStore
+
+	// ContentEncryption represents the content encryption algorithm. If not set, we
+	// default to AES256CBC
+	ContentEncryption ContentEncryption
+
+	// ErrorHandler is an optional function that is called for every mail that the
+	// EncryptMiddleware fails to encrypt, independent of the FailurePolicy
+	ErrorHandler ErrorHandler
+
+	// FailurePolicy defines how to handle a mail that the EncryptMiddleware fails to
+	// encrypt. If not set, we default to FailClosed
+	FailurePolicy FailurePolicy
+
+	// Logger represents a log that satisfies the log.Logger interface
+	Logger *log.Logger
+}
+
+// EncrypterOption returns a function that can be used for grouping EncrypterConfig options
+type EncrypterOption func(config *EncrypterConfig) error
+
+// NewEncrypterConfig returns a new EncrypterConfig struct. It requires a CertStore cs
+// for the recipient certificate lookup. All other values can be prefilled using the
+// With*() EncrypterOption methods
+func NewEncrypterConfig(cs CertStore, o ...EncrypterOption) (*EncrypterConfig, error) {
+	if cs == nil {
+		return nil, ErrNoCertStore
+	}
+	ec := &EncrypterConfig{
+		CertStore:         cs,
+		ContentEncryption: AES256CBC,
+		FailurePolicy:     FailClosed,
+	}
+
+	// Override defaults with optionally provided Option functions
+	for _, co := range o {
+		if co == nil {
+			continue
+		}
+		if err := co(ec); err != nil {
+			return ec, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	// Create a log.Logger if none was provided
+	if ec.Logger == nil {
+		ec.Logger = log.New(os.Stderr, "smime", log.LevelWarn)
+	}
+
+	return ec, nil
+}
+
+// WithContentEncryption provides the ContentEncryption to the EncrypterConfig
+func WithContentEncryption(ce ContentEncryption) EncrypterOption {
+	return func(ec *EncrypterConfig) error {
+		if ce.keySize() == 0 {
+			return fmt.Errorf("%s: %w", ce, ErrInvalidContentEncryption)
+		}
+		ec.ContentEncryption = ce
+		return nil
+	}
+}
+
+// WithErrorHandler provides an ErrorHandler to the EncrypterConfig
+func WithErrorHandler(h ErrorHandler) EncrypterOption {
+	return func(ec *EncrypterConfig) error {
+		ec.ErrorHandler = h
+		return nil
+	}
+}
+
+// WithFailurePolicy provides the FailurePolicy to the EncrypterConfig
+func WithFailurePolicy(p FailurePolicy) EncrypterOption {
+	return func(ec *EncrypterConfig) error {
+		if p != FailClosed && p != FailOpen {
+			return fmt.Errorf("%s: %w", p, ErrInvalidFailurePolicy)
+		}
+		ec.FailurePolicy = p
+		return nil
+	}
+}
+
+// WithLogger provides a log.Logger to the EncrypterConfig
+func WithLogger(l *log.Logger) EncrypterOption {
+	return func(ec *EncrypterConfig) error {
+		ec.Logger = l
+		return nil
+	}
+}
+
+// String satisfies the fmt.Stringer interface for the ContentEncryption type
+func (ce ContentEncryption) String() string {
+	switch ce {
+	case AES256CBC:
+		return "AES-256-CBC"
+	case AES128CBC:
+		return "AES-128-CBC"
+	case AES256GCM:
+		return "AES-256-GCM"
+	case AES128GCM:
+		return "AES-128-GCM"
+	default:
+		return "unknown"
+	}
+}
+
+// keySize returns the key size in bytes of the ContentEncryption or 0 if the
+// ContentEncryption is not supported
+func (ce ContentEncryption) keySize() int {
+	switch ce {
+	case AES128CBC, AES128GCM:
+		return 16
+	case AES256CBC, AES256GCM:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// authenticated returns true if the ContentEncryption is an authenticated encryption
+// mode, that results in an authEnveloped-data structure
+func (ce ContentEncryption) authenticated() bool {
+	return ce == AES128GCM || ce == AES256GCM
+}
+
+// String satisfies the fmt.Stringer interface for the FailurePolicy type
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailClosed:
+		return "fail-closed"
+	case FailOpen:
+		return "fail-open"
+	default:
+		return "unknown"
+	}
+}
+
+// parseCertificates parses all PEM encoded X.509 certificates in the given byte slice
+func parseCertificates(c []byte) ([]*x509.Certificate, error) {
+	var cl []*x509.Certificate
+	for {
+		var dp *pem.Block
+		dp, c = pem.Decode(c)
+		if dp == nil {
+			break
+		}
+		if dp.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(dp.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		cl = append(cl, cert)
+	}
+	if len(cl) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return cl, nil
+}
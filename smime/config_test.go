@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+func TestNewConfig(t *testing.T) {
+	ca := newTestCA(t)
+	k, _ := testECDSAKey(t)
+	c := ca.issue(t, "toni.sender@example.com", k.Public())
+	sc, err := NewConfig(testPEM(c, ca.inter))
+	if err != nil {
+		t.Fatalf("NewConfig failed: %s", err)
+	}
+	if !sc.Certificate.Equal(c) {
+		t.Errorf("NewConfig failed. Expected first certificate as signer certificate")
+	}
+	if len(sc.Chain) != 1 || !sc.Chain[0].Equal(ca.inter) {
+		t.Errorf("NewConfig failed. Expected intermediate certificate in chain")
+	}
+	if sc.HashAlgo != crypto.SHA256 {
+		t.Errorf("NewConfig failed. Expected default HashAlgo %s, got: %s", crypto.SHA256, sc.HashAlgo)
+	}
+	if sc.FailurePolicy != FailClosed {
+		t.Errorf("NewConfig failed. Expected default FailurePolicy %s, got: %s", FailClosed, sc.FailurePolicy)
+	}
+	if sc.Logger == nil {
+		t.Errorf("NewConfig failed. Expected default logger")
+	}
+}
+
+func TestNewConfig_WithFailureOptions(t *testing.T) {
+	ca := newTestCA(t)
+	k, _ := testECDSAKey(t)
+	c := testPEM(ca.issue(t, "toni.sender@example.com", k.Public()))
+	l := log.New(io.Discard, "smime", log.LevelWarn)
+	sc, err := NewConfig(c, WithSignerFailurePolicy(FailOpen), WithSignerLogger(l),
+		WithSignerErrorHandler(func(*mail.Msg, error) {}))
+	if err != nil {
+		t.Fatalf("NewConfig failed: %s", err)
+	}
+	if sc.FailurePolicy != FailOpen || sc.Logger != l || sc.ErrorHandler == nil {
+		t.Errorf("NewConfig failed. Options were not applied")
+	}
+	if _, err = NewConfig(c, WithSignerFailurePolicy(999)); !errors.Is(err, ErrInvalidFailurePolicy) {
+		t.Errorf("WithSignerFailurePolicy with invalid value was supposed to fail, got: %s", err)
+	}
+}
+
+func TestNewConfig_fails(t *testing.T) {
+	if _, err := NewConfig(nil); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("NewConfig without certificate was supposed to fail with ErrNoCertificate, got: %s", err)
+	}
+	_, kp := testRSAKey(t)
+	if _, err := NewConfig(kp); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("NewConfig with private key was supposed to fail with ErrNoCertificate, got: %s", err)
+	}
+	ip := []byte("-----BEGIN CERTIFICATE-----\naW52YWxpZA==\n-----END CERTIFICATE-----\n")
+	if _, err := NewConfig(ip); err == nil {
+		t.Errorf("NewConfig with invalid certificate was supposed to fail, but didn't")
+	}
+}
+
+func TestNewConfig_WithChain(t *testing.T) {
+	ca := newTestCA(t)
+	k, _ := testECDSAKey(t)
+	sc, err := NewConfig(testPEM(ca.issue(t, "toni.sender@example.com", k.Public())),
+		WithChain(testPEM(ca.inter, ca.root)), nil)
+	if err != nil {
+		t.Fatalf("NewConfig_WithChain failed: %s", err)
+	}
+	if len(sc.Chain) != 2 {
+		t.Errorf("NewConfig_WithChain failed. Expected 2 chain certificates, got: %d", len(sc.Chain))
+	}
+	if _, err = NewConfig(testPEM(ca.inter), WithChain(nil)); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("NewConfig_WithChain without certificate was supposed to fail with ErrNoCertificate, got: %s", err)
+	}
+}
+
+func TestNewConfig_WithHashAlgo(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		n  string
+		ha crypto.Hash
+		sf bool
+	}{
+		{"SHA-256", crypto.SHA256, false},
+		{"SHA-384", crypto.SHA384, false},
+		{"SHA-512", crypto.SHA512, false},
+		{"SHA-1", crypto.SHA1, true},
+		{"MD5", crypto.MD5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			sc, err := NewConfig(testPEM(ca.inter), WithHashAlgo(tt.ha))
+			if err != nil && !tt.sf {
+				t.Errorf("NewConfig_WithHashAlgo failed: %s", err)
+			}
+			if err == nil && tt.sf {
+				t.Errorf("NewConfig_WithHashAlgo was supposed to fail, but didn't")
+			}
+			if tt.sf && !errors.Is(err, ErrInvalidHashAlgo) {
+				t.Errorf("NewConfig_WithHashAlgo was supposed to fail with ErrInvalidHashAlgo, got: %s", err)
+			}
+			if !tt.sf && sc.HashAlgo != tt.ha {
+				t.Errorf("NewConfig_WithHashAlgo failed. Expected: %s, got: %s", tt.ha, sc.HashAlgo)
+			}
+		})
+	}
+}
+
+func TestNewEncrypterConfig(t *testing.T) {
+	ec, err := NewEncrypterConfig(MapCertStore{})
+	if err != nil {
+		t.Fatalf("NewEncrypterConfig failed: %s", err)
+	}
+	if ec.ContentEncryption != AES256CBC {
+		t.Errorf("NewEncrypterConfig failed. Expected default ContentEncryption %s, got: %s", AES256CBC,
+			ec.ContentEncryption)
+	}
+	if ec.FailurePolicy != FailClosed {
+		t.Errorf("NewEncrypterConfig failed. Expected default FailurePolicy %s, got: %s", FailClosed,
+			ec.FailurePolicy)
+	}
+	if ec.Logger == nil {
+		t.Errorf("NewEncrypterConfig failed. Expected default logger")
+	}
+	if _, err = NewEncrypterConfig(nil); !errors.Is(err, ErrNoCertStore) {
+		t.Errorf("NewEncrypterConfig without CertStore was supposed to fail with ErrNoCertStore, got: %s", err)
+	}
+}
+
+func TestNewEncrypterConfig_WithOptions(t *testing.T) {
+	ec, err := NewEncrypterConfig(MapCertStore{}, WithContentEncryption(AES128GCM), WithFailurePolicy(FailOpen),
+		WithErrorHandler(func(*mail.Msg, error) {}), nil)
+	if err != nil {
+		t.Fatalf("NewEncrypterConfig failed: %s", err)
+	}
+	if ec.ContentEncryption != AES128GCM || ec.FailurePolicy != FailOpen || ec.ErrorHandler == nil {
+		t.Errorf("NewEncrypterConfig failed. Options were not applied")
+	}
+	if _, err = NewEncrypterConfig(MapCertStore{}, WithContentEncryption(999)); !errors.Is(err,
+		ErrInvalidContentEncryption) {
+		t.Errorf("WithContentEncryption with invalid value was supposed to fail, got: %s", err)
+	}
+	if _, err = NewEncrypterConfig(MapCertStore{}, WithFailurePolicy(999)); !errors.Is(err,
+		ErrInvalidFailurePolicy) {
+		t.Errorf("WithFailurePolicy with invalid value was supposed to fail, got: %s", err)
+	}
+}
+
+func TestContentEncryption_String(t *testing.T) {
+	tests := []struct {
+		ce ContentEncryption
+		s  string
+	}{
+		{AES256CBC, "AES-256-CBC"},
+		{AES128CBC, "AES-128-CBC"},
+		{AES256GCM, "AES-256-GCM"},
+		{AES128GCM, "AES-128-GCM"},
+		{999, "unknown"},
+	}
+	for _, tt := range tests {
+		if tt.ce.String() != tt.s {
+			t.Errorf("String() failed. Expected: %q, got: %q", tt.s, tt.ce.String())
+		}
+	}
+}
+
+func TestFailurePolicy_String(t *testing.T) {
+	tests := []struct {
+		p FailurePolicy
+		s string
+	}{
+		{FailClosed, "fail-closed"},
+		{FailOpen, "fail-open"},
+		{999, "unknown"},
+	}
+	for _, tt := range tests {
+		if tt.p.String() != tt.s {
+			t.Errorf("String() failed. Expected: %q, got: %q", tt.s, tt.p.String())
+		}
+	}
+}
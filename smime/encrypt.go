@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// EncryptMiddleware is the middleware struct for the S/MIME encryption middleware
+type EncryptMiddleware struct {
+	config *EncrypterConfig
+}
+
+const (
+	// HeaderError is the header field that holds the processing error of a mail that
+	// was made undeliverable by the EncryptMiddleware
+	HeaderError mail.Header = "X-SMIME-Error"
+	// TypePKCS7MIME is the content type of an encrypted S/MIME body
+	TypePKCS7MIME = "application/pkcs7-mime"
+	// encFileName is the file name used for the encrypted body
+	encFileName = "smime.p7m"
+)
+
+var (
+	// ErrInvalidContentEncryption should be returned if a not supported content
+	// encryption algorithm is set
+	ErrInvalidContentEncryption = errors.New("unsupported content encryption algorithm")
+	// ErrInvalidFailurePolicy should be returned if a not supported failure policy is set
+	ErrInvalidFailurePolicy = errors.New("unsupported failure policy")
+	// ErrNoCertStore should be returned if a CertStore is needed but not provided
+	ErrNoCertStore = errors.New("no certificate store provided")
+	// ErrNoRecipients should be returned if a mail has no recipients to encrypt for
+	ErrNoRecipients = errors.New("no recipients to encrypt the mail for")
+	// ErrNotProcessed is returned when writing a mail that the EncryptMiddleware failed
+	// to encrypt with the FailClosed FailurePolicy
+	ErrNotProcessed = errors.New("smime: mail message could not be encrypted")
+)
+
+// recipientHeaders are the address headers that hold the recipients of a mail
+var recipientHeaders = []mail.AddrHeader{mail.HeaderTo, mail.HeaderCc, mail.HeaderBcc}
+
+// NewEncryptMiddleware returns a new EncryptMiddleware from a given EncrypterConfig.
+// The returned EncryptMiddleware can be used with the mail.WithMiddleware method
+func NewEncryptMiddleware(ec *EncrypterConfig) *EncryptMiddleware {
+	return &EncryptMiddleware{config: ec}
+}
+
+// Handle is the handler method that satisfies the mail.Middleware interface. The complete
+// MIME entity of the mail is encrypted for all To, Cc and Bcc recipients
+func (e *EncryptMiddleware) Handle(m *mail.Msg) *mail.Msg {
+	certs, err := e.recipientCerts(m)
+	if err != nil {
+		return e.fail(m, fmt.Errorf("failed to look up recipient certificates: %w", err))
+	}
+	me, err := mimeEntity(m)
+	if err != nil {
+		return e.fail(m, fmt.Errorf("failed to render MIME entity: %w", err))
+	}
+	d, err := encryptEnveloped(me, certs, e.config.ContentEncryption)
+	if err != nil {
+		return e.fail(m, fmt.Errorf("failed to encrypt MIME entity: %w", err))
+	}
+
+	st := "enveloped-data"
+	if e.config.ContentEncryption.authenticated() {
+		st = "authEnveloped-data"
+	}
+	m.UnsetAllParts()
+	m.SetBodyWriter(mail.ContentType(fmt.Sprintf(`%s; smime-type=%s; name=%q`, TypePKCS7MIME, st, encFileName)),
+		func(w io.Writer) (int64, error) {
+			n, err := w.Write(d)
+			return int64(n), err
+		}, mail.WithPartEncoding(mail.EncodingB64))
+	return m
+}
+
+// Type returns the MiddlewareType for this Middleware
+func (e *EncryptMiddleware) Type() mail.MiddlewareType {
+	return Type
+}
+
+// recipientCerts returns the certificates of all To, Cc and Bcc recipients of the given
+// mail.Msg from the CertStore of the EncrypterConfig
+func (e *EncryptMiddleware) recipientCerts(m *mail.Msg) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	seen := make(map[*x509.Certificate]bool)
+	for _, h := range recipientHeaders {
+		for _, a := range m.GetAddrHeader(h) {
+			c, err := e.config.CertStore.Certificate(a.Address)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[c] {
+				certs = append(certs, c)
+				seen[c] = true
+			}
+		}
+	}
+	if len(certs) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return certs, nil
+}
+
+// fail handles a processing error of the given mail.Msg according to the FailurePolicy
+// of the EncrypterConfig
+func (e *EncryptMiddleware) fail(m *mail.Msg, err error) *mail.Msg {
+	if e.config.ErrorHandler != nil {
+		e.config.ErrorHandler(m, err)
+	}
+	if e.config.FailurePolicy == FailOpen {
+		e.config.Logger.Errorf("%s. sending mail unencrypted", err)
+		return m
+	}
+	return block(m, e.config.Logger, ErrNotProcessed, err)
+}
+
+// block makes the given mail.Msg undeliverable after a processing error, so that it is
+// never sent unprocessed. The recipients are removed, the error is noted in the HeaderError
+// header and the message body is replaced with a body that fails to be written with the
+// given reason, which aborts the SMTP transaction of the mail.Client
+func block(m *mail.Msg, l *log.Logger, reason, err error) *mail.Msg {
+	if l != nil {
+		l.Errorf("%s. mail will not be sent", err)
+	}
+	for _, h := range recipientHeaders {
+		m.SetAddrHeaderFromMailAddress(h)
+	}
+	m.SetGenHeader(HeaderError, err.Error())
+	m.UnsetAllParts()
+	m.SetBodyWriter(mail.TypeTextPlain, func(io.Writer) (int64, error) {
+		return 0, fmt.Errorf("%w: %w", reason, err)
+	}, mail.WithPartEncoding(mail.NoEncoding))
+	return m
+}
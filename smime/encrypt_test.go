@@ -0,0 +1,338 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	netmail "net/mail"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// testRecipient represents a mail recipient with a RSA key and a S/MIME certificate
+type testRecipient struct {
+	addr string
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// newTestRecipient creates a new testRecipient for the given mail address with a
+// certificate issued by the given testCA
+func newTestRecipient(t *testing.T, ca *testCA, a string) *testRecipient {
+	t.Helper()
+	k, _ := testRSAKey(t)
+	return &testRecipient{addr: a, cert: ca.issue(t, a, k.Public()), key: k}
+}
+
+// testEncryptedMail creates a new mail.Msg for the given recipients with the given
+// EncryptMiddleware and returns the raw mail message and the error of the WriteTo call
+func testEncryptedMail(mw *EncryptMiddleware, to ...string) ([]byte, error) {
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err := m.From("toni.sender@example.com"); err != nil {
+		return nil, err
+	}
+	if err := m.To(to...); err != nil {
+		return nil, err
+	}
+	m.Subject("This is a subject")
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	m.AddAlternativeString(mail.TypeTextHTML, "<p>This is the HTML body</p>")
+	if err := m.AttachReader("attachment.txt", strings.NewReader("This is the attachment")); err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	_, err := m.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// testDecrypt decrypts the S/MIME encrypted body of the given raw mail message with the
+// Go standard library, using the certificate and key of the given testRecipient
+func testDecrypt(raw []byte, r *testRecipient) ([]byte, error) {
+	pm, err := netmail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mail message: %w", err)
+	}
+	mt, mp, err := mime.ParseMediaType(pm.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse content type: %w", err)
+	}
+	if mt != TypePKCS7MIME {
+		return nil, fmt.Errorf("unexpected content type: %s", mt)
+	}
+	if !strings.EqualFold(pm.Header.Get("Content-Transfer-Encoding"), "base64") {
+		return nil, fmt.Errorf("unexpected transfer encoding: %s", pm.Header.Get("Content-Transfer-Encoding"))
+	}
+	b64, err := io.ReadAll(pm.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mail body: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(b64)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mail body: %w", err)
+	}
+
+	var ci contentInfo
+	if _, err = asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("failed to parse content info: %w", err)
+	}
+	var ri []asn1.RawValue
+	var eci encryptedContentInfo
+	var mac []byte
+	switch {
+	case ci.ContentType.Equal(oidEnvelopedData) && mp["smime-type"] == "enveloped-data":
+		var ed envelopedData
+		if _, err = asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+			return nil, fmt.Errorf("failed to parse enveloped data: %w", err)
+		}
+		ri, eci = ed.RecipientInfos, ed.EncryptedContentInfo
+	case ci.ContentType.Equal(oidAuthEnveloped) && mp["smime-type"] == "authEnveloped-data":
+		var aed authEnvelopedData
+		if _, err = asn1.Unmarshal(ci.Content.Bytes, &aed); err != nil {
+			return nil, fmt.Errorf("failed to parse auth enveloped data: %w", err)
+		}
+		ri, eci, mac = aed.RecipientInfos, aed.AuthEncryptedContentInfo, aed.MAC
+	default:
+		return nil, fmt.Errorf("unexpected content type %s for smime-type %s", ci.ContentType, mp["smime-type"])
+	}
+
+	var key []byte
+	for _, r2 := range ri {
+		var ktri keyTransRecipientInfo
+		if _, err = asn1.Unmarshal(r2.FullBytes, &ktri); err != nil {
+			return nil, fmt.Errorf("failed to parse recipient info: %w", err)
+		}
+		if !bytes.Equal(ktri.RID.Issuer.FullBytes, r.cert.RawIssuer) || ktri.RID.SerialNumber.Cmp(r.cert.SerialNumber) != 0 {
+			continue
+		}
+		if key, err = rsa.DecryptPKCS1v15(rand.Reader, r.key, ktri.EncryptedKey); err != nil {
+			return nil, fmt.Errorf("failed to decrypt content encryption key: %w", err)
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no recipient info found for %s", r.addr)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	ct := eci.EncryptedContent.Bytes
+	if mac != nil {
+		var gp gcmParameters
+		if _, err = asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &gp); err != nil {
+			return nil, fmt.Errorf("failed to parse GCM parameters: %w", err)
+		}
+		aead, err := cipher.NewGCMWithTagSize(block, gp.ICVLen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCM cipher: %w", err)
+		}
+		return aead.Open(nil, gp.Nonce, append(bytes.Clone(ct), mac...), nil)
+	}
+	var iv []byte
+	if _, err = asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("failed to parse IV: %w", err)
+	}
+	if len(ct) == 0 || len(ct)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("invalid encrypted content length: %d", len(ct))
+	}
+	pt := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(pt, ct)
+	pl := int(pt[len(pt)-1])
+	if pl == 0 || pl > block.BlockSize() {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return pt[:len(pt)-pl], nil
+}
+
+// testEncrypterConfig returns a new EncrypterConfig for the given recipients
+func testEncrypterConfig(t *testing.T, rl []*testRecipient, o ...EncrypterOption) *EncrypterConfig {
+	t.Helper()
+	var certs [][]byte
+	for _, r := range rl {
+		certs = append(certs, testPEM(r.cert))
+	}
+	cs, err := NewMapCertStore(certs...)
+	if err != nil {
+		t.Fatalf("failed to create certificate store: %s", err)
+	}
+	o = append(o, WithLogger(log.New(os.Stderr, "smime", log.LevelError)))
+	ec, err := NewEncrypterConfig(cs, o...)
+	if err != nil {
+		t.Fatalf("failed to create new encrypter config: %s", err)
+	}
+	return ec
+}
+
+func TestEncryptMiddleware_Handle(t *testing.T) {
+	ca := newTestCA(t)
+	toni := newTestRecipient(t, ca, "toni.recipient@example.com")
+	tina := newTestRecipient(t, ca, "tina.recipient@example.com")
+	tests := []struct {
+		n  string
+		ce ContentEncryption
+		st string
+	}{
+		{"AES-256-CBC", AES256CBC, "enveloped-data"},
+		{"AES-128-CBC", AES128CBC, "enveloped-data"},
+		{"AES-256-GCM", AES256GCM, "authEnveloped-data"},
+		{"AES-128-GCM", AES128GCM, "authEnveloped-data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			ec := testEncrypterConfig(t, []*testRecipient{toni, tina}, WithContentEncryption(tt.ce))
+			raw, err := testEncryptedMail(NewEncryptMiddleware(ec), toni.addr, tina.addr)
+			if err != nil {
+				t.Fatalf("failed writing message to memory: %s", err)
+			}
+			if bytes.Contains(raw, []byte("This is the mail body")) {
+				t.Errorf("Handle failed. Mail body found in cleartext")
+			}
+			if !bytes.Contains(raw, []byte("smime-type="+tt.st)) {
+				t.Errorf("Handle failed. Expected smime-type %s", tt.st)
+			}
+			if !bytes.Contains(raw, []byte("Subject: This is a subject")) {
+				t.Errorf("Handle failed. Outer header not found")
+			}
+			for _, r := range []*testRecipient{toni, tina} {
+				pt, err := testDecrypt(raw, r)
+				if err != nil {
+					t.Fatalf("failed to decrypt mail for %s: %s", r.addr, err)
+				}
+				for _, s := range []string{"Content-Type: multipart/mixed", "This is the mail body",
+					"<p>This is the HTML body</p>", `filename="attachment.txt"`} {
+					if !bytes.Contains(pt, []byte(s)) {
+						t.Errorf("Handle failed. Expected %q in decrypted MIME entity", s)
+					}
+				}
+				if bytes.Contains(pt, []byte("Subject:")) {
+					t.Errorf("Handle failed. Outer headers should not be part of the MIME entity")
+				}
+			}
+			other := newTestRecipient(t, ca, "other@example.com")
+			if _, err = testDecrypt(raw, other); err == nil {
+				t.Errorf("Handle failed. Mail was not supposed to be decryptable by other recipients")
+			}
+		})
+	}
+}
+
+func TestEncryptMiddleware_Handle_withSigner(t *testing.T) {
+	ca := newTestCA(t)
+	tina := newTestRecipient(t, ca, "tina.recipient@example.com")
+	k, kp := testRSAKey(t)
+	sc, err := NewConfig(testPEM(ca.issue(t, "toni.sender@example.com", k.Public()), ca.inter))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	smw, err := NewFromRSAKey(kp, sc)
+	if err != nil {
+		t.Fatalf("failed to create new middleware: %s", err)
+	}
+	ec := testEncrypterConfig(t, []*testRecipient{tina})
+	m := mail.NewMsg(mail.WithMiddleware(smw), mail.WithMiddleware(NewEncryptMiddleware(ec)))
+	if err = m.To(tina.addr); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	pt, err := testDecrypt(buf.Bytes(), tina)
+	if err != nil {
+		t.Fatalf("failed to decrypt mail: %s", err)
+	}
+	pm, err := netmail.ReadMessage(bytes.NewReader(pt))
+	if err != nil {
+		t.Fatalf("failed to parse decrypted MIME entity: %s", err)
+	}
+	if _, _, err = testVerify(pm, ca.root); err != nil {
+		t.Errorf("Handle failed. Signature of the decrypted MIME entity is invalid: %s", err)
+	}
+}
+
+func TestEncryptMiddleware_Handle_missingCert(t *testing.T) {
+	ca := newTestCA(t)
+	tina := newTestRecipient(t, ca, "tina.recipient@example.com")
+
+	t.Run("fail-closed", func(t *testing.T) {
+		var herr error
+		ec := testEncrypterConfig(t, []*testRecipient{tina}, WithErrorHandler(func(_ *mail.Msg, err error) {
+			herr = err
+		}))
+		mw := NewEncryptMiddleware(ec)
+		raw, err := testEncryptedMail(mw, tina.addr, "unknown@example.com")
+		if !errors.Is(err, ErrNotProcessed) || !errors.Is(err, ErrCertNotFound) {
+			t.Errorf("Handle with missing certificate was supposed to fail with ErrNotProcessed, got: %s", err)
+		}
+		if !errors.Is(herr, ErrCertNotFound) {
+			t.Errorf("Handle with missing certificate failed. Expected ErrorHandler call, got: %s", herr)
+		}
+		if bytes.Contains(raw, []byte("This is the mail body")) {
+			t.Errorf("Handle with missing certificate failed. Mail body was written unencrypted")
+		}
+
+		m := mail.NewMsg()
+		if err = m.To(tina.addr, "unknown@example.com"); err != nil {
+			t.Fatalf("failed to set To address: %s", err)
+		}
+		m = mw.Handle(m)
+		if _, err = m.GetRecipients(); err == nil {
+			t.Errorf("Handle with missing certificate failed. Recipients were not removed")
+		}
+		if len(m.GetGenHeader(HeaderError)) != 1 {
+			t.Errorf("Handle with missing certificate failed. Expected %s header", HeaderError)
+		}
+	})
+	t.Run("fail-open", func(t *testing.T) {
+		ec := testEncrypterConfig(t, []*testRecipient{tina}, WithFailurePolicy(FailOpen))
+		raw, err := testEncryptedMail(NewEncryptMiddleware(ec), tina.addr, "unknown@example.com")
+		if err != nil {
+			t.Fatalf("Handle with FailOpen was not supposed to fail: %s", err)
+		}
+		if !bytes.Contains(raw, []byte("This is the mail body")) {
+			t.Errorf("Handle with FailOpen failed. Expected unencrypted mail body")
+		}
+	})
+}
+
+func TestEncryptMiddleware_Handle_unsupportedKey(t *testing.T) {
+	ca := newTestCA(t)
+	k, _ := testECDSAKey(t)
+	c := ca.issue(t, "tina.recipient@example.com", k.Public())
+	cs, err := NewMapCertStore(testPEM(c))
+	if err != nil {
+		t.Fatalf("failed to create certificate store: %s", err)
+	}
+	ec, err := NewEncrypterConfig(cs, WithLogger(log.New(os.Stderr, "smime", log.LevelError)))
+	if err != nil {
+		t.Fatalf("failed to create new encrypter config: %s", err)
+	}
+	if _, err = testEncryptedMail(NewEncryptMiddleware(ec), "tina.recipient@example.com"); !errors.Is(err,
+		ErrUnsupportedKey) {
+		t.Errorf("Handle with ECDSA certificate was supposed to fail with ErrUnsupportedKey, got: %s", err)
+	}
+}
+
+func TestEncryptMiddleware_Type(t *testing.T) {
+	mw := NewEncryptMiddleware(nil)
+	if mw.Type() != Type {
+		t.Errorf("Type() failed. Expected: %s, got: %s", Type, mw.Type())
+	}
+}
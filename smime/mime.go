@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wneessen/go-mail"
+)
+
+// mimeEntity renders the given mail.Msg, skipping this Middleware, and returns the
+// MIME entity of the message. The MIME entity consists of the Content-* header fields
+// and the complete message body
+func mimeEntity(msg *mail.Msg) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if _, err := msg.WriteToSkipMiddleware(&buf, Type); err != nil {
+		return nil, fmt.Errorf("failed to write mail message to memory: %w", err)
+	}
+	hf, body, err := splitMessage(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	e := bytes.Buffer{}
+	for _, f := range hf {
+		if strings.HasPrefix(strings.ToLower(headerName(f)), "content-") {
+			e.WriteString(f)
+		}
+	}
+	e.WriteString(mail.SingleNewLine)
+	e.Write(body)
+	return e.Bytes(), nil
+}
+
+// splitMessage splits a rendered mail message into its raw header fields
+// and the message body
+func splitMessage(d []byte) ([]string, []byte, error) {
+	var hf []string
+	br := bufio.NewReader(bytes.NewReader(d))
+	n := 0
+	for {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			return nil, nil, ErrNoHeaderEnd
+		}
+		n += len(l)
+		if l == mail.SingleNewLine || l == "\n" {
+			break
+		}
+		if len(hf) > 0 && (l[0] == ' ' || l[0] == '\t') {
+			hf[len(hf)-1] += l
+			continue
+		}
+		hf = append(hf, l)
+	}
+	return hf, d[n:], nil
+}
+
+// headerName returns the name of a raw header field
+func headerName(f string) string {
+	n, _, _ := strings.Cut(f, ":")
+	return strings.TrimSpace(n)
+}
+
+// setMIMEBody replaces the body parts, embeds and attachments of the given mail.Msg
+// with a single, preformatted MIME body of the given content type
+func setMIMEBody(msg *mail.Msg, ct string, body []byte) {
+	msg.UnsetAllParts()
+	msg.SetBodyWriter(mail.ContentType(ct), func(w io.Writer) (int64, error) {
+		n, err := w.Write(body)
+		return int64(n), err
+	}, mail.WithPartEncoding(mail.NoEncoding))
+}
@@ -0,0 +1,431 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// Object identifiers used in the CMS structures
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5652 and
+// https://datatracker.ietf.org/doc/html/rfc5754
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAuthEnveloped   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 23}
+	oidAttrContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMsgDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningTime = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidAES128CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES128GCM       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 6}
+	oidAES256CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAES256GCM       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	asn1NullParameters = asn1.RawValue{Tag: asn1.TagNull}
+)
+
+// contentInfo represents the CMS ContentInfo type
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData represents the CMS SignedData type
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// encapContentInfo represents the CMS EncapsulatedContentInfo type. The content is
+// omitted for detached signatures
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// issuerAndSerial represents the CMS IssuerAndSerialNumber type
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// signerInfo represents the CMS SignerInfo type
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+// attribute represents the CMS Attribute type
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// envelopedData represents the CMS EnvelopedData type
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+// authEnvelopedData represents the CMS AuthEnvelopedData type
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5083
+type authEnvelopedData struct {
+	Version                  int
+	RecipientInfos           []asn1.RawValue `asn1:"set"`
+	AuthEncryptedContentInfo encryptedContentInfo
+	MAC                      []byte
+}
+
+// keyTransRecipientInfo represents the CMS KeyTransRecipientInfo type
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    issuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// encryptedContentInfo represents the CMS EncryptedContentInfo type
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// gcmParameters represents the AES-GCM algorithm parameters
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5084#section-3.2
+type gcmParameters struct {
+	Nonce  []byte
+	ICVLen int
+}
+
+// signDetached creates a DER encoded, detached CMS SignedData structure of the given
+// content, signed with the given crypto.Signer and certificate. The certificate and the
+// certificate chain are included in the SignedData
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5652#section-5
+func signDetached(d []byte, cs crypto.Signer, c *x509.Certificate, ch []*x509.Certificate,
+	ha crypto.Hash, st time.Time,
+) ([]byte, error) {
+	da, err := digestAlgorithm(ha)
+	if err != nil {
+		return nil, err
+	}
+	sa, err := signatureAlgorithm(cs.Public(), ha)
+	if err != nil {
+		return nil, err
+	}
+
+	h := ha.New()
+	h.Write(d)
+	sattrs, err := signedAttributes(h.Sum(nil), st)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is calculated over the DER encoding of the signed attributes as
+	// SET OF, while the SignerInfo holds them IMPLICIT tagged
+	sd, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: sattrs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signed attributes: %w", err)
+	}
+	h = ha.New()
+	h.Write(sd)
+	sig, err := cs.Sign(rand.Reader, h.Sum(nil), ha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign content: %w", err)
+	}
+
+	var certs []byte
+	for _, cert := range append([]*x509.Certificate{c}, ch...) {
+		certs = append(certs, cert.Raw...)
+	}
+	si := signerInfo{
+		Version: 1,
+		SID: issuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: c.RawIssuer},
+			SerialNumber: c.SerialNumber,
+		},
+		DigestAlgorithm:    da,
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sattrs},
+		SignatureAlgorithm: sa,
+		Signature:          sig,
+	}
+	sdata := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{da},
+		EncapContentInfo: encapContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []signerInfo{si},
+	}
+	return marshalContentInfo(oidSignedData, sdata)
+}
+
+// marshalContentInfo returns the DER encoded ContentInfo of the given content type and
+// content
+func marshalContentInfo(ct asn1.ObjectIdentifier, c any) ([]byte, error) {
+	cd, err := asn1.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode content: %w", err)
+	}
+	ci := contentInfo{
+		ContentType: ct,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cd},
+	}
+	d, err := asn1.Marshal(ci)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode content info: %w", err)
+	}
+	return d, nil
+}
+
+// signedAttributes returns the DER encoded and sorted content type, signing time and
+// message digest attributes
+func signedAttributes(md []byte, st time.Time) ([]byte, error) {
+	ct, err := asn1.Marshal(oidData)
+	if err != nil {
+		return nil, err
+	}
+	t, err := asn1.Marshal(st.UTC())
+	if err != nil {
+		return nil, err
+	}
+	dg, err := asn1.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	attrs := []attribute{
+		{Type: oidAttrContentType, Values: []asn1.RawValue{{FullBytes: ct}}},
+		{Type: oidAttrSigningTime, Values: []asn1.RawValue{{FullBytes: t}}},
+		{Type: oidAttrMsgDigest, Values: []asn1.RawValue{{FullBytes: dg}}},
+	}
+
+	// DER requires the elements of a SET OF to be sorted by their encoding
+	el := make([][]byte, 0, len(attrs))
+	for _, a := range attrs {
+		d, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attribute: %w", err)
+		}
+		el = append(el, d)
+	}
+	slices.SortFunc(el, bytes.Compare)
+	return bytes.Join(el, nil), nil
+}
+
+// encryptEnveloped encrypts the given content with a random content encryption key using
+// the given ContentEncryption and returns the DER encoded CMS EnvelopedData structure (or
+// AuthEnvelopedData structure for authenticated encryption modes). The content encryption
+// key is encrypted with the public key of each of the given certificates
+//
+// See: https://datatracker.ietf.org/doc/html/rfc5652#section-6
+func encryptEnveloped(d []byte, certs []*x509.Certificate, ce ContentEncryption) ([]byte, error) {
+	if ce.keySize() == 0 {
+		return nil, fmt.Errorf("%s: %w", ce, ErrInvalidContentEncryption)
+	}
+	key := make([]byte, ce.keySize())
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate content encryption key: %w", err)
+	}
+	ri, err := recipientInfos(key, certs)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	if ce.authenticated() {
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCM cipher: %w", err)
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err = rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		params, err := asn1.Marshal(gcmParameters{Nonce: nonce, ICVLen: aead.Overhead()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode GCM parameters: %w", err)
+		}
+		ct := aead.Seal(nil, nonce, d, nil)
+		tl := len(ct) - aead.Overhead()
+		aed := authEnvelopedData{
+			RecipientInfos:           ri,
+			AuthEncryptedContentInfo: newEncryptedContentInfo(ce, params, ct[:tl]),
+			MAC:                      ct[tl:],
+		}
+		return marshalContentInfo(oidAuthEnveloped, aed)
+	}
+
+	iv := make([]byte, block.BlockSize())
+	if _, err = rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+	params, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode IV: %w", err)
+	}
+	pl := block.BlockSize() - len(d)%block.BlockSize()
+	ct := append(bytes.Clone(d), bytes.Repeat([]byte{byte(pl)}, pl)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, ct)
+	ed := envelopedData{
+		RecipientInfos:       ri,
+		EncryptedContentInfo: newEncryptedContentInfo(ce, params, ct),
+	}
+	return marshalContentInfo(oidEnvelopedData, ed)
+}
+
+// newEncryptedContentInfo returns the EncryptedContentInfo for the given ContentEncryption,
+// DER encoded algorithm parameters and encrypted content
+func newEncryptedContentInfo(ce ContentEncryption, params, ct []byte) encryptedContentInfo {
+	return encryptedContentInfo{
+		ContentType: oidData,
+		ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  ce.oid(),
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: ct},
+	}
+}
+
+// recipientInfos returns the DER encoded and sorted KeyTransRecipientInfo structures that
+// hold the given content encryption key, encrypted with the public key of each of the given
+// certificates
+func recipientInfos(key []byte, certs []*x509.Certificate) ([]asn1.RawValue, error) {
+	el := make([][]byte, 0, len(certs))
+	for _, c := range certs {
+		pk, ok := c.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: %T: %w", c.Subject, c.PublicKey, ErrUnsupportedKey)
+		}
+		ek, err := rsa.EncryptPKCS1v15(rand.Reader, pk, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt content encryption key for %s: %w", c.Subject, err)
+		}
+		d, err := asn1.Marshal(keyTransRecipientInfo{
+			RID: issuerAndSerial{
+				Issuer:       asn1.RawValue{FullBytes: c.RawIssuer},
+				SerialNumber: c.SerialNumber,
+			},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidRSAEncryption,
+				Parameters: asn1NullParameters,
+			},
+			EncryptedKey: ek,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode recipient info: %w", err)
+		}
+		el = append(el, d)
+	}
+	if len(el) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	// DER requires the elements of a SET OF to be sorted by their encoding
+	slices.SortFunc(el, bytes.Compare)
+	ri := make([]asn1.RawValue, 0, len(el))
+	for _, d := range el {
+		ri = append(ri, asn1.RawValue{FullBytes: d})
+	}
+	return ri, nil
+}
+
+// oid returns the content encryption algorithm object identifier of the ContentEncryption
+func (ce ContentEncryption) oid() asn1.ObjectIdentifier {
+	switch ce {
+	case AES128CBC:
+		return oidAES128CBC
+	case AES128GCM:
+		return oidAES128GCM
+	case AES256GCM:
+		return oidAES256GCM
+	default:
+		return oidAES256CBC
+	}
+}
+
+// digestAlgorithm returns the CMS digest AlgorithmIdentifier for the given crypto.Hash
+func digestAlgorithm(ha crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+	switch ha {
+	case crypto.SHA256:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1NullParameters}, nil
+	case crypto.SHA384:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA384, Parameters: asn1NullParameters}, nil
+	case crypto.SHA512:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA512, Parameters: asn1NullParameters}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("%s: %w", ha, ErrInvalidHashAlgo)
+	}
+}
+
+// signatureAlgorithm returns the CMS signature AlgorithmIdentifier for the given public
+// key and crypto.Hash
+func signatureAlgorithm(pk crypto.PublicKey, ha crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+	switch pk.(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1NullParameters}, nil
+	case *ecdsa.PublicKey:
+		switch ha {
+		case crypto.SHA256:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+		case crypto.SHA384:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA384}, nil
+		case crypto.SHA512:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA512}, nil
+		}
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("%s: %w", ha, ErrInvalidHashAlgo)
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("%T: %w", pk, ErrUnsupportedKey)
+	}
+}
+
+// micAlg returns the multipart/signed micalg parameter value for the given crypto.Hash
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8551#section-3.5.3
+func micAlg(ha crypto.Hash) (string, error) {
+	switch ha {
+	case crypto.SHA256:
+		return "sha-256", nil
+	case crypto.SHA384:
+		return "sha-384", nil
+	case crypto.SHA512:
+		return "sha-512", nil
+	default:
+		return "", fmt.Errorf("%s: %w", ha, ErrInvalidHashAlgo)
+	}
+}
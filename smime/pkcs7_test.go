@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignDetached_fails(t *testing.T) {
+	ca := newTestCA(t)
+	_, ek, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %s", err)
+	}
+	if _, err = signDetached([]byte("data"), ek, ca.inter, nil, crypto.SHA256, time.Now()); !errors.Is(err,
+		ErrUnsupportedKey) {
+		t.Errorf("signDetached with Ed25519 key was supposed to fail with ErrUnsupportedKey, got: %s", err)
+	}
+	k, _ := testECDSAKey(t)
+	if _, err = signDetached([]byte("data"), k, ca.inter, nil, crypto.SHA1, time.Now()); !errors.Is(err,
+		ErrInvalidHashAlgo) {
+		t.Errorf("signDetached with SHA-1 was supposed to fail with ErrInvalidHashAlgo, got: %s", err)
+	}
+}
+
+func TestSignedAttributes(t *testing.T) {
+	d, err := signedAttributes([]byte("digest"), time.Now())
+	if err != nil {
+		t.Fatalf("signedAttributes failed: %s", err)
+	}
+	var prev []byte
+	rest := d
+	for len(rest) > 0 {
+		var a asn1.RawValue
+		if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+			t.Fatalf("failed to parse signed attribute: %s", err)
+		}
+		if prev != nil && string(prev) > string(a.FullBytes) {
+			t.Errorf("signedAttributes failed. Attributes are not DER sorted")
+		}
+		prev = a.FullBytes
+	}
+}
+
+func TestMicAlg(t *testing.T) {
+	tests := []struct {
+		ha crypto.Hash
+		ma string
+	}{
+		{crypto.SHA256, "sha-256"},
+		{crypto.SHA384, "sha-384"},
+		{crypto.SHA512, "sha-512"},
+	}
+	for _, tt := range tests {
+		ma, err := micAlg(tt.ha)
+		if err != nil {
+			t.Errorf("micAlg failed: %s", err)
+		}
+		if ma != tt.ma {
+			t.Errorf("micAlg failed. Expected: %q, got: %q", tt.ma, ma)
+		}
+	}
+	if _, err := micAlg(crypto.SHA1); !errors.Is(err, ErrInvalidHashAlgo) {
+		t.Errorf("micAlg with SHA-1 was supposed to fail with ErrInvalidHashAlgo, got: %s", err)
+	}
+}
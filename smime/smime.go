@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package smime implements a S/MIME middleware for go-mail
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8551
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"time"
+
+	"github.com/wneessen/go-mail"
+)
+
+// Middleware is the middleware struct for the S/MIME signing middleware
+type Middleware struct {
+	config *SignerConfig
+	signer crypto.Signer
+}
+
+const (
+	// Type is the type of Middleware
+	Type mail.MiddlewareType = "smime"
+	// Version is the version number of the Middleware
+	Version = "0.0.1"
+)
+
+const (
+	// TypePKCS7Signature is the content type of a detached S/MIME signature
+	TypePKCS7Signature = "application/pkcs7-signature"
+	// sigFileName is the file name used for the detached signature part
+	sigFileName = "smime.p7s"
+	// base64LineLength is the maximum line length of the base64 encoded signature
+	base64LineLength = 76
+)
+
+var (
+	// ErrDecodePEMFailed should be returned if a PEM block could not be decoded
+	ErrDecodePEMFailed = errors.New("failed to decode PEM block")
+	// ErrInvalidHashAlgo should be returned if a not supported hashing algorithm is set
+	ErrInvalidHashAlgo = errors.New("unsupported hashing algorithm")
+	// ErrKeyMismatch should be returned if the private key does not match the certificate
+	ErrKeyMismatch = errors.New("private key does not match the certificate")
+	// ErrNoCertificate should be returned if a certificate is needed but not provided
+	ErrNoCertificate = errors.New("no X.509 certificate provided")
+	// ErrNoHeaderEnd should be returned if the end of the mail header could not be found
+	ErrNoHeaderEnd = errors.New("unable to find end of mail header")
+	// ErrNotECDSAKey should be returned if the provided key is not an ECDSA key
+	ErrNotECDSAKey = errors.New("provided key is not of type ECDSA")
+	// ErrNotRSAKey should be returned if the provided key is not a RSA key
+	ErrNotRSAKey = errors.New("provided key is not of type RSA")
+	// ErrNotSigned is returned when writing a mail that the Middleware failed to sign with
+	// the FailClosed FailurePolicy
+	ErrNotSigned = errors.New("smime: mail message could not be signed")
+	// ErrUnsupportedKey should be returned if the type of a key is not supported
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// NewFromRSAKey returns a new Middlware from a given PEM encoded RSA private key
+// byte slice and a SignerConfig
+func NewFromRSAKey(k []byte, sc *SignerConfig) (*Middleware, error) {
+	dp, _ := pem.Decode(k)
+	if dp == nil {
+		return nil, ErrDecodePEMFailed
+	}
+	if pk, err := x509.ParsePKCS1PrivateKey(dp.Bytes); err == nil {
+		return newMiddleware(sc, pk)
+	}
+	apk, err := x509.ParsePKCS8PrivateKey(dp.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	pk, ok := apk.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrNotRSAKey
+	}
+	return newMiddleware(sc, pk)
+}
+
+// NewFromECDSAKey returns a new Middlware from a given PEM encoded ECDSA private key
+// byte slice and a SignerConfig
+func NewFromECDSAKey(k []byte, sc *SignerConfig) (*Middleware, error) {
+	dp, _ := pem.Decode(k)
+	if dp == nil {
+		return nil, ErrDecodePEMFailed
+	}
+	if pk, err := x509.ParseECPrivateKey(dp.Bytes); err == nil {
+		return newMiddleware(sc, pk)
+	}
+	apk, err := x509.ParsePKCS8PrivateKey(dp.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	pk, ok := apk.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrNotECDSAKey
+	}
+	return newMiddleware(sc, pk)
+}
+
+// Handle is the handler method that satisfies the mail.Middleware interface. If the mail
+// can't be signed, it is handled according to the FailurePolicy of the SignerConfig
+func (s Middleware) Handle(m *mail.Msg) *mail.Msg {
+	e, err := mimeEntity(m)
+	if err != nil {
+		return s.fail(m, fmt.Errorf("failed to render MIME entity: %w", err))
+	}
+	sig, err := signDetached(e, s.signer, s.config.Certificate, s.config.Chain, s.config.HashAlgo, time.Now())
+	if err != nil {
+		return s.fail(m, fmt.Errorf("failed to sign MIME entity: %w", err))
+	}
+	ma, err := micAlg(s.config.HashAlgo)
+	if err != nil {
+		return s.fail(m, err)
+	}
+
+	// The signed MIME entity has to be written as-is, therefore we can't make use of the
+	// multipart.Writer, which would re-format the MIME headers of the part
+	bd := multipart.NewWriter(io.Discard).Boundary()
+	buf := bytes.Buffer{}
+	buf.WriteString("--" + bd + mail.SingleNewLine)
+	buf.Write(e)
+	buf.WriteString(mail.SingleNewLine + "--" + bd + mail.SingleNewLine)
+	buf.WriteString(fmt.Sprintf(`Content-Type: %s; name=%q`, TypePKCS7Signature, sigFileName) +
+		mail.SingleNewLine)
+	buf.WriteString("Content-Transfer-Encoding: base64" + mail.SingleNewLine)
+	buf.WriteString(fmt.Sprintf(`Content-Disposition: attachment; filename=%q`, sigFileName) +
+		mail.SingleNewLine)
+	buf.WriteString("Content-Description: S/MIME Cryptographic Signature" + mail.SingleNewLine)
+	buf.WriteString(mail.SingleNewLine)
+	buf.WriteString(base64Lines(sig))
+	buf.WriteString("--" + bd + "--" + mail.SingleNewLine)
+
+	setMIMEBody(m, fmt.Sprintf(`multipart/signed; protocol="%s"; micalg=%s; boundary=%q`,
+		TypePKCS7Signature, ma, bd), buf.Bytes())
+	return m
+}
+
+// Type returns the MiddlewareType for this Middleware
+func (s Middleware) Type() mail.MiddlewareType {
+	return Type
+}
+
+// fail handles a signing error of the given mail.Msg according to the FailurePolicy of
+// the SignerConfig
+func (s Middleware) fail(m *mail.Msg, err error) *mail.Msg {
+	if s.config.ErrorHandler != nil {
+		s.config.ErrorHandler(m, err)
+	}
+	if s.config.FailurePolicy == FailOpen {
+		if s.config.Logger != nil {
+			s.config.Logger.Errorf("%s. sending mail unsigned", err)
+		}
+		return m
+	}
+	return block(m, s.config.Logger, ErrNotSigned, err)
+}
+
+// newMiddleware returns a new Middleware and can be used with the mail.WithMiddleware
+// method. It takes a SignerConfig and a crypto.Signer as arguments.
+//
+// This method is invoked by the different New*() methods
+func newMiddleware(sc *SignerConfig, cs crypto.Signer) (*Middleware, error) {
+	if sc == nil || sc.Certificate == nil {
+		return nil, ErrNoCertificate
+	}
+	pk, ok := cs.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pk.Equal(sc.Certificate.PublicKey) {
+		return nil, ErrKeyMismatch
+	}
+	if _, err := signatureAlgorithm(cs.Public(), sc.HashAlgo); err != nil {
+		return nil, err
+	}
+	return &Middleware{config: sc, signer: cs}, nil
+}
+
+// base64Lines returns the base64 encoding of the given data, split into CRLF terminated
+// lines of base64LineLength characters
+func base64Lines(d []byte) string {
+	e := base64.StdEncoding.EncodeToString(d)
+	buf := bytes.Buffer{}
+	for len(e) > base64LineLength {
+		buf.WriteString(e[:base64LineLength] + mail.SingleNewLine)
+		e = e[base64LineLength:]
+	}
+	buf.WriteString(e + mail.SingleNewLine)
+	return buf.String()
+}
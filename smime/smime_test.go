@@ -0,0 +1,548 @@
+// SPDX-FileCopyrightText: The go-mail Authors
+//
+// SPDX-License-Identifier: MIT
+
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wneessen/go-mail"
+	"github.com/wneessen/go-mail-middleware/log"
+)
+
+// errSignerFailed is the error returned by the failingSigner
+var errSignerFailed = errors.New("signer failed")
+
+// failingSigner is a crypto.Signer that always fails to sign
+type failingSigner struct {
+	crypto.Signer
+}
+
+// Sign satisfies the crypto.Signer interface for the failingSigner type
+func (failingSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, errSignerFailed
+}
+
+// testCA represents a local test certificate authority with an intermediate CA
+type testCA struct {
+	root     *x509.Certificate
+	inter    *x509.Certificate
+	interKey crypto.Signer
+}
+
+// newTestCA creates a new local test certificate authority
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	rk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %s", err)
+	}
+	rt := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-mail-middleware Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root := testCreateCert(t, rt, rt, rk.Public(), rk)
+	ik, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate intermediate CA key: %s", err)
+	}
+	it := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "go-mail-middleware Test Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	inter := testCreateCert(t, it, root, ik.Public(), rk)
+	return &testCA{root: root, inter: inter, interKey: ik}
+}
+
+// issue issues a new S/MIME certificate for the given mail address and public key
+func (ca *testCA) issue(t *testing.T, a string, pk crypto.PublicKey) *x509.Certificate {
+	t.Helper()
+	ku := x509.KeyUsageDigitalSignature
+	if _, ok := pk.(*rsa.PublicKey); ok {
+		ku |= x509.KeyUsageKeyEncipherment
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: a},
+		EmailAddresses: []string{a},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       ku,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	return testCreateCert(t, tpl, ca.inter, pk, ca.interKey)
+}
+
+// testCreateCert creates and parses a new certificate from the given template
+func testCreateCert(t *testing.T, tpl, p *x509.Certificate, pk crypto.PublicKey, k crypto.Signer) *x509.Certificate {
+	t.Helper()
+	d, err := x509.CreateCertificate(rand.Reader, tpl, p, pk, k)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	c, err := x509.ParseCertificate(d)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	return c
+}
+
+// testPEM returns the PEM encoding of the given certificates
+func testPEM(cl ...*x509.Certificate) []byte {
+	buf := bytes.Buffer{}
+	for _, c := range cl {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	return buf.Bytes()
+}
+
+// testRSAKey generates a new RSA key and returns it together with its PKCS#1 PEM encoding
+func testRSAKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %s", err)
+	}
+	return k, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})
+}
+
+// testECDSAKey generates a new ECDSA key and returns it together with its PKCS#8 PEM encoding
+func testECDSAKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %s", err)
+	}
+	d, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		t.Fatalf("failed to marshal ECDSA key: %s", err)
+	}
+	return k, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: d})
+}
+
+// testSignedMail creates a new mail.Msg with the given Middleware and returns the parsed
+// mail message
+func testSignedMail(t *testing.T, mw mail.Middleware) *netmail.Message {
+	t.Helper()
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	if err := m.From("toni.sender@example.com"); err != nil {
+		t.Fatalf("failed to set From address: %s", err)
+	}
+	if err := m.To("tina.recipient@example.com"); err != nil {
+		t.Fatalf("failed to set To address: %s", err)
+	}
+	m.Subject("This is a subject")
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	m.AddAlternativeString(mail.TypeTextHTML, "<p>This is the HTML body</p>")
+	if err := m.AttachReader("attachment.txt", strings.NewReader("This is the attachment")); err != nil {
+		t.Fatalf("failed to attach file: %s", err)
+	}
+	buf := bytes.Buffer{}
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	pm, err := netmail.ReadMessage(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse mail message: %s", err)
+	}
+	return pm
+}
+
+// testVerify verifies the S/MIME signature of the given mail message with the Go standard
+// library against the given root certificate. It returns the signer certificate and the
+// signed MIME entity
+func testVerify(pm *netmail.Message, root *x509.Certificate) (*x509.Certificate, []byte, error) {
+	mt, mp, err := mime.ParseMediaType(pm.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse content type: %w", err)
+	}
+	if mt != "multipart/signed" || mp["protocol"] != TypePKCS7Signature {
+		return nil, nil, fmt.Errorf("unexpected content type: %s", pm.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(pm.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read mail body: %w", err)
+	}
+	parts := strings.Split(string(body), "--"+mp["boundary"])
+	if len(parts) != 4 || !strings.HasPrefix(parts[3], "--") {
+		return nil, nil, fmt.Errorf("expected exactly two parts in multipart/signed body, got: %d", len(parts)-2)
+	}
+	entity := strings.TrimSuffix(strings.TrimPrefix(parts[1], "\r\n"), "\r\n")
+	sp, err := netmail.ReadMessage(strings.NewReader(parts[2][2:]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signature part: %w", err)
+	}
+	if sp.Header.Get("Content-Type") != TypePKCS7Signature+`; name="smime.p7s"` {
+		return nil, nil, fmt.Errorf("unexpected signature content type: %s", sp.Header.Get("Content-Type"))
+	}
+	b64, err := io.ReadAll(sp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(b64)), ""))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	var ci contentInfo
+	if _, err = asn1.Unmarshal(der, &ci); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse content info: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, fmt.Errorf("unexpected content type: %s", ci.ContentType)
+	}
+	var sd signedData
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signed data: %w", err)
+	}
+	if len(sd.EncapContentInfo.EContent.Bytes) != 0 {
+		return nil, nil, fmt.Errorf("signature is not detached")
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificates: %w", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, nil, fmt.Errorf("expected exactly one signer info, got: %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	var signer *x509.Certificate
+	inter := x509.NewCertPool()
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.SerialNumber) == 0 {
+			signer = c
+			continue
+		}
+		inter.AddCert(c)
+	}
+	if signer == nil {
+		return nil, nil, fmt.Errorf("signer certificate not found in signature")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	if _, err = signer.Verify(x509.VerifyOptions{
+		Roots: roots, Intermediates: inter,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}); err != nil {
+		return nil, nil, fmt.Errorf("failed to verify signer certificate: %w", err)
+	}
+
+	var ha crypto.Hash
+	for h, s := range map[crypto.Hash]string{crypto.SHA256: "sha-256", crypto.SHA384: "sha-384",
+		crypto.SHA512: "sha-512"} {
+		if mp["micalg"] == s {
+			ha = h
+		}
+	}
+	if ha == 0 {
+		return nil, nil, fmt.Errorf("unexpected micalg: %s", mp["micalg"])
+	}
+	var md []byte
+	rest := si.SignedAttrs.Bytes
+	for len(rest) > 0 {
+		var a attribute
+		if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse signed attribute: %w", err)
+		}
+		if a.Type.Equal(oidAttrMsgDigest) {
+			if _, err = asn1.Unmarshal(a.Values[0].FullBytes, &md); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse message digest: %w", err)
+			}
+		}
+	}
+	h := ha.New()
+	h.Write([]byte(entity))
+	if !bytes.Equal(md, h.Sum(nil)) {
+		return nil, nil, fmt.Errorf("message digest does not match the signed MIME entity")
+	}
+	sattrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode signed attributes: %w", err)
+	}
+	sa := map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA,
+	}
+	if _, ok := signer.PublicKey.(*ecdsa.PublicKey); ok {
+		sa = map[crypto.Hash]x509.SignatureAlgorithm{
+			crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384,
+			crypto.SHA512: x509.ECDSAWithSHA512,
+		}
+	}
+	if err = signer.CheckSignature(sa[ha], sattrs, si.Signature); err != nil {
+		return nil, nil, fmt.Errorf("failed to verify signature: %w", err)
+	}
+	return signer, []byte(entity), nil
+}
+
+func TestNewFromRSAKey(t *testing.T) {
+	ca := newTestCA(t)
+	k, kp := testRSAKey(t)
+	sc, err := NewConfig(testPEM(ca.issue(t, "toni.sender@example.com", k.Public()), ca.inter))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	if _, err = NewFromRSAKey(kp, sc); err != nil {
+		t.Errorf("NewFromRSAKey failed: %s", err)
+	}
+	pk8, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		t.Fatalf("failed to marshal RSA key: %s", err)
+	}
+	if _, err = NewFromRSAKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pk8}), sc); err != nil {
+		t.Errorf("NewFromRSAKey with PKCS#8 key failed: %s", err)
+	}
+	if _, err = NewFromRSAKey([]byte("invalid"), sc); !errors.Is(err, ErrDecodePEMFailed) {
+		t.Errorf("NewFromRSAKey with invalid key was supposed to fail with ErrDecodePEMFailed, got: %s", err)
+	}
+	_, ek := testECDSAKey(t)
+	if _, err = NewFromRSAKey(ek, sc); !errors.Is(err, ErrNotRSAKey) {
+		t.Errorf("NewFromRSAKey with ECDSA key was supposed to fail with ErrNotRSAKey, got: %s", err)
+	}
+	_, ok := testRSAKey(t)
+	if _, err = NewFromRSAKey(ok, sc); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("NewFromRSAKey with mismatching key was supposed to fail with ErrKeyMismatch, got: %s", err)
+	}
+	if _, err = NewFromRSAKey(kp, &SignerConfig{}); !errors.Is(err, ErrNoCertificate) {
+		t.Errorf("NewFromRSAKey without certificate was supposed to fail with ErrNoCertificate, got: %s", err)
+	}
+}
+
+func TestNewFromECDSAKey(t *testing.T) {
+	ca := newTestCA(t)
+	k, kp := testECDSAKey(t)
+	sc, err := NewConfig(testPEM(ca.issue(t, "toni.sender@example.com", k.Public())))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	if _, err = NewFromECDSAKey(kp, sc); err != nil {
+		t.Errorf("NewFromECDSAKey failed: %s", err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatalf("failed to marshal ECDSA key: %s", err)
+	}
+	if _, err = NewFromECDSAKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), sc); err != nil {
+		t.Errorf("NewFromECDSAKey with SEC 1 key failed: %s", err)
+	}
+	if _, err = NewFromECDSAKey([]byte("invalid"), sc); !errors.Is(err, ErrDecodePEMFailed) {
+		t.Errorf("NewFromECDSAKey with invalid key was supposed to fail with ErrDecodePEMFailed, got: %s", err)
+	}
+	_, rk := testRSAKey(t)
+	if _, err = NewFromECDSAKey(rk, sc); err == nil {
+		t.Errorf("NewFromECDSAKey with RSA key was supposed to fail, but didn't")
+	}
+	_, ok := testECDSAKey(t)
+	if _, err = NewFromECDSAKey(ok, sc); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("NewFromECDSAKey with mismatching key was supposed to fail with ErrKeyMismatch, got: %s", err)
+	}
+}
+
+func TestMiddleware_Handle(t *testing.T) {
+	ca := newTestCA(t)
+	rk, rkp := testRSAKey(t)
+	ek, ekp := testECDSAKey(t)
+	tests := []struct {
+		n  string
+		pk crypto.PublicKey
+		k  []byte
+		f  func([]byte, *SignerConfig) (*Middleware, error)
+		ha crypto.Hash
+		ma string
+	}{
+		{"RSA SHA-256", rk.Public(), rkp, NewFromRSAKey, crypto.SHA256, "sha-256"},
+		{"RSA SHA-512", rk.Public(), rkp, NewFromRSAKey, crypto.SHA512, "sha-512"},
+		{"ECDSA SHA-256", ek.Public(), ekp, NewFromECDSAKey, crypto.SHA256, "sha-256"},
+		{"ECDSA SHA-384", ek.Public(), ekp, NewFromECDSAKey, crypto.SHA384, "sha-384"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.n, func(t *testing.T) {
+			c := ca.issue(t, "toni.sender@example.com", tt.pk)
+			sc, err := NewConfig(testPEM(c), WithChain(testPEM(ca.inter)), WithHashAlgo(tt.ha))
+			if err != nil {
+				t.Fatalf("failed to create new config: %s", err)
+			}
+			mw, err := tt.f(tt.k, sc)
+			if err != nil {
+				t.Fatalf("failed to create new middleware: %s", err)
+			}
+			pm := testSignedMail(t, mw)
+			_, mp, err := mime.ParseMediaType(pm.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("failed to parse content type: %s", err)
+			}
+			if mp["micalg"] != tt.ma {
+				t.Errorf("Handle failed. Expected micalg %q, got: %q", tt.ma, mp["micalg"])
+			}
+			signer, e, err := testVerify(pm, ca.root)
+			if err != nil {
+				t.Fatalf("Handle failed. Signature verification failed: %s", err)
+			}
+			if !signer.Equal(c) {
+				t.Errorf("Handle failed. Unexpected signer certificate")
+			}
+			for _, s := range []string{"This is the mail body", "<p>This is the HTML body</p>",
+				`filename="attachment.txt"`} {
+				if !bytes.Contains(e, []byte(s)) {
+					t.Errorf("Handle failed. Expected %q in signed MIME entity", s)
+				}
+			}
+			if bytes.Contains(e, []byte("Subject:")) {
+				t.Errorf("Handle failed. Outer headers should not be part of the signed MIME entity")
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handle_tampered(t *testing.T) {
+	ca := newTestCA(t)
+	k, kp := testRSAKey(t)
+	sc, err := NewConfig(testPEM(ca.issue(t, "toni.sender@example.com", k.Public()), ca.inter))
+	if err != nil {
+		t.Fatalf("failed to create new config: %s", err)
+	}
+	mw, err := NewFromRSAKey(kp, sc)
+	if err != nil {
+		t.Fatalf("failed to create new middleware: %s", err)
+	}
+	m := mail.NewMsg(mail.WithMiddleware(mw))
+	m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+	buf := bytes.Buffer{}
+	if _, err = m.WriteTo(&buf); err != nil {
+		t.Fatalf("failed writing message to memory: %s", err)
+	}
+	tr := bytes.Replace(buf.Bytes(), []byte("This is the mail body"), []byte("This is the evil body"), 1)
+	pm, err := netmail.ReadMessage(bytes.NewReader(tr))
+	if err != nil {
+		t.Fatalf("failed to parse mail message: %s", err)
+	}
+	if _, _, err = testVerify(pm, ca.root); err == nil {
+		t.Errorf("verification of tampered mail was supposed to fail, but didn't")
+	}
+
+	other := newTestCA(t)
+	pm, err = netmail.ReadMessage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to parse mail message: %s", err)
+	}
+	if _, _, err = testVerify(pm, other.root); err == nil {
+		t.Errorf("verification against untrusted root was supposed to fail, but didn't")
+	}
+}
+
+func TestMiddleware_Handle_failure(t *testing.T) {
+	ca := newTestCA(t)
+	k, _ := testRSAKey(t)
+	c := testPEM(ca.issue(t, "toni.sender@example.com", k.Public()))
+
+	t.Run("fail-closed", func(t *testing.T) {
+		var herr error
+		lbuf := bytes.Buffer{}
+		sc, err := NewConfig(c, WithSignerLogger(log.New(&lbuf, "smime", log.LevelWarn)),
+			WithSignerErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+		if err != nil {
+			t.Fatalf("failed to create new config: %s", err)
+		}
+		mw, err := newMiddleware(sc, failingSigner{k})
+		if err != nil {
+			t.Fatalf("failed to create new middleware: %s", err)
+		}
+		m := mail.NewMsg(mail.WithMiddleware(mw))
+		if err = m.To("tina.recipient@example.com"); err != nil {
+			t.Fatalf("failed to set To address: %s", err)
+		}
+		m.SetBodyString(mail.TypeTextPlain, "This is the mail body")
+		buf := bytes.Buffer{}
+		_, err = m.WriteTo(&buf)
+		if !errors.Is(err, ErrNotSigned) || !errors.Is(err, errSignerFailed) {
+			t.Errorf("Handle with failing signer was supposed to fail with ErrNotSigned, got: %v", err)
+		}
+		if !errors.Is(herr, errSignerFailed) {
+			t.Errorf("Handle with failing signer failed. Expected ErrorHandler call, got: %v", herr)
+		}
+		if !strings.Contains(lbuf.String(), "ERROR: ") {
+			t.Errorf("Handle with failing signer failed. Expected logged error, got: %q", lbuf.String())
+		}
+		if bytes.Contains(buf.Bytes(), []byte("This is the mail body")) {
+			t.Errorf("Handle with failing signer failed. Mail body was written unsigned")
+		}
+		if _, err = m.GetRecipients(); err == nil {
+			t.Errorf("Handle with failing signer failed. Recipients were not removed")
+		}
+		if len(m.GetGenHeader(HeaderError)) != 1 {
+			t.Errorf("Handle with failing signer failed. Expected %s header", HeaderError)
+		}
+	})
+	t.Run("fail-open", func(t *testing.T) {
+		var herr error
+		lbuf := bytes.Buffer{}
+		sc, err := NewConfig(c, WithSignerFailurePolicy(FailOpen),
+			WithSignerLogger(log.New(&lbuf, "smime", log.LevelWarn)),
+			WithSignerErrorHandler(func(_ *mail.Msg, err error) { herr = err }))
+		if err != nil {
+			t.Fatalf("failed to create new config: %s", err)
+		}
+		mw, err := newMiddleware(sc, failingSigner{k})
+		if err != nil {
+			t.Fatalf("failed to create new middleware: %s", err)
+		}
+		pm := testSignedMail(t, mw)
+		if ct := pm.Header.Get("Content-Type"); strings.HasPrefix(ct, "multipart/signed") {
+			t.Errorf("Handle with FailOpen failed. Mail was not supposed to be signed, got: %s", ct)
+		}
+		if !errors.Is(herr, errSignerFailed) {
+			t.Errorf("Handle with FailOpen failed. Expected ErrorHandler call, got: %v", herr)
+		}
+		if !strings.Contains(lbuf.String(), "sending mail unsigned") {
+			t.Errorf("Handle with FailOpen failed. Expected logged error, got: %q", lbuf.String())
+		}
+	})
+}
+
+func TestMiddleware_Type(t *testing.T) {
+	mw := Middleware{}
+	if mw.Type() != Type {
+		t.Errorf("Type() failed. Expected: %s, got: %s", Type, mw.Type())
+	}
+}
+
+func TestBase64Lines(t *testing.T) {
+	l := strings.Split(strings.TrimSuffix(base64Lines(make([]byte, 200)), "\r\n"), "\r\n")
+	if len(l) != 4 {
+		t.Fatalf("base64Lines failed. Expected 4 lines, got: %d", len(l))
+	}
+	for _, s := range l[:3] {
+		if len(s) != base64LineLength {
+			t.Errorf("base64Lines failed. Expected line length %d, got: %d", base64LineLength, len(s))
+		}
+	}
+}